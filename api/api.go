@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo"
 	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/common/metrics"
 )
 
 // API服务模块
@@ -44,9 +45,18 @@ func (api *API) DefaultHandler(ctx echo.Context) error {
 	/ws/   全局状态
 	/tx/   交易
 	/account/ 账户
+	/metrics  Prometheus指标
 	`))
 }
 
+// MetricsHandler 以Prometheus文本格式输出所有指标
+func (api *API) MetricsHandler(ctx echo.Context) error {
+	ctx.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	ctx.Response().WriteHeader(200)
+	metrics.Default.WritePrometheus(ctx.Response())
+	return nil
+}
+
 func httpErrorHandler(err error, c echo.Context) {
 	var (
 		code = http.StatusInternalServerError
@@ -27,7 +27,7 @@ func (bc *BlockChain) statusHandler(ctx echo.Context) error {
 	resp := struct {
 		CurBlockHeight uint64 `json:"cur_block_height"`
 		MaxBlockHeight uint64 `json:"max_block_height"`
-	}{CurBlockHeight: bc.ws.BlockNum, MaxBlockHeight: bc.pool.maxHeight}
+	}{CurBlockHeight: bc.ws.BlockNum, MaxBlockHeight: bc.pool.MaxHeight()}
 
 	respBody, _ := json.Marshal(resp)
 
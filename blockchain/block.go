@@ -1,8 +1,6 @@
 package blockchain
 
 import (
-	"encoding/json"
-
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 	"github.com/wupeaking/pbft_impl/consensus"
@@ -81,15 +79,10 @@ func (bc *BlockChain) Start() error {
 
 }
 
-func (bc *BlockChain) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer) {
+func (bc *BlockChain) msgOnRecv(modelID string, msgPkg *network.BroadcastMsg, p *network.Peer) {
 	if modelID != "blockchain" {
 		return
 	}
-	var msgPkg network.BroadcastMsg
-	if err := json.Unmarshal(msgBytes, &msgPkg); err != nil {
-		logger.Errorf("blockchain模块 消息不能被反序列化 err: %v", err)
-		return
-	}
 
 	switch msgPkg.MsgType {
 	case model.BroadcastMsgType_request_load_block:
@@ -97,6 +90,7 @@ func (bc *BlockChain) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer
 		var blockReq model.BlockRequest
 		if err := proto.Unmarshal(msgPkg.Msg, &blockReq); err != nil {
 			logger.Errorf("不能解析出请求的区块高度")
+			network.ReportPeer(bc.switcher, p, network.EventBadMessage)
 			return
 		}
 		blockNum := blockReq.BlockNum
@@ -125,6 +119,8 @@ func (bc *BlockChain) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer
 			ModelID: "blockchain",
 			MsgType: model.BroadcastMsgType_send_specific_block,
 			Msg:     body,
+			// 带回请求ID 方便请求方对应响应
+			RequestID: msgPkg.RequestID,
 		}
 		err = bc.switcher.BroadcastToPeer("blockchain", &msg, p)
 		if err != nil {
@@ -137,11 +133,13 @@ func (bc *BlockChain) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer
 	case model.BroadcastMsgType_send_specific_block:
 		// 表示对方向本节点发送区块信息
 		var blockResp model.BlockResponse
-		if proto.Unmarshal(msgPkg.Msg, &blockResp) != nil {
+		if proto.Unmarshal(msgPkg.Msg, &blockResp) != nil || blockResp.Block == nil {
+			network.ReportPeer(bc.switcher, p, network.EventBadMessage)
 			return
 		}
 		if blockResp.RequestType == model.BlockRequestType_only_header {
 			// 校验区块头
+			// 本节点落后时验证者集合可能已经变化 不能确定是对方的问题
 			if !bc.consensusEngine.VerfifyBlockHeader(blockResp.Block) {
 				return
 			}
@@ -151,9 +149,27 @@ func (bc *BlockChain) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer
 			}
 			bc.pool.SetPeerHight(p, blockResp.Block.BlockNum)
 		} else {
+			// 带有请求ID的响应 请求已经完成时是迟到的重复响应 高度和请求不一致时是对方的问题
+			if msgPkg.RequestID != 0 {
+				num, ok := bc.pool.requestHeight(msgPkg.RequestID)
+				if !ok {
+					return
+				}
+				if num != blockResp.Block.BlockNum {
+					network.ReportPeer(bc.switcher, p, network.EventBadMessage)
+					return
+				}
+			}
 			if !bc.consensusEngine.VerfifyMostBlock(blockResp.Block) {
+				// 只有下一个区块一定使用本节点当前的验证者集合
+				if blockResp.Block.BlockNum == bc.ws.BlockNum+1 {
+					network.ReportPeer(bc.switcher, p, network.EventInvalidBlock)
+				}
 				return
 			}
+			if bc.ws.BlockNum < blockResp.Block.BlockNum {
+				network.ReportPeer(bc.switcher, p, network.EventUsefulBlock)
+			}
 			bc.pool.AddBlock(p, blockResp.Block)
 		}
 
@@ -2,14 +2,22 @@ package blockchain
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common/metrics"
 	"github.com/wupeaking/pbft_impl/model"
 	"github.com/wupeaking/pbft_impl/network"
 	"github.com/wupeaking/pbft_impl/storage/world_state"
 )
 
+// 同步指标是全局的 只注册一次 输出最近创建的BlockPool的状态
+var (
+	syncMetricsOnce sync.Once
+	syncPool        atomic.Value // *BlockPool
+)
+
 type BlockPool struct {
 	switcher    network.SwitcherI
 	ws          *world_state.WroldState
@@ -20,15 +28,17 @@ type BlockPool struct {
 	stopEngine  chan struct{}
 	startEngine chan struct{}
 	sync.RWMutex
-	maxHeight        uint64
+	maxHeight        uint64 // 读写时需要持有锁
 	requestComplate  map[uint64]chan struct{}
+	requestHeights   map[uint64]uint64 // 正在进行的下载请求 请求ID对应的区块高度
+	nextRequestID    uint64
 	downloadSig      chan struct{}
 	loadRoutineNum   int
 	loadRoutineGroup *sync.WaitGroup
 }
 
 func NewBlockPool(ws *world_state.WroldState, switcher network.SwitcherI) *BlockPool {
-	return &BlockPool{
+	bp := &BlockPool{
 		switcher:         switcher,
 		ws:               ws,
 		heightPeers:      make(map[*network.Peer]uint64),
@@ -38,25 +48,59 @@ func NewBlockPool(ws *world_state.WroldState, switcher network.SwitcherI) *Block
 		startEngine:      make(chan struct{}, 1),
 		stopEngine:       make(chan struct{}, 1),
 		requestComplate:  make(map[uint64]chan struct{}),
+		requestHeights:   make(map[uint64]uint64),
 		downloadSig:      make(chan struct{}, 1),
 		loadRoutineGroup: &sync.WaitGroup{},
 		loadRoutineNum:   100,
 	}
+	bp.registerMetrics()
+	return bp
+}
+
+// registerMetrics 注册区块同步相关的指标
+func (bp *BlockPool) registerMetrics() {
+	syncPool.Store(bp)
+	syncMetricsOnce.Do(func() {
+		metrics.NewGaugeFunc("pbft_sync_max_height", "其他节点中已知的最高区块高度",
+			func() float64 { return float64(syncPool.Load().(*BlockPool).MaxHeight()) })
+		metrics.NewGaugeFunc("pbft_sync_lag_blocks", "本节点落后最高区块的数量", func() float64 {
+			bp := syncPool.Load().(*BlockPool)
+			maxHeight := bp.MaxHeight()
+			cur, _ := bp.ws.Progress()
+			if maxHeight <= cur {
+				return 0
+			}
+			return float64(maxHeight - cur)
+		})
+		metrics.NewGaugeFunc("pbft_sync_inflight_requests", "正在进行的区块下载请求数量", func() float64 {
+			bp := syncPool.Load().(*BlockPool)
+			bp.RLock()
+			defer bp.RUnlock()
+			return float64(len(bp.requestComplate))
+		})
+	})
+}
+
+// MaxHeight 其他节点中已知的最高区块高度
+func (bp *BlockPool) MaxHeight() uint64 {
+	bp.RLock()
+	defer bp.RUnlock()
+	return bp.maxHeight
 }
 
 func (bp *BlockPool) SetPeerHight(peer *network.Peer, height uint64) {
 	if bp.ws.BlockNum >= height {
 		return
 	}
+	bp.Lock()
+	defer bp.Unlock()
 	// 说明本节点已经落后 停止共识 追上最高节点
 	if bp.maxHeight < height {
 		logger.Warnf("本节点落后区块 停止共识 本节点区块高度: %d 当前区块高度: %d", bp.maxHeight, height)
 		bp.maxHeight = height
 	}
 	// 尝试把peer对应的高度记录下来 为后面从指定的peer下载区块做准备
-	bp.Lock()
 	bp.heightPeers[peer] = height
-	bp.Unlock()
 }
 
 func (bp *BlockPool) AddBlock(peer *network.Peer, block *model.PbftBlock) {
@@ -77,6 +121,14 @@ func (bp *BlockPool) AddBlock(peer *network.Peer, block *model.PbftBlock) {
 	}
 }
 
+// requestHeight 请求ID对应的区块高度 请求已经完成或者不存在时返回false
+func (bp *BlockPool) requestHeight(id uint64) (uint64, bool) {
+	bp.RLock()
+	defer bp.RUnlock()
+	num, ok := bp.requestHeights[id]
+	return num, ok
+}
+
 func (bp *BlockPool) RemoveBlock(block *model.PbftBlock) {
 	bp.Lock()
 	delete(bp.numBlock, block.BlockNum)
@@ -97,14 +149,15 @@ func (bp *BlockPool) Routine() {
 		case <-stateTicker.C:
 			// 检查当前区块高度是否小于最高区块高度
 			// 如果小于 则停止共识 同时通知download任务开始下载
-			if bp.ws.BlockNum >= bp.maxHeight {
+			maxHeight := bp.MaxHeight()
+			if bp.ws.BlockNum >= maxHeight {
 				select {
 				case bp.startEngine <- struct{}{}:
 				default:
 				}
 
 			} else {
-				logger.Warnf("本节点落后区块 本节点区块高度: %d 当前最高区块高度: %d", bp.ws.BlockNum, bp.maxHeight)
+				logger.Warnf("本节点落后区块 本节点区块高度: %d 当前最高区块高度: %d", bp.ws.BlockNum, maxHeight)
 				select {
 				case bp.stopEngine <- struct{}{}:
 				default:
@@ -156,7 +209,7 @@ func (bp *BlockPool) requestBlockHeight() {
 func (bp *BlockPool) DownloadBlock() {
 	for range bp.downloadSig {
 		curHeight := bp.ws.BlockNum
-		maxHeight := bp.maxHeight
+		maxHeight := bp.MaxHeight()
 		if curHeight >= maxHeight {
 			continue
 		}
@@ -185,14 +238,18 @@ func (bp *BlockPool) downRoutine(num uint64) {
 		BlockNum:    int64(num),
 	}
 	body, _ := proto.Marshal(&request)
+	// 对方在响应中带回请求ID 用来校验响应的区块是否是请求的高度
+	id := atomic.AddUint64(&bp.nextRequestID, 1)
 	msg := network.BroadcastMsg{
-		ModelID: "blockchain",
-		MsgType: model.BroadcastMsgType_request_load_block,
-		Msg:     body,
+		ModelID:   "blockchain",
+		MsgType:   model.BroadcastMsgType_request_load_block,
+		Msg:       body,
+		RequestID: id,
 	}
 	complatedSig := make(chan struct{}, 1)
 	bp.Lock()
 	bp.requestComplate[num] = complatedSig
+	bp.requestHeights[id] = num
 	bp.Unlock()
 
 	peer := bp.pickPeer(num, nil)
@@ -205,10 +262,12 @@ func (bp *BlockPool) downRoutine(num uint64) {
 		case <-complatedSig:
 			bp.Lock()
 			delete(bp.requestComplate, num)
+			delete(bp.requestHeights, id)
 			bp.Unlock()
 			return
 		case <-timeout.C:
 			// 重新挑选一个peer  再次广播
+			network.ReportPeer(bp.switcher, peer, network.EventTimeout)
 			peer = bp.pickPeer(num, peer)
 			bp.switcher.BroadcastToPeer("blockchain", &msg, peer)
 			timeout.Reset(5 * time.Second)
@@ -0,0 +1,269 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/wupeaking/pbft_impl/common"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/consensus"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/cvm"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+)
+
+/*
+	verify-chain: 离线校验本地链数据
+	从创世区块开始逐个校验区块的前区块指向 区块哈希 2f+1签名 交易和收据的默克尔根
+	交易在一个临时的内存状态中重新执行 执行结果和本地保存的账户比较
+	遇到第一个不一致的高度即停止
+*/
+
+// ChainReport 校验结果
+type ChainReport struct {
+	Height   uint64 // 本地最高区块
+	Verified uint64 // 校验通过的最高区块
+	Diverged bool   // 是否发现不一致
+	// 第一个不一致的高度 账户不一致时为最后修改该账户的区块高度 为0表示和创世配置不一致
+	DivergentHeight uint64
+	Reason          string
+}
+
+func (r *ChainReport) diverge(height uint64, format string, args ...interface{}) *ChainReport {
+	r.Diverged = true
+	r.DivergentHeight = height
+	r.Reason = fmt.Sprintf(format, args...)
+	return r
+}
+
+// VerifyChainDir 以只读方式打开数据目录并校验
+func VerifyChainDir(dir string) (*ChainReport, error) {
+	cfgFile := path.Join(dir, "config.json")
+	// LoadConfig在文件不存在时会写入默认配置 只读校验时不能使用
+	if !common.FileExist(cfgFile) {
+		return nil, fmt.Errorf("配置文件%s不存在", cfgFile)
+	}
+	cfg, err := config.LoadConfig(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	db, err := cache.NewReadOnly(dir)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyChain(db, cfg)
+}
+
+// VerifyChain 校验db中从创世区块到BlockMeta.BlockHeight的所有区块 cfg中的账户作为创世状态
+func VerifyChain(db *cache.DBCache, cfg *config.Configure) (*ChainReport, error) {
+	meta, err := db.GetBlockMeta()
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("block_meta不存在")
+	}
+	genesis, err := db.GetGenesisBlock()
+	if err != nil {
+		return nil, err
+	}
+	if genesis == nil {
+		return nil, fmt.Errorf("创世区块不存在")
+	}
+	report := &ChainReport{Height: meta.BlockHeight}
+
+	// 临时状态 只包含创世配置中的账户
+	scratch := cache.NewMemory()
+	for _, a := range cfg.AccountCfg {
+		acc := &model.Account{
+			Id:          &model.Address{Address: a.Address},
+			Balance:     &model.Amount{Amount: fmt.Sprintf("%d", a.Amount)},
+			AccountType: int32(a.Type),
+		}
+		if err := scratch.Insert(acc); err != nil {
+			return nil, err
+		}
+	}
+	vm := cvm.New(scratch, cfg)
+
+	verifiers := genesisVerifiers(genesis, cfg)
+	pending := make([]*model.ValidatorChange, 0)
+	// 每个账户最后一次被修改的区块高度
+	touched := make(map[string]uint64)
+	prevID := model.GenesisBlockId
+
+	for h := uint64(1); h <= meta.BlockHeight; h++ {
+		verifiers, pending = applyDueChanges(verifiers, pending, h)
+
+		blk, err := db.GetBlockByNum(h)
+		if err != nil || blk == nil {
+			return report.diverge(h, "读取区块失败 err: %v", err), nil
+		}
+		if blk.BlockNum != h {
+			return report.diverge(h, "区块编号不一致 保存的编号为: %d", blk.BlockNum), nil
+		}
+		if blk.PrevBlock != prevID {
+			return report.diverge(h, "前区块指向不一致 区块指向: %s 前一个区块: %s", blk.PrevBlock, prevID), nil
+		}
+		hash := blk.HeaderHash()
+		if blk.BlockId != hex.EncodeToString(hash) {
+			return report.diverge(h, "区块哈希校验不一致"), nil
+		}
+		if err := verifyBlockSigns(blk, hash, verifiers); err != nil {
+			return report.diverge(h, "区块签名校验失败 %v", err), nil
+		}
+		txs := blk.Tansactions.GetTansactions()
+		receipts := blk.TransactionReceipts.GetTansactionReceipts()
+		if !bytes.Equal(blk.Tansactions.MerkleRoot(), blk.TxRoot) {
+			return report.diverge(h, "交易的默克尔树校验不一致"), nil
+		}
+		if !bytes.Equal(blk.TransactionReceipts.MerkleRoot(), blk.TxReceiptsRoot) {
+			return report.diverge(h, "交易收据的默克尔树校验不一致"), nil
+		}
+		if len(txs) != len(receipts) {
+			return report.diverge(h, "区块交易数量和收据数量不一致"), nil
+		}
+
+		for i, tx := range txs {
+			txr, err := vm.Exec(tx)
+			if err != nil {
+				return report.diverge(h, "重新执行交易%x失败 err: %v", tx.Sign, err), nil
+			}
+			if txr.Status != receipts[i].Status {
+				return report.diverge(h, "交易%x执行结果不一致 重新执行: %d 区块中: %d",
+					tx.Sign, txr.Status, receipts[i].Status), nil
+			}
+			if txr.Status == 0 {
+				touched[tx.Sender.GetAddress()] = h
+				touched[tx.Recipient.GetAddress()] = h
+			}
+		}
+		pending = append(pending, committedChanges(blk)...)
+		prevID = blk.BlockId
+		report.Verified = h
+	}
+
+	if height, reason := compareAccounts(db, scratch, touched); reason != "" {
+		return report.diverge(height, "%s", reason), nil
+	}
+	return report, nil
+}
+
+// genesisVerifiers 创世区块中只保存了验证者公钥 权重从创世配置中读取
+func genesisVerifiers(genesis *model.Genesis, cfg *config.Configure) []*model.Verifier {
+	verifiers := make([]*model.Verifier, 0, len(genesis.Verifiers))
+	for i, v := range genesis.Verifiers {
+		gv := &model.Verifier{PublickKey: v.PublickKey, SeqNum: int32(i), Weight: v.Weight}
+		for _, c := range cfg.ConsensusCfg.Verfiers {
+			pub, err := cryptogo.Hex2Bytes(c.Publickey)
+			if err == nil && bytes.Equal(pub, v.PublickKey) {
+				gv.Weight = c.Weight
+			}
+		}
+		verifiers = append(verifiers, gv)
+	}
+	return verifiers
+}
+
+// applyDueChanges 切换到高度h使用的验证者集合 和WroldState.ApplyValidatorChanges一致
+func applyDueChanges(verifiers []*model.Verifier, pending []*model.ValidatorChange,
+	h uint64) ([]*model.Verifier, []*model.ValidatorChange) {
+	due := make([]*model.ValidatorChange, 0)
+	remain := make([]*model.ValidatorChange, 0, len(pending))
+	for _, c := range pending {
+		if c.EffectiveHeight <= h {
+			due = append(due, c)
+		} else {
+			remain = append(remain, c)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].EffectiveHeight < due[j].EffectiveHeight })
+	for _, c := range due {
+		if next, err := model.ApplyValidatorChange(verifiers, c); err == nil {
+			verifiers = next
+		}
+	}
+	return verifiers, remain
+}
+
+// committedChanges 区块中执行成功的验证者变更 和共识模块提交区块时的规则一致
+func committedChanges(blk *model.PbftBlock) []*model.ValidatorChange {
+	changes := make([]*model.ValidatorChange, 0)
+	receipts := blk.TransactionReceipts.GetTansactionReceipts()
+	for i, tx := range blk.Tansactions.GetTansactions() {
+		if !tx.IsValidatorChange() || i >= len(receipts) || receipts[i].Status != 0 {
+			continue
+		}
+		c, err := tx.DecodeValidatorChange()
+		if err != nil || c.EffectiveHeight < blk.BlockNum+consensus.ValidatorChangeDelay {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// verifyBlockSigns 主节点需要是验证者并且签名正确 签名的投票权重超过总权重的2/3
+func verifyBlockSigns(blk *model.PbftBlock, hash []byte, verifiers []*model.Verifier) error {
+	primary := false
+	for _, v := range verifiers {
+		if bytes.Equal(v.PublickKey, blk.SignerId) {
+			primary = true
+		}
+	}
+	if !primary {
+		return fmt.Errorf("主节点%x不是当前的验证者", blk.SignerId)
+	}
+	pubKey, err := cryptogo.LoadPublicKey(fmt.Sprintf("0x%x", blk.SignerId))
+	if err != nil || !cryptogo.VerifySign(pubKey, fmt.Sprintf("0x%x", blk.Sign), fmt.Sprintf("0x%x", hash)) {
+		return fmt.Errorf("主节点签名错误")
+	}
+	return blk.VerifyQuorum(verifiers, hash)
+}
+
+// compareAccounts 比较重新执行后的账户和本地保存的账户 返回最早的不一致高度和原因
+func compareAccounts(db, scratch *cache.DBCache, touched map[string]uint64) (uint64, string) {
+	var (
+		height uint64
+		reason string
+	)
+	mismatch := func(addr string, format string, args ...interface{}) {
+		h := touched[addr]
+		if reason == "" || h < height {
+			height = h
+			reason = fmt.Sprintf(format, args...)
+		}
+	}
+	err := scratch.ScanAccounts(func(acc *model.Account) bool {
+		addr := acc.Id.GetAddress()
+		stored, err := db.GetAccountByID(addr)
+		if err != nil || stored == nil {
+			mismatch(addr, "账户%s在本地不存在", addr)
+			return true
+		}
+		if model.Compare(stored.Balance.GetAmount(), acc.Balance.GetAmount()) != 0 ||
+			stored.AccountType != acc.AccountType {
+			mismatch(addr, "账户%s不一致 重新执行后余额: %s 本地余额: %s",
+				addr, acc.Balance.GetAmount(), stored.Balance.GetAmount())
+		}
+		return true
+	})
+	if err != nil {
+		return 0, fmt.Sprintf("读取账户失败 err: %v", err)
+	}
+	err = db.ScanAccounts(func(acc *model.Account) bool {
+		addr := acc.Id.GetAddress()
+		if a, _ := scratch.GetAccountByID(addr); a == nil {
+			mismatch(addr, "本地账户%s在重新执行后不存在", addr)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, fmt.Sprintf("读取本地账户失败 err: %v", err)
+	}
+	return height, reason
+}
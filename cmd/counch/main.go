@@ -1,10 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
 	"github.com/urfave/cli/v2"
+	"github.com/wupeaking/pbft_impl/blockchain"
 	"github.com/wupeaking/pbft_impl/cmd/account"
 	"github.com/wupeaking/pbft_impl/node"
 )
@@ -93,6 +95,26 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:        "verify-chain",
+				Usage:       "离线校验本地链数据",
+				Description: "以只读方式打开数据目录 从创世区块开始校验所有区块并重新执行交易 输出第一个不一致的高度",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "dir", Usage: "数据目录", DefaultText: "./.counch", Value: "./.counch"},
+				},
+				Action: func(c *cli.Context) error {
+					report, err := blockchain.VerifyChainDir(c.String("dir"))
+					if err != nil {
+						return err
+					}
+					if report.Diverged {
+						return cli.Exit(fmt.Sprintf("校验失败 不一致的高度: %d 已校验到: %d/%d 原因: %s",
+							report.DivergentHeight, report.Verified, report.Height, report.Reason), 1)
+					}
+					fmt.Printf("校验通过 区块高度: %d\n", report.Height)
+					return nil
+				},
+			},
 		},
 		Action: func(c *cli.Context) error {
 			node.New().Run()
@@ -28,7 +28,8 @@ func main() {
 		LogLevel:   "info",
 		Bootstrap:  true,
 	}}
-	switcher, err := libp2p.New(cfg)
+	// 引导节点只提供节点发现 不处理消息 不需要握手
+	switcher, err := libp2p.New(cfg, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -36,13 +36,71 @@ type ConsensusCfg struct {
 	Verfiers   []struct {
 		Publickey  string `json:"publicKey" yaml:"publicKey"`
 		PriVateKey string `json:"privateKey" yaml:"privateKey"`
+		Weight     uint64 `json:"weight" yaml:"weight"` // 投票和按权重选择主节点时的权重 为0时按1计算
 	} `json:"verfiers" yaml:"verfiers"`
-	Timeout     int `json:"timeout" yaml:"timeout"`
+	Timeout     int `json:"timeout" yaml:"timeout"` // 状态转换超时 单位秒
 	Coordinator struct {
 		Publickey  string `json:"publicKey" yaml:"publicKey"`
 		PriVateKey string `json:"privateKey" yaml:"privateKey"`
 	} `json:"coordinator"`
 	LogLevel string `json:"logLevel"`
+	// 连续viewchange时超时按指数退避的上限 单位秒
+	MaxTimeout int `json:"maxTimeout" yaml:"maxTimeout"`
+	// 定时尝试提议区块的间隔 单位毫秒
+	ProposalInterval int `json:"proposalInterval" yaml:"proposalInterval"`
+	// viewchange时重新广播的间隔 单位毫秒
+	RebroadcastInterval int `json:"rebroadcastInterval" yaml:"rebroadcastInterval"`
+	// 每个区块最多的交易数量
+	MaxBlockTxs int `json:"maxBlockTxs" yaml:"maxBlockTxs"`
+	// 区块中交易和收据最多的字节数
+	MaxBlockBytes int `json:"maxBlockBytes" yaml:"maxBlockBytes"`
+	// 与前一个区块的最小时间间隔 单位秒
+	MinBlockInterval int `json:"minBlockInterval" yaml:"minBlockInterval"`
+	// 交易池为空时 超过此间隔仍然出一个空块作为心跳 单位秒
+	MaxBlockInterval int `json:"maxBlockInterval" yaml:"maxBlockInterval"`
+	// 交易池为空时不出块 所有验证者必须一致
+	SkipEmptyBlocks bool `json:"skipEmptyBlocks" yaml:"skipEmptyBlocks"`
+	// 区块时间戳最多比本地时间快多少秒 超过时拒绝区块
+	MaxClockSkew int `json:"maxClockSkew" yaml:"maxClockSkew"`
+	// 每个签名者每种共识消息最多排队的数量
+	MsgQueueSize int `json:"msgQueueSize" yaml:"msgQueueSize"`
+	// 单条共识消息最多的字节数
+	MaxMsgBytes int `json:"maxMsgBytes" yaml:"maxMsgBytes"`
+	// 每分钟每个peer最多发送的无效共识消息数量 超过后断开连接
+	MaxInvalidMsgs int `json:"maxInvalidMsgs" yaml:"maxInvalidMsgs"`
+	// 不是验证者时以观察者模式跟随共识 只提交观察到2f+1个commit的区块 不参与投票
+	Observer bool `json:"observer" yaml:"observer"`
+	// 主节点选择策略 round_robin(默认) weighted reputation 所有节点必须一致
+	LeaderElection string `json:"leaderElection" yaml:"leaderElection"`
+	// 按信誉选择时 在最近多少个区块内超时过的主节点会被跳过
+	ReputationWindow int `json:"reputationWindow" yaml:"reputationWindow"`
+	// 流水线窗口 最多同时处理多少个高度的PrePrepare和Prepare阶段 小于等于1时不开启流水线
+	PipelineWindow int `json:"pipelineWindow" yaml:"pipelineWindow"`
+	// 每隔多少个区块生成一次checkpoint
+	CheckpointInterval int `json:"checkpointInterval" yaml:"checkpointInterval"`
+	// 共识预写日志的存储路径 重启后从中恢复共识状态
+	WALPath string `json:"walPath" yaml:"walPath"`
+	// 是否是测试网络 只有测试网络才允许开启故障注入
+	TestNet bool `json:"testNet" yaml:"testNet"`
+	// 故障注入 让本节点按配置作恶 用于验证共识的安全性
+	Fault *FaultCfg `json:"fault,omitempty" yaml:"fault,omitempty"`
+}
+
+type FaultCfg struct {
+	Enable bool  `json:"enable" yaml:"enable"`
+	Seed   int64 `json:"seed" yaml:"seed"` // 故障注入的随机种子
+	// 作为主节点时 向一半节点发送另一个冲突的区块
+	EquivocatePrimary bool `json:"equivocatePrimary" yaml:"equivocatePrimary"`
+	// 不发送prepare和commit投票
+	WithholdVotes bool `json:"withholdVotes" yaml:"withholdVotes"`
+	// 发送消息时 重放以前视图中的旧消息
+	ReplayStale bool `json:"replayStale" yaml:"replayStale"`
+	// 篡改发出消息的签名
+	CorruptSign bool `json:"corruptSign" yaml:"corruptSign"`
+	// 发出消息的丢弃概率
+	DropRate float64 `json:"dropRate" yaml:"dropRate"`
+	// 发出消息的最大延迟 单位毫秒
+	MaxDelay int `json:"maxDelay" yaml:"maxDelay"`
 }
 
 type TxCfg struct {
@@ -59,6 +117,16 @@ type NetworkCfg struct {
 	LogLevel       string     `json:"logLevel"`
 	Bootstrap      bool       `json:"bootstrap"`
 	BootstrapPeers []string   `json:"bootstrapPeers"`
+	// 链ID 握手时链ID不同的节点互相拒绝 为空时使用默认值
+	ChainID string `json:"chainID" yaml:"chainID"`
+	// 是否接受不支持握手的旧版本节点 只在滚动升级期间开启
+	AllowLegacyPeers bool `json:"allowLegacyPeers" yaml:"allowLegacyPeers"`
+	// peer信誉分数低于此值时被禁止 必须为负数
+	BanThreshold int `json:"banThreshold" yaml:"banThreshold"`
+	// 禁止的时长 单位秒
+	BanDuration int `json:"banDuration" yaml:"banDuration"`
+	// 禁止列表的保存路径 重启后仍然有效 为空时不保存
+	BanListPath string `json:"banListPath" yaml:"banListPath"`
 }
 
 type NodeAddr struct {
@@ -139,6 +207,7 @@ func DefaultConfig() (*Configure, error) {
 			Verfiers: []struct {
 				Publickey  string `json:"publicKey" yaml:"publicKey"`
 				PriVateKey string `json:"privateKey" yaml:"privateKey"`
+				Weight     uint64 `json:"weight" yaml:"weight"` // 投票和按权重选择主节点时的权重 为0时按1计算
 			}{
 				{
 					Publickey: "0xc4024ffd0b42495f49002b5da606512aee341c53e43a641b7d8efac8e29f6ed2d5c6449fe4343f41c5216a84ea9dd43e07daeeadb38556bb19527ce699394cd7",
@@ -150,20 +219,40 @@ func DefaultConfig() (*Configure, error) {
 					Publickey: "0x5ca153355f800c66150130b8becb951856e408555829eb07de89d3ed35fdd85872923fd9c51444ace5df3d6ce331da676a5e90596e7952f3f4a05c623bc00d77",
 				},
 			},
-			Timeout:  10,
-			LogLevel: "info",
+			Timeout:             10,
+			MaxTimeout:          300,
+			ProposalInterval:    5000,
+			RebroadcastInterval: 4000,
+			LogLevel:            "info",
+			PipelineWindow:      4,
+			LeaderElection:      "round_robin",
+			ReputationWindow:    10,
+			MaxBlockTxs:         3000,
+			MaxBlockBytes:       4 << 20,
+			MaxBlockInterval:    60,
+			SkipEmptyBlocks:     true,
+			MaxClockSkew:        30,
+			MsgQueueSize:        128,
+			MaxMsgBytes:         8 << 20,
+			MaxInvalidMsgs:      10,
+			CheckpointInterval:  10,
+			WALPath:             "./.counch/pbft/consensus_wal.db",
 		},
 		TxCfg{
 			MaxTxNum: 10000,
 			LogLevel: "info",
 		},
 		NetworkCfg{
-			NetMode:    "p2p",
-			LocalAddr:  "0.0.0.0:19876",
-			Publickey:  pub,
-			PriVateKey: priv,
-			LogLevel:   "info",
-			Bootstrap:  false,
+			NetMode:      "p2p",
+			LocalAddr:    "0.0.0.0:19876",
+			Publickey:    pub,
+			PriVateKey:   priv,
+			LogLevel:     "info",
+			Bootstrap:    false,
+			ChainID:      "counch",
+			BanThreshold: -100,
+			BanDuration:  3600,
+			BanListPath:  "./.counch/banlist.json",
 		},
 		DBCfg{
 			StorageEngine: "levelDB",
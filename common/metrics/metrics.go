@@ -0,0 +1,316 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	metrics: 以Prometheus文本格式输出的指标
+	只实现了节点需要的counter gauge和histogram 不依赖外部库
+	指标默认注册到Default中 同名指标重复注册时后注册的覆盖先注册的
+*/
+
+// Default 默认的指标注册表 /metrics接口输出此注册表中的所有指标
+var Default = NewRegistry()
+
+type collector interface {
+	typ() string
+	write(w io.Writer, name string)
+}
+
+type entry struct {
+	help string
+	c    collector
+}
+
+type Registry struct {
+	sync.Mutex
+	metrics map[string]*entry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]*entry)}
+}
+
+func (r *Registry) register(name, help string, c collector) {
+	r.Lock()
+	defer r.Unlock()
+	r.metrics[name] = &entry{help: help, c: c}
+}
+
+// WritePrometheus 按名称顺序输出所有指标
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	entries := make(map[string]*entry, len(r.metrics))
+	for k, v := range r.metrics {
+		entries[k] = v
+	}
+	r.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		e := entries[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(e.help, "\n", " "))
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, e.c.typ())
+		e.c.write(w, name)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels 生成{a="1",b="2"}形式的标签 extra为额外追加的标签 如histogram的le
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i := range names {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, names[i], labelEscaper.Replace(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[i], labelEscaper.Replace(extra[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Counter 只增不减的计数
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+func (c *Counter) typ() string { return "counter" }
+
+func (c *Counter) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %d\n", name, c.Value())
+}
+
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	Default.register(name, help, c)
+	return c
+}
+
+// Gauge 可以任意设置的值
+type Gauge struct {
+	bits uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) typ() string { return "gauge" }
+
+func (g *Gauge) write(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(g.Value()))
+}
+
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	Default.register(name, help, g)
+	return g
+}
+
+// gaugeFunc 输出时才计算的值 用于队列长度 区块高度等已经由其他模块维护的状态
+type gaugeFunc struct {
+	label string
+	fn    func() map[string]float64
+}
+
+func (g *gaugeFunc) typ() string { return "gauge" }
+
+func (g *gaugeFunc) write(w io.Writer, name string) {
+	values := g.fn()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if g.label == "" {
+			fmt.Fprintf(w, "%s %s\n", name, formatFloat(values[k]))
+			continue
+		}
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels([]string{g.label}, []string{k}), formatFloat(values[k]))
+	}
+}
+
+// NewGaugeFunc 注册一个输出时调用fn计算的gauge
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(name, help, &gaugeFunc{fn: func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	}})
+}
+
+// NewGaugeFuncVec 注册一个带一个标签的gauge fn返回标签值到指标值的映射
+func NewGaugeFuncVec(name, help, label string, fn func() map[string]float64) {
+	Default.register(name, help, &gaugeFunc{label: label, fn: fn})
+}
+
+// Histogram 按桶统计观测值的分布
+type Histogram struct {
+	sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) writeWithLabels(w io.Writer, name string, names, values []string) {
+	h.Lock()
+	defer h.Unlock()
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(names, values, "le", formatFloat(b)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(names, values, "le", "+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(names, values), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(names, values), h.count)
+}
+
+// DefBuckets 默认的桶 单位秒
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// vec 按标签值区分的一组指标
+type vec struct {
+	sync.Mutex
+	labels   []string
+	children map[string]interface{}
+	values   map[string][]string
+	newChild func() interface{}
+}
+
+func newVec(labels []string, newChild func() interface{}) *vec {
+	return &vec{labels: labels, children: make(map[string]interface{}),
+		values: make(map[string][]string), newChild: newChild}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: 标签数量不一致 需要%d个 实际%d个", len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.Lock()
+	defer v.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = v.newChild()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+func (v *vec) each(fn func(values []string, c interface{})) {
+	v.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	children := make(map[string]interface{}, len(v.children))
+	for k, c := range v.children {
+		children[k] = c
+	}
+	v.Unlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(v.values[k], children[k])
+	}
+}
+
+type CounterVec struct {
+	*vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{newVec(labels, func() interface{} { return &Counter{} })}
+	Default.register(name, help, cv)
+	return cv
+}
+
+func (cv *CounterVec) With(values ...string) *Counter {
+	return cv.with(values).(*Counter)
+}
+
+func (cv *CounterVec) typ() string { return "counter" }
+
+func (cv *CounterVec) write(w io.Writer, name string) {
+	cv.each(func(values []string, c interface{}) {
+		fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(cv.labels, values), c.(*Counter).Value())
+	})
+}
+
+type HistogramVec struct {
+	*vec
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	hv := &HistogramVec{newVec(labels, func() interface{} { return newHistogram(buckets) })}
+	Default.register(name, help, hv)
+	return hv
+}
+
+func (hv *HistogramVec) With(values ...string) *Histogram {
+	return hv.with(values).(*Histogram)
+}
+
+func (hv *HistogramVec) typ() string { return "histogram" }
+
+func (hv *HistogramVec) write(w io.Writer, name string) {
+	hv.each(func(values []string, c interface{}) {
+		c.(*Histogram).writeWithLabels(w, name, hv.labels, values)
+	})
+}
@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "请求数量", "code")
+	c.With("200").Add(3)
+	c.With(`a"b`).Inc()
+	h := NewHistogramVec("test_latency_seconds", "延迟", []float64{0.1, 1}, "phase")
+	h.With("prepare").Observe(0.05)
+	h.With("prepare").Observe(0.5)
+	NewGaugeFunc("test_height", "高度", func() float64 { return 42 })
+
+	var buf bytes.Buffer
+	Default.WritePrometheus(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{code="200"} 3`,
+		`test_requests_total{code="a\"b"} 1`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{phase="prepare",le="0.1"} 1`,
+		`test_latency_seconds_bucket{phase="prepare",le="1"} 2`,
+		`test_latency_seconds_bucket{phase="prepare",le="+Inf"} 2`,
+		`test_latency_seconds_sum{phase="prepare"} 0.55`,
+		`test_latency_seconds_count{phase="prepare"} 2`,
+		"# TYPE test_height gauge",
+		"test_height 42",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Fatalf("输出中没有 %s\n%s", line, out)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package consensus
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/labstack/echo"
 	"github.com/wupeaking/pbft_impl/model"
@@ -10,27 +11,75 @@ import (
 func (pbft *PBFT) StartAPI(g *echo.Group) {
 	g.GET("/", pbft.rootHandler)
 	g.GET("/status", pbft.statusHandler)
+	g.GET("/evidence", pbft.evidenceHandler)
+	g.GET("/events", pbft.eventsHandler)
 }
 
 func (pbft *PBFT) rootHandler(ctx echo.Context) error {
 	return ctx.Blob(200, "application/json", []byte(`
 	GET /consensus/status   当前共识状态
+	GET /consensus/evidence   发现的双签证据
+	GET /consensus/events   共识事件流(Server-Sent Events)
 	`))
 }
 
 func (pbft *PBFT) statusHandler(ctx echo.Context) error {
 	resp := struct {
-		Status    string `json:"consensus_status"`
-		IsVerfier bool   `json:"is_verfier"`
-		No        int    `json:"no"`
-		BlockNum  int64  `json:"block_num"`
-		View      int64  `json:"view"`
+		Status     string `json:"consensus_status"`
+		IsVerfier  bool   `json:"is_verfier"`
+		Observer   bool   `json:"observer"`
+		No         int    `json:"no"`
+		BlockNum   int64  `json:"block_num"`
+		View       int64  `json:"view"`
+		Checkpoint int64  `json:"stable_checkpoint"`
+		LowMark    int64  `json:"low_watermark"`
+		HighMark   int64  `json:"high_watermark"`
+		Leader     string `json:"leader_election"`
 	}{
-		Status:    model.States_name[int32(pbft.CurrentState())],
-		IsVerfier: pbft.ws.CurVerfier != nil,
-		No:        pbft.ws.VerifierNo,
-		BlockNum:  int64(pbft.ws.BlockNum),
-		View:      int64(pbft.ws.View),
+		Status:     model.States_name[int32(pbft.CurrentState())],
+		IsVerfier:  pbft.ws.CurVerfier != nil,
+		Observer:   pbft.observer,
+		No:         pbft.ws.VerifierNo,
+		BlockNum:   int64(pbft.ws.BlockNum),
+		View:       int64(pbft.ws.View),
+		Checkpoint: int64(pbft.mm.stableCheckpoint()),
+		Leader:     pbft.elector.Name(),
+	}
+	low, high := pbft.watermarks()
+	resp.LowMark, resp.HighMark = int64(low), int64(high)
+	respBody, _ := json.Marshal(resp)
+	return ctx.Blob(200, "application/json", respBody)
+}
+
+// evidenceHandler 返回本节点发现或收到的双签证据 first和second为两条签名消息 可以独立验证
+func (pbft *PBFT) evidenceHandler(ctx echo.Context) error {
+	type signedMsg struct {
+		BlockID string `json:"block_id"`
+		Sign    string `json:"sign"`
+	}
+	type evidence struct {
+		Hash     string    `json:"hash"`
+		Signer   string    `json:"signer"`
+		MsgType  string    `json:"msg_type"`
+		SeqNum   uint64    `json:"seq_num"`
+		View     uint64    `json:"view"`
+		First    signedMsg `json:"first"`
+		Second   signedMsg `json:"second"`
+		Included uint64    `json:"included_height"`
+	}
+	resp := make([]evidence, 0)
+	for _, e := range pbft.Equivocations() {
+		a, b := e.Evidence.First, e.Evidence.Second
+		resp = append(resp, evidence{
+			Hash:     fmt.Sprintf("0x%x", e.Hash),
+			Signer:   fmt.Sprintf("0x%x", a.SignerId),
+			MsgType:  a.MsgType.String(),
+			SeqNum:   a.SeqNum,
+			View:     a.View,
+			First:    signedMsg{BlockID: a.BlockId, Sign: fmt.Sprintf("0x%x", a.Sign)},
+			Second:   signedMsg{BlockID: b.BlockId, Sign: fmt.Sprintf("0x%x", b.Sign)},
+			Included: e.Height,
+		})
 	}
 	respBody, _ := json.Marshal(resp)
 	return ctx.Blob(200, "application/json", respBody)
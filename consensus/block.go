@@ -3,14 +3,18 @@ package consensus
 import (
 	"bytes"
 	"fmt"
-	"time"
 
+	"github.com/golang/protobuf/proto"
 	cryptogo "github.com/wupeaking/pbft_impl/crypto"
-	"github.com/wupeaking/pbft_impl/cvm"
 	"github.com/wupeaking/pbft_impl/model"
 )
 
 func (pbft *PBFT) packageBlock() (*model.PbftBlock, error) {
+	return pbft.packageBlockAt(pbft.ws.BlockNum+1, pbft.ws.BlockID)
+}
+
+// packageBlockAt 在指定高度打包区块 prev是前一个区块的ID 可能还未提交
+func (pbft *PBFT) packageBlockAt(seq uint64, prev string) (*model.PbftBlock, error) {
 	privKey, err := cryptogo.LoadPrivateKey(fmt.Sprintf("0x%x", pbft.ws.CurVerfier.PrivateKey))
 	if err != nil {
 		return nil, err
@@ -18,16 +22,16 @@ func (pbft *PBFT) packageBlock() (*model.PbftBlock, error) {
 
 	// 尝试打包一个新区块
 	blk := &model.PbftBlock{
-		PrevBlock:      pbft.ws.BlockID,
+		PrevBlock:      prev,
 		SignerId:       pbft.ws.CurVerfier.PublickKey,
-		BlockNum:       pbft.ws.BlockNum + 1,
-		TimeStamp:      uint64(time.Now().Unix()),
+		BlockNum:       seq,
+		TimeStamp:      uint64(pbft.clock.Now().Unix()),
 		View:           pbft.ws.View,
 		TxRoot:         nil,
 		TxReceiptsRoot: nil,
 	}
 	txs := make([]*model.Tx, 0)
-	max := 3000
+	max := pbft.policy.maxTxs
 	for {
 		ts := pbft.txPool.GetTx(max)
 		if len(ts) == 0 {
@@ -44,8 +48,14 @@ func (pbft *PBFT) packageBlock() (*model.PbftBlock, error) {
 	blk.Tansactions = &model.Txs{Tansactions: txs}
 	// todo:: 需要调用执行txs模块 生成blk.TransactionReceipts
 	blk.TransactionReceipts = &model.TxReceipts{TansactionReceipts: make([]*model.TxReceipt, 0)}
-	snap := cvm.NewSnapshot()
+	packed := make([]*model.Tx, 0, len(txs))
+	size := 0
+	snap := pbft.chainSnapshot(seq, prev)
 	for i := range blk.Tansactions.Tansactions {
+		// 已经打包在还未提交的祖先区块中 跳过即可 不能从交易池中移除
+		if snap.GetTxByID(fmt.Sprintf("%0x", blk.Tansactions.Tansactions[i].Sign)) != nil {
+			continue
+		}
 		txr, err := pbft.vm.Eval(blk.Tansactions.Tansactions[i], snap)
 		if err != nil {
 			pbft.logger.Warnf("当前交易预执行失败, 禁止打包此交易, 交易详情: %#v 错误原因: %s, txID: %s",
@@ -58,10 +68,18 @@ func (pbft *PBFT) packageBlock() (*model.PbftBlock, error) {
 		if err != nil {
 			return nil, err
 		}
+		// 超过区块大小上限的交易留在交易池中 下一个区块再打包
+		if size += elemSize(blk.Tansactions.Tansactions[i]) + elemSize(txr); size > pbft.policy.maxBytes {
+			break
+		}
 		blk.TransactionReceipts.TansactionReceipts = append(blk.TransactionReceipts.TansactionReceipts, txr)
+		packed = append(packed, blk.Tansactions.Tansactions[i])
 	}
+	blk.Tansactions.Tansactions = packed
 	blk.TxRoot = blk.Tansactions.MerkleRoot()
 	blk.TxReceiptsRoot = blk.TransactionReceipts.MerkleRoot()
+	blk.Evidences = pbft.evidenceForBlock(seq, prev)
+	blk.EvidenceRoot = model.EvidenceRoot(blk.Evidences)
 
 	return pbft.signBlock(blk)
 }
@@ -87,15 +105,39 @@ func (pbft *PBFT) CommitBlock(block *model.PbftBlock) error {
 
 	pbft.ws.IncreaseBlockNum()
 	pbft.ws.SetValue(block.BlockNum, pbft.ws.BlockID, block.BlockId, nil)
-	pbft.ws.InsertBlock(block)
-	// 更新视图
-	pbft.ws.View = block.View
+	pbft.recordLeaderFailures(block)
+	pbft.commitEvidences(block)
+	pbft.ws.InsertBlock(pbft.withSignerBitmap(block))
+	pbft.scheduleValidatorChanges(block)
+	pbft.switchValidators()
+	// 更新视图 重新提议的区块视图可能低于当前视图 视图不能回退
+	if block.View > pbft.ws.View {
+		pbft.ws.SetView(block.View)
+	}
 	pbft.ws.UpdateLastWorldState()
 	pbft.logger.Infof("提交一个新区块, 区块高度为: %d", block.GetBlockNum())
+	pbft.emit(&Event{Type: EventCommit, SeqNum: block.BlockNum, View: block.View, BlockID: block.BlockId,
+		Count: len(block.Tansactions.GetTansactions())})
+	pbft.observeCommit()
 	pbft.sm.receivedBlock = nil
+	pbft.sm.failedViews = 0
+	pbft.tryCheckpoint(block)
 	return nil
 }
 
+// withSignerBitmap 返回记录了签名位图的区块副本 位图按提交时的验证者集合生成 只包含签名正确的验证者
+// 原区块可能还在消息日志中被广播 不直接修改
+func (pbft *PBFT) withSignerBitmap(block *model.PbftBlock) *model.PbftBlock {
+	stored := proto.Clone(block).(*model.PbftBlock)
+	stored.SignerBitmap = nil
+	signers, err := stored.VerifiedSigners(pbft.ws.Verifiers, stored.HeaderHash())
+	if err != nil {
+		return block
+	}
+	stored.SignerBitmap = model.SignerBitmap(pbft.ws.Verifiers, signers)
+	return stored
+}
+
 // ApplyBlock 执行区块变更
 func (pbft *PBFT) ApplyBlock(block *model.PbftBlock) error {
 	// todo:: 还是需要涉及到交易回退问题 可能需要有交易快照功能
@@ -132,7 +174,7 @@ func (pbft *PBFT) TryApplyBlock(block *model.PbftBlock) error {
 		}
 		txs[string(block.Tansactions.Tansactions[i].Sign)] = struct{}{}
 	}
-	snap := cvm.NewSnapshot()
+	snap := pbft.chainSnapshot(block.BlockNum, block.PrevBlock)
 	for i, txr := range block.TransactionReceipts.TansactionReceipts {
 		if bytes.Compare(block.Tansactions.Tansactions[i].Sign, txr.TxId) != 0 {
 			return fmt.Errorf("交易收据与交易不能对应")
@@ -141,6 +183,7 @@ func (pbft *PBFT) TryApplyBlock(block *model.PbftBlock) error {
 			return fmt.Errorf("交易收据信息不合法")
 		}
 		// 模拟执行 需要涉及到整个区块交易的状态变更 但是又不能更新状态
+		// 流水线中的区块需要在还未提交的祖先区块执行之后的状态上模拟
 		txrRet, _ := pbft.vm.Eval(block.Tansactions.Tansactions[i], snap)
 		if txrRet.Status != txr.Status {
 			return fmt.Errorf("预执行交易不一致")
@@ -154,5 +197,11 @@ func (pbft *PBFT) TryApplyBlock(block *model.PbftBlock) error {
 	if bytes.Compare(block.TransactionReceipts.MerkleRoot(), block.TxReceiptsRoot) != 0 {
 		return fmt.Errorf("交易收据的默克尔树校验不一致")
 	}
+	if err := pbft.verifyBlockEvidences(block); err != nil {
+		return err
+	}
+	if err := pbft.checkBlockPolicy(block); err != nil {
+		return err
+	}
 	return nil
 }
@@ -2,24 +2,12 @@ package consensus
 
 import (
 	"bytes"
-	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/wupeaking/pbft_impl/model"
 	"github.com/wupeaking/pbft_impl/network"
 )
 
-// func (pbft *PBFT) LoadVerfierPeerIDs() error {
-// 	for _, v := range pbft.verifiers {
-// 		id, err := libp2p.PublicString2PeerID(cryptogo.Bytes2Hex(v.PublickKey))
-// 		if err != nil {
-// 			return err
-// 		}
-// 		pbft.verifierPeerID[id] = string(v.PublickKey)
-// 	}
-// 	return nil
-// }
-
 func (pbft *PBFT) AddBroadcastTask(msg *StateMsg) {
 	select {
 	case pbft.broadcastSig <- msg:
@@ -30,105 +18,77 @@ func (pbft *PBFT) AddBroadcastTask(msg *StateMsg) {
 
 // 定时广播 由于网路原因 可能会导致一些节点不能一次成功收到消息 多次进行广播
 func (pbft *PBFT) BroadcastMsgRoutine() {
-	t := time.NewTicker(4 * time.Second)
 	for {
 		select {
-		case <-t.C:
-			// 定时广播
-			if pbft.StopFlag {
-				continue
-			}
-			if pbft.CurrentState() != model.States_ViewChanging {
-				continue
-			}
-
-			if pbft.curBroadcastMsg == nil {
-				continue
-			}
+		case <-pbft.broadcastTicker.Chan():
+			pbft.onRebroadcast()
+		case msg := <-pbft.broadcastSig:
+			pbft.onBroadcastTask(msg)
+		}
+	}
+}
 
-			if pbft.curBroadcastMsg.ViewChangeMsg != nil {
-				pbft.broadcastStateMsg(model.NewPbftMessage(pbft.curBroadcastMsg.ViewChangeMsg))
-			}
+// onRebroadcast 定时广播 只有在viewchange状态才持续广播
+func (pbft *PBFT) onRebroadcast() {
+	if pbft.StopFlag {
+		return
+	}
+	if pbft.CurrentState() != model.States_ViewChanging {
+		return
+	}
 
-		case msg := <-pbft.broadcastSig:
-			//根据实际情况 判断是否需要广播
-			// 1. 如果是第一次广播此消息 则全部广播
-			if /*!pbft.CompareStateMsg(msg, pbft.curBroadcastMsg)*/ !msg.Broadcast {
-				var pbftMsg *model.PbftMessage
-				switch msg.MsgType {
-				case model.MessageType_ViewChange:
-					pbftMsg = model.NewPbftMessage(msg.ViewChangeMsg)
-				default:
-					pbftMsg = model.NewPbftMessage(msg.GenericMsg)
-				}
-				msg.Lock()
-				msg.Broadcast = true
-				msg.Unlock()
-				pbft.broadcastStateMsg(pbftMsg)
-				pbft.curBroadcastMsg = msg
-				continue
-			}
+	if pbft.curBroadcastMsg == nil {
+		return
+	}
 
-			// 已经不是第一次广播此消息
-			// 2. 当前类型消息 是否接收到其他节点发送过来 如果任意一个也没收到 则全网广播
-			// 3. 如果收到某些验证节点发送的 则只向没有收到的验证节点广播
-			// switch content := getPbftMsg(msg).(type) {
-			// case *model.PbftGenericMessage:
-			// 	msgInfo := content.GetInfo()
-			// 	signers := pbft.sm.logMsg.FindMsg(msgInfo.GetSeqNum(), msgInfo.GetMsgType(), int(msgInfo.GetView()))
-			// 	if len(signers) >= pbft.minNodeNum() {
-			// 		pbft.curBroadcastMsg = msg
-			// 		continue
-			// 	}
-			// 	peers, _ := pbft.switcher.Peers()
-			// 	for _, p := range peers {
-			// 		if sig, ok := pbft.verifierPeerID[p.ID]; ok {
-			// 			// 说明这个节点是验证节点
-			// 			// 如果接收到了这个节点发送的消息 那么认为这个节点也收到了本节点发送的消息 就不再往此节点发送消息
-			// 			if _, ok := signers[sig]; ok {
-			// 				continue
-			// 			}
-			// 		}
-			// 		pbft.broadcastStateMsgToPeer(msg, p)
-			// 	}
-			// 	pbft.curBroadcastMsg = msg
+	// viewchange消息只重传给还没有发出viewchange的验证者
+	if vc := pbft.curBroadcastMsg.ViewChangeMsg; vc != nil {
+		pbft.retransmit(model.NewPbftMessage(vc), vc.Info)
+	}
+	if pbft.curBroadcastMsg.NewViewMsg != nil {
+		pbft.broadcastStateMsg(model.NewPbftMessage(pbft.curBroadcastMsg.NewViewMsg))
+	}
+}
 
-			// case *model.PbftViewChange:
-			// 	msgInfo := content.GetInfo()
-			// 	signers := pbft.sm.logMsg.FindMsg(msgInfo.GetSeqNum(), msgInfo.GetMsgType(), int(msgInfo.GetView()))
-			// 	if len(signers) >= pbft.minNodeNum() {
-			// 		pbft.curBroadcastMsg = msg
-			// 		continue
-			// 	}
-			// 	peers, _ := pbft.switcher.Peers()
-			// 	for _, p := range peers {
-			// 		if sig, ok := pbft.verifierPeerID[p.ID]; ok {
-			// 			// 说明这个节点是验证节点
-			// 			// 如果接收到了这个节点发送的消息 那么认为这个节点也收到了本节点发送的消息 就不再往此节点发送消息
-			// 			if _, ok := signers[sig]; ok {
-			// 				continue
-			// 			}
-			// 		}
-			// 		pbft.broadcastStateMsgToPeer(msg, p)
-			// 	}
-			// 	pbft.curBroadcastMsg = msg
-			// }
-		}
+func (pbft *PBFT) onBroadcastTask(msg *StateMsg) {
+	//根据实际情况 判断是否需要广播
+	var pbftMsg *model.PbftMessage
+	var info *model.PbftMessageInfo
+	switch msg.MsgType {
+	case model.MessageType_ViewChange:
+		pbftMsg, info = model.NewPbftMessage(msg.ViewChangeMsg), msg.ViewChangeMsg.Info
+	case model.MessageType_NewView:
+		pbftMsg, info = model.NewPbftMessage(msg.NewViewMsg), msg.NewViewMsg.Info
+	default:
+		pbftMsg, info = model.NewPbftMessage(msg.GenericMsg), msg.GenericMsg.Info
+	}
+	// 1. 如果是第一次广播此消息 则发送给所有验证者
+	if /*!pbft.CompareStateMsg(msg, pbft.curBroadcastMsg)*/ !msg.Broadcast {
+		msg.Lock()
+		msg.Broadcast = true
+		msg.Unlock()
+		pbft.broadcastStateMsg(pbftMsg)
+		pbft.curBroadcastMsg = msg
+		return
 	}
+
+	// 已经不是第一次广播此消息 只向还没有收到其同类型消息的验证者重传
+	pbft.retransmit(pbftMsg, info)
 }
 
 func (pbft *PBFT) broadcastStateMsg(msg *model.PbftMessage) error {
-	body, err := proto.Marshal(msg)
-	if err != nil {
-		return err
+	if pbft.fault != nil {
+		return pbft.faultBroadcast(msg)
 	}
-	msgPkg := network.BroadcastMsg{
-		ModelID: "consensus",
-		MsgType: model.BroadcastMsgType_send_pbft_msg,
-		Msg:     body,
+	return pbft.sendStateMsg(msg, nil)
+}
+
+// sendStateMsg 发送消息 peer为nil时发送给所有验证者
+func (pbft *PBFT) sendStateMsg(msg *model.PbftMessage, peer *network.Peer) error {
+	if peer != nil {
+		return pbft.broadcastStateMsgToPeer(msg, peer)
 	}
-	// pbft.logger.Debugf("向所有节点广播消息")
-	return pbft.switcher.Broadcast("consensus", &msgPkg)
+	return pbft.sendToVerifiers(msg, nil)
 }
 
 func (pbft *PBFT) broadcastStateMsgToPeer(msg *model.PbftMessage, peer *network.Peer) error {
@@ -176,6 +136,16 @@ func (pbft *PBFT) compareMsg(msgA *model.PbftMessage, msgB *model.PbftMessage) b
 			return true
 		}
 		// pbft.logger.Debugf("ma :%v mb: %v", ma, mb)
+	case *model.PbftNewView:
+		mb, ok := mB.(*model.PbftNewView)
+		if !ok {
+			return false
+		}
+		if ma.GetInfo().GetSeqNum() == mb.GetInfo().GetSeqNum() &&
+			ma.GetInfo().GetView() == mb.GetInfo().GetView() &&
+			bytes.Compare(ma.GetInfo().GetSignerId(), mb.GetInfo().GetSignerId()) == 0 {
+			return true
+		}
 	}
 
 	return false
@@ -188,5 +158,8 @@ func getPbftMsg(msg *model.PbftMessage) interface{} {
 	if m := msg.GetViewChange(); m != nil {
 		return m
 	}
+	if m := msg.GetNewView(); m != nil {
+		return m
+	}
 	return nil
 }
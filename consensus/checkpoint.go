@@ -0,0 +1,185 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	checkpoint:
+	每提交K个区块 验证者对已提交的区块ID签名并广播checkpoint消息
+	收到2f+1个相同(seq, block_id)的checkpoint消息后 该checkpoint成为稳定checkpoint
+	稳定checkpoint及以下的消息日志全部清除
+*/
+
+// 默认每10个区块生成一次checkpoint
+const defaultCheckpointInterval = 10
+
+// 最多接收当前高度之后几个checkpoint高度的消息
+const checkpointAhead = 2
+
+func (pbft *PBFT) checkpointInterval() uint64 {
+	if pbft.cfg.ConsensusCfg.CheckpointInterval <= 0 {
+		return defaultCheckpointInterval
+	}
+	return uint64(pbft.cfg.ConsensusCfg.CheckpointInterval)
+}
+
+// acceptableCheckpoint 只接收checkpoint高度的消息 并且不超过当前高度之后checkpointAhead个间隔
+// 其他节点可能已经先提交了区块 所以要接收比本地更高的checkpoint 但不能无限制地接收
+func (pbft *PBFT) acceptableCheckpoint(seq uint64) bool {
+	k := pbft.checkpointInterval()
+	return seq%k == 0 && seq <= pbft.ws.BlockNum+k*checkpointAhead
+}
+
+// StableCheckpoint 稳定checkpoint的高度和区块ID
+func (pbft *PBFT) StableCheckpoint() (uint64, string) {
+	pbft.mm.CheckpointLock.RLock()
+	defer pbft.mm.CheckpointLock.RUnlock()
+	return pbft.mm.StableCheckpoint, pbft.mm.StableCheckpointID
+}
+
+// stableCheckpointProof 返回稳定checkpoint的2f+1个checkpoint消息
+func (mm *MsgManager) stableCheckpointProof() []*model.PbftGenericMessage {
+	mm.CheckpointLock.RLock()
+	defer mm.CheckpointLock.RUnlock()
+	proof := make([]*model.PbftGenericMessage, 0)
+	for _, m := range mm.Checkpoints[mm.StableCheckpoint] {
+		if m.GenericMsg.Info.BlockId == mm.StableCheckpointID {
+			proof = append(proof, m.GenericMsg)
+		}
+	}
+	return proof
+}
+
+func (mm *MsgManager) stableCheckpoint() uint64 {
+	mm.CheckpointLock.RLock()
+	defer mm.CheckpointLock.RUnlock()
+	return mm.StableCheckpoint
+}
+
+// addCheckpoint 追加checkpoint消息 同一个签名者在同一高度只保留一条
+func (mm *MsgManager) addCheckpoint(blkNum uint64, signer []byte, msg *model.PbftMessage, gm *model.PbftGenericMessage) bool {
+	mm.CheckpointLock.Lock()
+	defer mm.CheckpointLock.Unlock()
+	if blkNum <= mm.StableCheckpoint {
+		return false
+	}
+	msgs := mm.Checkpoints[blkNum]
+	for i := range msgs {
+		if bytes.Compare(msgs[i].Signer, signer) == 0 {
+			return false
+		}
+	}
+	mm.Checkpoints[blkNum] = append(msgs, &StateMsg{
+		MsgType:    model.MessageType_Checkpoint,
+		Msg:        msg,
+		GenericMsg: gm,
+		Signer:     signer,
+	})
+	return true
+}
+
+// findCheckpoint 查找某个高度下 对blockID签名的checkpoint消息
+func (mm *MsgManager) findCheckpoint(blkNum uint64, blockID string) []*StateMsg {
+	mm.CheckpointLock.RLock()
+	defer mm.CheckpointLock.RUnlock()
+	rets := make([]*StateMsg, 0)
+	for _, m := range mm.Checkpoints[blkNum] {
+		if m.GenericMsg.Info.BlockId == blockID {
+			rets = append(rets, m)
+		}
+	}
+	return rets
+}
+
+// truncate 设置稳定checkpoint 并清除checkpoint及以下的所有日志
+// 加锁顺序和addMsg/addBlock保持一致 StateMsg -> BlockMsg -> BlockView
+func (mm *MsgManager) truncate(stable uint64, blockID string) {
+	mm.CheckpointLock.Lock()
+	if stable <= mm.StableCheckpoint {
+		mm.CheckpointLock.Unlock()
+		return
+	}
+	mm.StableCheckpoint = stable
+	mm.StableCheckpointID = blockID
+	for num := range mm.Checkpoints {
+		// 保留稳定checkpoint本身的证明 用于viewchange
+		if num < stable {
+			delete(mm.Checkpoints, num)
+		}
+	}
+	mm.CheckpointLock.Unlock()
+
+	mm.StateMsgLock.Lock()
+	defer mm.StateMsgLock.Unlock()
+	mm.BlockMsgLock.Lock()
+	defer mm.BlockMsgLock.Unlock()
+	mm.BlockViewLock.Lock()
+	defer mm.BlockViewLock.Unlock()
+	for num, views := range mm.BlockView {
+		if num > stable {
+			continue
+		}
+		for view := range views {
+			k := fmt.Sprintf("%d-%d", num, view)
+			delete(mm.StateMsgs, k)
+			delete(mm.BlockMsg, k)
+		}
+		delete(mm.BlockView, num)
+	}
+}
+
+// tryCheckpoint 提交区块之后 如果到达checkpoint高度 则广播checkpoint消息
+func (pbft *PBFT) tryCheckpoint(block *model.PbftBlock) {
+	if block.BlockNum == 0 || block.BlockNum%pbft.checkpointInterval() != 0 {
+		return
+	}
+	// 提交之前收到的checkpoint消息可能已经达到2f+1
+	defer pbft.processCheckpoint(block.BlockNum, block.BlockId)
+	if pbft.ws.CurVerfier == nil || !pbft.IsVaildVerifier(pbft.ws.CurVerfier.PublickKey) {
+		return
+	}
+	newMsg := model.PbftGenericMessage{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_Checkpoint,
+			View: block.View, SeqNum: block.BlockNum,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+			BlockId:  block.BlockId,
+		},
+	}
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
+	if err != nil {
+		pbft.logger.Warnf("生成checkpoint消息时 签名发生错误 err: %v", err)
+		return
+	}
+	pbft.AppendMsg(signedMsg)
+	pbft.broadcastStateMsg(signedMsg)
+}
+
+// processCheckpoint 收到足够多的相同checkpoint 则将其设置为稳定checkpoint
+// 本地还没有提交到此高度时不处理 高度以上的日志还需要用来提交区块 等提交之后由tryCheckpoint再次检查
+func (pbft *PBFT) processCheckpoint(seq uint64, blockID string) {
+	if seq <= pbft.mm.stableCheckpoint() || seq > pbft.ws.BlockNum {
+		return
+	}
+	msgs := pbft.mm.findCheckpoint(seq, blockID)
+	if !pbft.hasQuorum(msgSigners(msgs)) {
+		return
+	}
+	// 校验和本地已经提交的区块是否一致
+	blk, err := pbft.ws.GetBlock(seq)
+	if err == nil && blk != nil && blk.BlockId != blockID {
+		pbft.logger.Errorf("稳定checkpoint与本地区块不一致 高度: %d, checkpoint: %s, 本地: %s",
+			seq, blockID, blk.BlockId)
+		return
+	}
+	pbft.mm.truncate(seq, blockID)
+	if pbft.wal != nil {
+		if err := pbft.wal.truncate(seq); err != nil {
+			pbft.logger.Warnf("清除共识预写日志失败 err: %v", err)
+		}
+	}
+	pbft.logger.Infof("checkpoint已稳定, 高度: %d, 区块ID: %s", seq, blockID)
+}
@@ -0,0 +1,46 @@
+package consensus
+
+import "time"
+
+// Clock 共识模块使用的时钟 默认使用系统时钟 测试时可以替换为虚拟时钟
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+type Timer interface {
+	Chan() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type Ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return &realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return &realTicker{time.NewTicker(d)} }
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t *realTimer) Chan() <-chan time.Time { return t.C }
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t *realTicker) Chan() <-chan time.Time { return t.C }
+
+// SetClock 替换共识模块的时钟 需要在Daemon或Step之前调用
+func (pbft *PBFT) SetClock(c Clock) {
+	pbft.clock = c
+}
@@ -0,0 +1,229 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	equivocation: 双签证据
+	同一个签名者在同一高度和视图下对不同区块签名 两条签名消息组成证据
+	发现证据后写入预写日志并广播给其他节点 主节点打包区块时把还未上链的证据放入区块
+*/
+
+const (
+	// 最多保留的双签记录数量
+	maxEquivocations = 1000
+	// 证据的有效期 超过这么多个区块之后不能再上链
+	evidenceMaxAge = 100
+	// 每个区块最多包含的证据数量
+	maxEvidencePerBlock = 10
+)
+
+// Equivocation 本节点发现或收到的双签证据
+type Equivocation struct {
+	Evidence *model.EquivocationEvidence
+	Hash     []byte
+	// 包含此证据的区块高度 还未上链时为0
+	Height uint64
+}
+
+// checkEquivocation 检查签名者是否已经对同一高度和视图下的其他区块投过票
+func (mm *MsgManager) checkEquivocation(info *model.PbftMessageInfo) *model.EquivocationEvidence {
+	if info.BlockId == "" {
+		return nil
+	}
+	mm.StateMsgLock.RLock()
+	defer mm.StateMsgLock.RUnlock()
+	msgs := mm.StateMsgs[fmt.Sprintf("%d-%d", info.SeqNum, info.View)]
+	for i := range msgs {
+		if msgs[i].MsgType != info.MsgType || msgs[i].GenericMsg == nil ||
+			bytes.Compare(msgs[i].Signer, info.SignerId) != 0 {
+			continue
+		}
+		first := msgs[i].GenericMsg.Info
+		if first.BlockId != "" && first.BlockId != info.BlockId {
+			return model.NewEquivocationEvidence(first, info)
+		}
+	}
+	return nil
+}
+
+func (mm *MsgManager) findEquivocation(hash []byte) *Equivocation {
+	mm.EquivocationLock.RLock()
+	defer mm.EquivocationLock.RUnlock()
+	for _, e := range mm.Equivocations {
+		if bytes.Equal(e.Hash, hash) {
+			return e
+		}
+	}
+	return nil
+}
+
+// addEquivocation 记录双签证据 超过最大数量时返回被淘汰的最早记录
+func (mm *MsgManager) addEquivocation(e *Equivocation) *Equivocation {
+	mm.EquivocationLock.Lock()
+	defer mm.EquivocationLock.Unlock()
+	var evicted *Equivocation
+	if len(mm.Equivocations) >= maxEquivocations {
+		evicted = mm.Equivocations[0]
+		mm.Equivocations = mm.Equivocations[1:]
+	}
+	mm.Equivocations = append(mm.Equivocations, e)
+	return evicted
+}
+
+// Equivocations 返回已经发现的双签记录
+func (pbft *PBFT) Equivocations() []*Equivocation {
+	pbft.mm.EquivocationLock.RLock()
+	defer pbft.mm.EquivocationLock.RUnlock()
+	rets := make([]*Equivocation, len(pbft.mm.Equivocations))
+	copy(rets, pbft.mm.Equivocations)
+	return rets
+}
+
+// verifyEvidence 验证双签证据 两条消息必须由同一个验证者对同一位置的不同区块签名
+func (pbft *PBFT) verifyEvidence(ev *model.EquivocationEvidence) error {
+	a, b := ev.GetFirst(), ev.GetSecond()
+	if a == nil || b == nil {
+		return fmt.Errorf("证据不完整")
+	}
+	if bytes.Compare(a.SignerId, b.SignerId) != 0 {
+		return fmt.Errorf("证据中的两条消息不是同一个签名者")
+	}
+	if a.MsgType != b.MsgType || a.SeqNum != b.SeqNum || a.View != b.View {
+		return fmt.Errorf("证据中的两条消息不在同一位置")
+	}
+	if a.BlockId == "" || b.BlockId == "" || a.BlockId == b.BlockId {
+		return fmt.Errorf("证据中的两条消息没有冲突")
+	}
+	// 同一对消息只有一种合法的顺序 避免同一个证据以不同的哈希重复上链
+	if a.BlockId > b.BlockId {
+		return fmt.Errorf("证据中的消息没有按区块ID排序")
+	}
+	if !pbft.verfifyMsgInfo(a) || !pbft.verfifyMsgInfo(b) {
+		return fmt.Errorf("证据中的消息签名验证失败")
+	}
+	return nil
+}
+
+// addEvidence 记录证据并写入预写日志 height为包含证据的区块高度 新证据返回true
+func (pbft *PBFT) addEvidence(ev *model.EquivocationEvidence, height uint64) bool {
+	hash := ev.Hash()
+	if e := pbft.mm.findEquivocation(hash); e != nil {
+		if height != 0 && e.Height == 0 {
+			pbft.mm.EquivocationLock.Lock()
+			e.Height = height
+			pbft.mm.EquivocationLock.Unlock()
+			pbft.walWriteEvidence(e)
+		}
+		return false
+	}
+	e := &Equivocation{Evidence: ev, Hash: hash, Height: height}
+	if evicted := pbft.mm.addEquivocation(e); evicted != nil && pbft.wal != nil {
+		pbft.wal.deleteEvidence(evicted.Hash)
+	}
+	pbft.walWriteEvidence(e)
+	return true
+}
+
+// reportEquivocation 本节点发现双签行为 记录证据并广播给其他节点
+func (pbft *PBFT) reportEquivocation(ev *model.EquivocationEvidence) {
+	pbft.logger.Warnf("发现双签行为 签名者: %x, 高度: %d, 视图: %d, 消息类型: %s, 区块: %s <-> %s",
+		ev.First.SignerId, ev.First.SeqNum, ev.First.View, ev.First.MsgType, ev.First.BlockId, ev.Second.BlockId)
+	if pbft.addEvidence(ev, 0) {
+		pbft.sendStateMsg(model.NewPbftMessage(ev), nil)
+	}
+}
+
+// onEvidence 收到其他节点广播的证据 验证通过后记录 第一次收到时继续广播
+func (pbft *PBFT) onEvidence(ev *model.EquivocationEvidence) {
+	if err := pbft.verifyEvidence(ev); err != nil {
+		pbft.logger.Debugf("收到的双签证据不合法 err: %v", err)
+		return
+	}
+	if pbft.addEvidence(ev, 0) {
+		pbft.logger.Infof("收到双签证据 签名者: %x, 高度: %d, 视图: %d",
+			ev.First.SignerId, ev.First.SeqNum, ev.First.View)
+		pbft.sendStateMsg(model.NewPbftMessage(ev), nil)
+	}
+}
+
+// evidenceInRange 证据是否可以放入指定高度的区块
+func evidenceInRange(ev *model.EquivocationEvidence, blockNum uint64) bool {
+	return ev.First.SeqNum < blockNum && ev.First.SeqNum+evidenceMaxAge >= blockNum
+}
+
+// ancestorEvidences 还未提交的祖先区块中已经包含的证据
+func (pbft *PBFT) ancestorEvidences(seq uint64, prev string) map[string]struct{} {
+	included := make(map[string]struct{})
+	for _, blk := range pbft.pendingAncestors(seq, prev) {
+		for _, ev := range blk.Evidences {
+			included[string(ev.Hash())] = struct{}{}
+		}
+	}
+	return included
+}
+
+// evidenceForBlock 选出可以放入seq高度区块的证据
+func (pbft *PBFT) evidenceForBlock(seq uint64, prev string) []*model.EquivocationEvidence {
+	included := pbft.ancestorEvidences(seq, prev)
+	evs := make([]*model.EquivocationEvidence, 0)
+	for _, e := range pbft.Equivocations() {
+		if len(evs) >= maxEvidencePerBlock {
+			break
+		}
+		if e.Height != 0 || !evidenceInRange(e.Evidence, seq) || pbft.ws.EvidenceIncluded(e.Hash) {
+			continue
+		}
+		if _, ok := included[string(e.Hash)]; ok {
+			continue
+		}
+		// 证据上的签名者可能已经不是验证者了
+		if pbft.verifyEvidence(e.Evidence) != nil {
+			continue
+		}
+		evs = append(evs, e.Evidence)
+	}
+	return evs
+}
+
+// verifyBlockEvidences 校验区块中的证据 必须合法 未过期 且没有在之前的区块中出现过
+func (pbft *PBFT) verifyBlockEvidences(block *model.PbftBlock) error {
+	if len(block.Evidences) > maxEvidencePerBlock {
+		return fmt.Errorf("区块包含的双签证据过多")
+	}
+	if bytes.Compare(model.EvidenceRoot(block.Evidences), block.EvidenceRoot) != 0 {
+		return fmt.Errorf("双签证据的默克尔树校验不一致")
+	}
+	if len(block.Evidences) == 0 {
+		return nil
+	}
+	included := pbft.ancestorEvidences(block.BlockNum, block.PrevBlock)
+	for _, ev := range block.Evidences {
+		if err := pbft.verifyEvidence(ev); err != nil {
+			return err
+		}
+		if !evidenceInRange(ev, block.BlockNum) {
+			return fmt.Errorf("双签证据已过期")
+		}
+		hash := ev.Hash()
+		if _, ok := included[string(hash)]; ok || pbft.ws.EvidenceIncluded(hash) {
+			return fmt.Errorf("包含重复的双签证据")
+		}
+		included[string(hash)] = struct{}{}
+	}
+	return nil
+}
+
+// commitEvidences 提交区块时记录其中的证据
+func (pbft *PBFT) commitEvidences(block *model.PbftBlock) {
+	hashes := make([][]byte, 0, len(block.Evidences))
+	for _, ev := range block.Evidences {
+		hashes = append(hashes, ev.Hash())
+		pbft.addEvidence(ev, block.BlockNum)
+	}
+	pbft.ws.RecordEvidences(block.BlockNum, hashes, evidenceMaxAge)
+}
@@ -0,0 +1,131 @@
+package consensus
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/labstack/echo"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	events: 共识事件流
+	状态迁移 接收的消息 法定数量达成 视图切换和区块提交都会发布事件
+	通过 GET /consensus/events 以Server-Sent Events的形式推送给订阅者
+*/
+
+const (
+	EventState      = "state"       // 状态迁移
+	EventMessage    = "message"     // 消息被追加到消息日志
+	EventQuorum     = "quorum"      // 收集到法定数量的投票
+	EventViewChange = "view_change" // 发起视图切换或进入新视图
+	EventCommit     = "commit"      // 提交区块
+)
+
+// 每个订阅者最多缓存的事件数量 订阅者处理不过来时丢弃新事件 不能阻塞共识
+const eventBufferSize = 256
+
+// Event 共识事件
+type Event struct {
+	Type string `json:"type"`
+	// 事件发生的时间 unix毫秒
+	Time    int64  `json:"time"`
+	SeqNum  uint64 `json:"seq_num"`
+	View    uint64 `json:"view"`
+	From    string `json:"from,omitempty"`
+	State   string `json:"state,omitempty"`
+	MsgType string `json:"msg_type,omitempty"`
+	Signer  string `json:"signer,omitempty"`
+	BlockID string `json:"block_id,omitempty"`
+	Count   int    `json:"count,omitempty"`
+}
+
+type eventBus struct {
+	sync.Mutex
+	subs map[int]chan *Event
+	next int
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[int]chan *Event)}
+}
+
+func (eb *eventBus) subscribe() (int, <-chan *Event) {
+	eb.Lock()
+	defer eb.Unlock()
+	eb.next++
+	ch := make(chan *Event, eventBufferSize)
+	eb.subs[eb.next] = ch
+	return eb.next, ch
+}
+
+func (eb *eventBus) unsubscribe(id int) {
+	eb.Lock()
+	defer eb.Unlock()
+	delete(eb.subs, id)
+}
+
+func (eb *eventBus) publish(e *Event) {
+	eb.Lock()
+	defer eb.Unlock()
+	for _, ch := range eb.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe 订阅共识事件 返回的函数用于取消订阅
+func (pbft *PBFT) Subscribe() (<-chan *Event, func()) {
+	id, ch := pbft.events.subscribe()
+	return ch, func() { pbft.events.unsubscribe(id) }
+}
+
+func (pbft *PBFT) emit(e *Event) {
+	e.Time = pbft.clock.Now().UnixNano() / 1e6
+	pbft.events.publish(e)
+}
+
+func (pbft *PBFT) emitState(from, to model.States) {
+	pbft.emit(&Event{Type: EventState, SeqNum: pbft.ws.BlockNum + 1, View: pbft.ws.View,
+		From: from.String(), State: to.String()})
+}
+
+func (pbft *PBFT) emitMessage(info *model.PbftMessageInfo) {
+	pbft.emit(&Event{Type: EventMessage, SeqNum: info.SeqNum, View: info.View,
+		MsgType: info.MsgType.String(), Signer: fmt.Sprintf("0x%x", info.SignerId), BlockID: info.BlockId})
+}
+
+func (pbft *PBFT) emitQuorum(seq, view uint64, msgType model.MessageType, blockID string, count int) {
+	pbft.emit(&Event{Type: EventQuorum, SeqNum: seq, View: view,
+		MsgType: msgType.String(), BlockID: blockID, Count: count})
+}
+
+// eventsHandler 以Server-Sent Events推送共识事件 连接断开时取消订阅
+func (pbft *PBFT) eventsHandler(ctx echo.Context) error {
+	ch, cancel := pbft.Subscribe()
+	defer cancel()
+
+	w := ctx.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+	w.Flush()
+
+	done := ctx.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return nil
+		case e := <-ch:
+			body, _ := json.Marshal(e)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, body); err != nil {
+				return nil
+			}
+			w.Flush()
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package consensus
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+/*
+	fault: 故障注入 只能在测试网络中开启
+	所有的故障都作用在本节点发出的共识消息上 本地的状态迁移保持正常
+*/
+
+// 最多保留多少条发出过的消息用于重放
+const maxReplayMsgs = 64
+
+type faultInjector struct {
+	cfg     *config.FaultCfg
+	rand    *rand.Rand
+	sent    []*model.PbftMessage
+	delayed []*delayedMsg
+	timer   Timer
+}
+
+type delayedMsg struct {
+	at   time.Time
+	msg  *model.PbftMessage
+	peer *network.Peer
+}
+
+func newFaultInjector(cfg *config.FaultCfg) *faultInjector {
+	return &faultInjector{
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// faultTimerChan 延迟消息的定时器 没有开启故障注入时返回nil 永远不会就绪
+func (pbft *PBFT) faultTimerChan() <-chan time.Time {
+	if pbft.fault == nil || pbft.fault.timer == nil {
+		return nil
+	}
+	return pbft.fault.timer.Chan()
+}
+
+// faultBroadcast 按故障注入的配置发出消息
+func (pbft *PBFT) faultBroadcast(msg *model.PbftMessage) error {
+	f := pbft.fault
+	info := msgInfoOf(msg)
+	if info == nil {
+		return nil
+	}
+	if f.cfg.WithholdVotes && (info.MsgType == model.MessageType_Prepare || info.MsgType == model.MessageType_Commit) {
+		return nil
+	}
+	if f.cfg.EquivocatePrimary && info.MsgType == model.MessageType_PrePrepare && msg.GetGeneric().Block != nil {
+		pbft.equivocate(msg)
+		return nil
+	}
+	if f.cfg.CorruptSign {
+		msg = proto.Clone(msg).(*model.PbftMessage)
+		if corrupt := msgInfoOf(msg); len(corrupt.Sign) > 0 {
+			corrupt.Sign[0] ^= 0xff
+		}
+	}
+	pbft.faultDeliver(msg, nil)
+
+	if f.cfg.ReplayStale {
+		stale := make([]*model.PbftMessage, 0)
+		for _, m := range f.sent {
+			if old := msgInfoOf(m); old.SeqNum < info.SeqNum || old.View < info.View {
+				stale = append(stale, m)
+			}
+		}
+		if len(stale) > 0 {
+			pbft.faultDeliver(stale[f.rand.Intn(len(stale))], nil)
+		}
+	}
+	if len(f.sent) >= maxReplayMsgs {
+		f.sent = f.sent[1:]
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// equivocate 主节点向一半节点发送原区块 向另一半节点发送一个冲突的区块
+func (pbft *PBFT) equivocate(msg *model.PbftMessage) {
+	gm := msg.GetGeneric()
+	alt := proto.Clone(gm.Block).(*model.PbftBlock)
+	alt.TimeStamp++
+	alt.BlockId, alt.SignerId, alt.Sign, alt.SignPairs = "", nil, nil, nil
+	alt, err := pbft.signBlock(alt)
+	if err != nil {
+		pbft.logger.Warnf("故障注入 生成冲突区块失败 err: %v", err)
+		return
+	}
+	// 冲突区块的签名需要绕过预写日志的双签检查
+	info, err := pbft.rawSignMsgInfo(&model.PbftMessageInfo{MsgType: gm.Info.MsgType,
+		View: gm.Info.View, SeqNum: gm.Info.SeqNum,
+		SignerId: pbft.ws.CurVerfier.PublickKey,
+		BlockId:  alt.BlockId,
+	})
+	if err != nil {
+		pbft.logger.Warnf("故障注入 冲突区块签名失败 err: %v", err)
+		return
+	}
+	altMsg := model.NewPbftMessage(&model.PbftGenericMessage{Info: info, Block: alt})
+
+	peers, _ := pbft.switcher.Peers()
+	for i, p := range peers {
+		if i%2 == 0 {
+			pbft.faultDeliver(msg, p)
+		} else {
+			pbft.faultDeliver(altMsg, p)
+		}
+	}
+}
+
+// faultDeliver 按配置丢弃或者延迟消息 peer为nil时广播
+func (pbft *PBFT) faultDeliver(msg *model.PbftMessage, peer *network.Peer) {
+	f := pbft.fault
+	if f.cfg.DropRate > 0 && f.rand.Float64() < f.cfg.DropRate {
+		return
+	}
+	if f.cfg.MaxDelay > 0 {
+		if d := time.Duration(f.rand.Intn(f.cfg.MaxDelay+1)) * time.Millisecond; d > 0 {
+			f.delayed = append(f.delayed, &delayedMsg{at: pbft.clock.Now().Add(d), msg: msg, peer: peer})
+			pbft.scheduleDelayed()
+			return
+		}
+	}
+	pbft.sendStateMsg(msg, peer)
+}
+
+// onFaultTimer 发送已经到期的延迟消息
+func (pbft *PBFT) onFaultTimer() {
+	f := pbft.fault
+	now := pbft.clock.Now()
+	remain := make([]*delayedMsg, 0, len(f.delayed))
+	for _, d := range f.delayed {
+		if d.at.After(now) {
+			remain = append(remain, d)
+			continue
+		}
+		pbft.sendStateMsg(d.msg, d.peer)
+	}
+	f.delayed = remain
+	pbft.scheduleDelayed()
+}
+
+func (pbft *PBFT) scheduleDelayed() {
+	f := pbft.fault
+	if len(f.delayed) == 0 || f.timer == nil {
+		return
+	}
+	next := f.delayed[0].at
+	for _, d := range f.delayed {
+		if d.at.Before(next) {
+			next = d.at
+		}
+	}
+	resetTimer(f.timer, next.Sub(pbft.clock.Now()))
+}
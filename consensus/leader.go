@@ -0,0 +1,148 @@
+package consensus
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+)
+
+/*
+	leader: 主节点选择策略
+	所有节点必须配置相同的策略 选择结果只依赖高度 视图和链上的数据 保证每个节点计算结果一致
+	round_robin  按高度和视图轮流
+	weighted     按验证者的权重选出每个高度的第一个主节点 视图切换时依次轮换
+	reputation   跳过最近几个区块内超时过的主节点 其余节点轮流
+*/
+
+const (
+	LeaderRoundRobin = "round_robin"
+	LeaderWeighted   = "weighted"
+	LeaderReputation = "reputation"
+)
+
+const defaultReputationWindow = 10
+
+// LeaderElector 主节点选择策略
+type LeaderElector interface {
+	Name() string
+	// Leader 返回指定高度和视图下主节点在verifiers中的下标 verifiers不能为空
+	Leader(seq, view uint64, verifiers []*model.Verifier) int
+}
+
+// NewLeaderElector 根据配置创建主节点选择策略
+// lag为流水线中可能还未提交的高度数量 信誉只参考lag之前已经提交的区块 保证处于不同高度的节点选出相同的主节点
+func NewLeaderElector(name string, ws *world_state.WroldState, window int, lag uint64) (LeaderElector, error) {
+	if window <= 0 {
+		window = defaultReputationWindow
+	}
+	switch strings.ToLower(name) {
+	case "", LeaderRoundRobin:
+		return roundRobinElector{}, nil
+	case LeaderWeighted:
+		return weightedElector{}, nil
+	case LeaderReputation:
+		return &reputationElector{ws: ws, window: uint64(window), lag: lag}, nil
+	}
+	return nil, fmt.Errorf("未知的主节点选择策略: %s", name)
+}
+
+type roundRobinElector struct{}
+
+func (roundRobinElector) Name() string { return LeaderRoundRobin }
+
+func (roundRobinElector) Leader(seq, view uint64, verifiers []*model.Verifier) int {
+	return int((seq + view) % uint64(len(verifiers)))
+}
+
+type weightedElector struct{}
+
+func (weightedElector) Name() string { return LeaderWeighted }
+
+func (weightedElector) Leader(seq, view uint64, verifiers []*model.Verifier) int {
+	total := uint64(0)
+	for _, v := range verifiers {
+		total += v.Power()
+	}
+	// 用高度的哈希值在权重区间上选点 权重越大被选中的概率越大
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seq)
+	sum := sha256.Sum256(buf[:])
+	point := binary.BigEndian.Uint64(sum[:8]) % total
+	base := 0
+	for i, v := range verifiers {
+		if point < v.Power() {
+			base = i
+			break
+		}
+		point -= v.Power()
+	}
+	return int((uint64(base) + view) % uint64(len(verifiers)))
+}
+
+type reputationElector struct {
+	ws     *world_state.WroldState
+	window uint64
+	lag    uint64
+}
+
+func (e *reputationElector) Name() string { return LeaderReputation }
+
+func (e *reputationElector) Leader(seq, view uint64, verifiers []*model.Verifier) int {
+	failed := make(map[string]struct{})
+	if seq > e.lag+1 {
+		to := seq - 1 - e.lag
+		from := uint64(0)
+		if to > e.window {
+			from = to - e.window
+		}
+		for _, f := range e.ws.RecentLeaderFailures(from, to) {
+			failed[string(f.PublickKey)] = struct{}{}
+		}
+	}
+	candidates := make([]int, 0, len(verifiers))
+	for i, v := range verifiers {
+		if _, ok := failed[string(v.PublickKey)]; !ok {
+			candidates = append(candidates, i)
+		}
+	}
+	// 所有节点都超时过 退化为轮流选择
+	if len(candidates) == 0 {
+		return int((seq + view) % uint64(len(verifiers)))
+	}
+	return candidates[(seq+view)%uint64(len(candidates))]
+}
+
+// leaderLag 选择主节点时 最近多少个高度的超时记录还不能使用
+// 节点最多接收比本地高2倍流水线窗口的消息 这些高度的主节点必须在所有节点上一致
+func (pbft *PBFT) leaderLag() uint64 {
+	return 2 * pbft.pipelineWindow()
+}
+
+// reputationWindow 超时记录保留的区块数量
+func (pbft *PBFT) reputationWindow() uint64 {
+	window := uint64(defaultReputationWindow)
+	if pbft.cfg.ConsensusCfg.ReputationWindow > 0 {
+		window = uint64(pbft.cfg.ConsensusCfg.ReputationWindow)
+	}
+	return window + pbft.leaderLag() + 1
+}
+
+// recordLeaderFailures 提交区块时记录这个高度上超时的主节点
+// 从前一个区块的视图到本区块的视图之间 每个视图的主节点都没能完成提议 所有节点根据链上数据得到相同的结果
+func (pbft *PBFT) recordLeaderFailures(block *model.PbftBlock) {
+	start := uint64(0)
+	if block.BlockNum > 1 {
+		if prev, _ := pbft.ws.GetBlock(block.BlockNum - 1); prev != nil {
+			start = prev.View
+		}
+	}
+	failed := make([][]byte, 0)
+	for v := block.View; v > start && len(failed) < len(pbft.ws.Verifiers); v-- {
+		failed = append(failed, pbft.primarySigner(block.BlockNum, v-1))
+	}
+	pbft.ws.RecordLeaderFailures(block.BlockNum, failed, pbft.reputationWindow())
+}
@@ -0,0 +1,40 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestWeightedElector(t *testing.T) {
+	verifiers := []*model.Verifier{
+		{PublickKey: []byte{1}, Weight: 1},
+		{PublickKey: []byte{2}, Weight: 1},
+		{PublickKey: []byte{3}, Weight: 8},
+	}
+	e, err := NewLeaderElector(LeaderWeighted, nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make([]int, len(verifiers))
+	for seq := uint64(1); seq <= 1000; seq++ {
+		l := e.Leader(seq, 0, verifiers)
+		if l != e.Leader(seq, 0, verifiers) {
+			t.Fatalf("高度%d的主节点选择结果不确定", seq)
+		}
+		// 视图切换后必须换成其他节点
+		if e.Leader(seq, 1, verifiers) == l {
+			t.Fatalf("高度%d视图切换后主节点没有变化", seq)
+		}
+		count[l]++
+	}
+	if count[2] < 700 || count[0] == 0 || count[1] == 0 {
+		t.Fatalf("主节点分布与权重不符: %v", count)
+	}
+}
+
+func TestUnknownElector(t *testing.T) {
+	if _, err := NewLeaderElector("random", nil, 0, 0); err == nil {
+		t.Fatalf("未知的策略应该返回错误")
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
-	"time"
 
 	"github.com/wupeaking/pbft_impl/model"
 )
@@ -23,16 +22,27 @@ type MsgManager struct {
 	StateMsgLock  sync.RWMutex
 	BlockView     map[uint64]map[uint64]struct{}
 	BlockViewLock sync.RWMutex
+	// block_num : checkpoint消息 与视图无关
+	Checkpoints map[uint64][]*StateMsg
+	// 最近一次稳定的checkpoint 低于此高度的日志都会被清除
+	StableCheckpoint   uint64
+	StableCheckpointID string
+	CheckpointLock     sync.RWMutex
+	// 发现的双签记录
+	Equivocations    []*Equivocation
+	EquivocationLock sync.RWMutex
 }
 
 func NewMsgManager() *MsgManager {
 	return &MsgManager{
-		BlockMsg:      make(map[string]*model.PbftBlock),
-		BlockMsgLock:  sync.RWMutex{},
-		StateMsgs:     make(map[string][]*StateMsg),
-		StateMsgLock:  sync.RWMutex{},
-		BlockView:     make(map[uint64]map[uint64]struct{}),
-		BlockViewLock: sync.RWMutex{},
+		BlockMsg:       make(map[string]*model.PbftBlock),
+		BlockMsgLock:   sync.RWMutex{},
+		StateMsgs:      make(map[string][]*StateMsg),
+		StateMsgLock:   sync.RWMutex{},
+		BlockView:      make(map[uint64]map[uint64]struct{}),
+		BlockViewLock:  sync.RWMutex{},
+		Checkpoints:    make(map[uint64][]*StateMsg),
+		CheckpointLock: sync.RWMutex{},
 	}
 }
 
@@ -41,6 +51,7 @@ type StateMsg struct {
 	Msg           *model.PbftMessage
 	GenericMsg    *model.PbftGenericMessage
 	ViewChangeMsg *model.PbftViewChange
+	NewViewMsg    *model.PbftNewView
 	Signer        []byte
 	Broadcast     bool // 是否被广播过
 	Readed        bool // 是否在状态迁移阶段被读取过
@@ -48,10 +59,14 @@ type StateMsg struct {
 }
 
 func (mm *MsgManager) addMsg(blkNum uint64, view uint64, msgType model.MessageType,
-	signer []byte, msg *model.PbftMessage, gm *model.PbftGenericMessage, vc *model.PbftViewChange) bool {
+	signer []byte, msg *model.PbftMessage, gm *model.PbftGenericMessage, vc *model.PbftViewChange, nv *model.PbftNewView) bool {
 	stateMsgKey := fmt.Sprintf("%d-%d", blkNum, view)
 	mm.StateMsgLock.Lock()
 	defer mm.StateMsgLock.Unlock()
+	// 持有锁时再检查一次 避免和truncate并发时在稳定checkpoint以下留下日志
+	if blkNum <= mm.stableCheckpoint() {
+		return false
+	}
 
 	msgs, ok := mm.StateMsgs[stateMsgKey]
 	if !ok {
@@ -60,6 +75,7 @@ func (mm *MsgManager) addMsg(blkNum uint64, view uint64, msgType model.MessageTy
 			Msg:           msg,
 			GenericMsg:    gm,
 			ViewChangeMsg: vc,
+			NewViewMsg:    nv,
 			Signer:        signer,
 			Broadcast:     false,
 			Readed:        false,
@@ -84,6 +100,7 @@ func (mm *MsgManager) addMsg(blkNum uint64, view uint64, msgType model.MessageTy
 		Msg:           msg,
 		GenericMsg:    gm,
 		ViewChangeMsg: vc,
+		NewViewMsg:    nv,
 		Signer:        signer,
 		Broadcast:     false,
 		Readed:        false,
@@ -112,6 +129,9 @@ func (mm *MsgManager) addBlock(blkNum uint64, view uint64, block *model.PbftBloc
 	blkMsgKey := fmt.Sprintf("%d-%d", blkNum, view)
 	mm.BlockMsgLock.Lock()
 	defer mm.BlockMsgLock.Unlock()
+	if blkNum <= mm.stableCheckpoint() {
+		return false
+	}
 
 	blk, ok := mm.BlockMsg[blkMsgKey]
 	if !ok {
@@ -120,6 +140,10 @@ func (mm *MsgManager) addBlock(blkNum uint64, view uint64, block *model.PbftBloc
 		return true
 	}
 
+	// 同一高度和视图下只接受一个区块 其他区块的签名不能合并进来
+	if blk.BlockId != block.BlockId {
+		return false
+	}
 	// todo:: !!! 这里逻辑有点问题 需要判断是否signerid一样 如果不一样 需要加进来
 	if len(blk.SignPairs) == 0 && len(blk.SignPairs) < len(block.SignPairs) {
 		mm.BlockMsg[blkMsgKey] = block
@@ -154,39 +178,117 @@ func (pbft *PBFT) AppendMsg(msg *model.PbftMessage) bool {
 	}
 	switch content := getPbftMsg(msg).(type) {
 	case *model.PbftGenericMessage:
+		if content.Info.MsgType == model.MessageType_Checkpoint {
+			if !pbft.acceptableCheckpoint(content.Info.SeqNum) {
+				return false
+			}
+			ok := pbft.mm.addCheckpoint(content.Info.SeqNum, content.Info.SignerId, msg, content)
+			if ok {
+				pbft.msgAccepted(content.Info, msg)
+			}
+			return ok
+		}
+		// 低于稳定checkpoint的消息已经没有意义 超过高水位太多的消息暂不接收
+		if content.Info.SeqNum <= pbft.mm.stableCheckpoint() || !pbft.acceptableSeq(content.Info.SeqNum) {
+			return false
+		}
 		for i := range content.OtherInfos {
 			pbft.AppendMsg(model.NewPbftMessage(&model.PbftGenericMessage{Info: content.OtherInfos[i]}))
 		}
+		// 同一个签名者对不同区块的投票 只保留第一个 后续的作为双签证据记录下来
+		if ev := pbft.mm.checkEquivocation(content.Info); ev != nil {
+			pbft.reportEquivocation(ev)
+			return false
+		}
 		addMsgOk := pbft.mm.addMsg(content.Info.SeqNum, content.Info.View,
-			content.Info.MsgType, content.Info.SignerId, msg, content, nil)
+			content.Info.MsgType, content.Info.SignerId, msg, content, nil, nil)
 
 		if content.Block != nil {
 			// 判断提议者签名是否正确
-			primary := (pbft.ws.BlockNum + 1 + pbft.ws.View) % uint64(len(pbft.ws.Verifiers))
-			if len(pbft.ws.Verifiers) == 1 {
-				primary = 0
-			}
-			if bytes.Compare(pbft.ws.Verifiers[primary].PublickKey, content.Block.SignerId) != 0 {
-				pbft.logger.Debugf("添加区块消息失败 因为当前区块的主签名不一致和计算的主签名不是同一个 blockNum: %d, view: %d, primary: %d",
-					content.Info.SeqNum, content.Info.View, primary)
+			// 新视图中重新提议的区块 主签名仍是原视图的主节点 只要和新主节点提议的区块一致即可
+			if bytes.Compare(pbft.primarySigner(content.Info.SeqNum, content.Info.View), content.Block.SignerId) != 0 &&
+				!pbft.isKnownBlock(content.Info.SeqNum, content.Info.View, content.Block.BlockId) &&
+				pbft.proposalDigest(content.Info.SeqNum, content.Info.View) != content.Block.BlockId {
+				pbft.logger.Debugf("添加区块消息失败 因为当前区块的主签名不一致和计算的主签名不是同一个 blockNum: %d, view: %d",
+					content.Info.SeqNum, content.Info.View)
 				return addMsgOk
 			}
 			addBlkOk := pbft.mm.addBlock(content.Info.SeqNum, content.Info.View, content.Block)
 
 			// 添加消息和区块 有一个成功则任务添加成功 从而再次进入状态处理
+			if addMsgOk || addBlkOk {
+				pbft.msgAccepted(content.Info, msg)
+			}
 			return addMsgOk || addBlkOk
 		}
 
 		pbft.logger.Debugf("追加日志高度: %d, 日志类型: %s", content.Info.SeqNum, content.Info.GetMsgType())
+		if addMsgOk {
+			pbft.msgAccepted(content.Info, msg)
+		}
 		return addMsgOk
 
 	case *model.PbftViewChange:
-		return pbft.mm.addMsg(content.Info.SeqNum, content.Info.View,
-			content.Info.MsgType, content.Info.SignerId, msg, nil, content)
+		if content.Info.SeqNum <= pbft.mm.stableCheckpoint() || !pbft.acceptableSeq(content.Info.SeqNum) ||
+			!pbft.acceptableView(content.Info.View) {
+			return false
+		}
+		ok := pbft.mm.addMsg(content.Info.SeqNum, content.Info.View,
+			content.Info.MsgType, content.Info.SignerId, msg, nil, content, nil)
+		if ok {
+			pbft.msgAccepted(content.Info, msg)
+		}
+		return ok
+
+	case *model.PbftNewView:
+		if content.Info.SeqNum <= pbft.mm.stableCheckpoint() || !pbft.acceptableSeq(content.Info.SeqNum) ||
+			!pbft.acceptableView(content.Info.View) {
+			return false
+		}
+		ok := pbft.mm.addMsg(content.Info.SeqNum, content.Info.View,
+			content.Info.MsgType, content.Info.SignerId, msg, nil, nil, content)
+		if ok {
+			pbft.msgAccepted(content.Info, msg)
+		}
+		return ok
 	}
 	return false
 }
 
+// msgAccepted 消息被追加到消息日志 写入预写日志并发布事件
+func (pbft *PBFT) msgAccepted(info *model.PbftMessageInfo, msg *model.PbftMessage) {
+	pbft.walAppend(info.SeqNum, info.View, info.MsgType, info.SignerId, msg)
+	pbft.emitMessage(info)
+}
+
+// isKnownBlock 判断指定高度和视图下是否已经记录了此区块
+func (pbft *PBFT) isKnownBlock(num, view uint64, blockID string) bool {
+	blk := pbft.FindBlock(num, view)
+	return blk != nil && blk.BlockId == blockID
+}
+
+// LoggedHeights 消息日志中还保留着状态消息或者区块的高度 可能有重复
+func (pbft *PBFT) LoggedHeights() []uint64 {
+	heights := make([]uint64, 0)
+	parse := func(key string) {
+		var num, view uint64
+		if _, err := fmt.Sscanf(key, "%d-%d", &num, &view); err == nil {
+			heights = append(heights, num)
+		}
+	}
+	pbft.mm.StateMsgLock.RLock()
+	for k := range pbft.mm.StateMsgs {
+		parse(k)
+	}
+	pbft.mm.StateMsgLock.RUnlock()
+	pbft.mm.BlockMsgLock.RLock()
+	for k := range pbft.mm.BlockMsg {
+		parse(k)
+	}
+	pbft.mm.BlockMsgLock.RUnlock()
+	return heights
+}
+
 func (pbft *PBFT) FindBlock(num, view uint64) *model.PbftBlock {
 	pbft.mm.BlockMsgLock.RLock()
 	defer pbft.mm.BlockMsgLock.RUnlock()
@@ -225,6 +327,30 @@ func (pbft *PBFT) FindStateMsg(num, view uint64, msgType model.MessageType) []*S
 	// return nil, nil
 }
 
+// FindStateMsgByDigest 查找对指定区块投票的消息 只有投给同一个区块的票才能计入法定数量
+func (pbft *PBFT) FindStateMsgByDigest(num, view uint64, msgType model.MessageType, blockID string) []*StateMsg {
+	pbft.mm.StateMsgLock.RLock()
+	defer pbft.mm.StateMsgLock.RUnlock()
+	msgs := pbft.mm.StateMsgs[fmt.Sprintf("%d-%d", num, view)]
+	rets := make([]*StateMsg, 0)
+	for i := range msgs {
+		if msgs[i].MsgType == msgType && msgs[i].GenericMsg != nil &&
+			msgs[i].GenericMsg.Info.BlockId == blockID {
+			rets = append(rets, msgs[i])
+		}
+	}
+	return rets
+}
+
+// proposalDigest 主节点在指定高度和视图下提议的区块ID
+func (pbft *PBFT) proposalDigest(num, view uint64) string {
+	pp := pbft.FindStateMsgBySinger(num, view, model.MessageType_PrePrepare, pbft.primarySigner(num, view))
+	if pp != nil && pp.GenericMsg.Info.BlockId != "" {
+		return pp.GenericMsg.Info.BlockId
+	}
+	return ""
+}
+
 func (pbft *PBFT) FindStateMsgBySinger(num, view uint64, msgType model.MessageType, signer []byte) *StateMsg {
 	pbft.mm.StateMsgLock.RLock()
 	defer pbft.mm.StateMsgLock.RUnlock()
@@ -374,27 +500,3 @@ func (lm LogBlockCollection) ResetBlock(num uint64) {
 // 	}
 // 	return false
 // }
-
-// 定时清除无用的logMsg
-func (pbft *PBFT) garbageCollection() {
-	for {
-		select {
-		case <-time.After(10 * time.Second):
-			for key := range pbft.mm.BlockView {
-				// 保留个阈值
-				if key+10 > pbft.ws.BlockNum {
-					break
-				}
-				// 找到当前num下所有的view
-				views := pbft.mm.BlockView[key]
-				for view := range views {
-					k := fmt.Sprintf("%d-%d", key, view)
-					pbft.logger.Debugf("删除key: %s", k)
-					delete(pbft.mm.StateMsgs, k)
-					delete(pbft.mm.BlockMsg, k)
-				}
-				delete(pbft.mm.BlockView, key)
-			}
-		}
-	}
-}
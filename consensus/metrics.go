@@ -0,0 +1,61 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/metrics"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+var (
+	phaseDuration = metrics.NewHistogramVec("pbft_consensus_phase_duration_seconds",
+		"每个共识状态停留的时间", metrics.DefBuckets, "phase")
+	roundDuration = metrics.NewHistogramVec("pbft_consensus_round_duration_seconds",
+		"从开始处理一个高度到提交区块的时间", metrics.DefBuckets)
+	viewChangeCount = metrics.NewCounter("pbft_consensus_view_changes_total", "超时发起视图切换的次数")
+	newViewCount    = metrics.NewCounter("pbft_consensus_new_views_total", "进入新视图的次数")
+	msgReceived     = metrics.NewCounterVec("pbft_consensus_messages_received_total",
+		"从网络收到的共识消息数量", "type")
+	msgDropped = metrics.NewCounterVec("pbft_consensus_messages_dropped_total",
+		"被丢弃的共识消息数量", "reason")
+)
+
+// registerMetrics 注册需要在输出时读取的共识状态
+func (pbft *PBFT) registerMetrics() {
+	metrics.NewGaugeFunc("pbft_consensus_state", "共识状态机当前的状态 取值为model.States",
+		func() float64 { return float64(pbft.CurrentState()) })
+	metrics.NewGaugeFunc("pbft_consensus_view", "当前视图", func() float64 { return float64(pbft.ws.View) })
+	metrics.NewGaugeFunc("pbft_consensus_height", "已提交的区块高度", func() float64 { return float64(pbft.ws.BlockNum) })
+	metrics.NewGaugeFunc("pbft_consensus_msg_queue_depth", "等待处理的共识消息数量",
+		func() float64 { return float64(pbft.Msgs.Len()) })
+}
+
+// observeState 状态迁移时记录上一个状态停留的时间
+func (pbft *PBFT) observeState(from, to model.States) {
+	now := pbft.clock.Now()
+	if !pbft.sm.enteredAt.IsZero() {
+		phaseDuration.With(from.String()).Observe(now.Sub(pbft.sm.enteredAt).Seconds())
+	}
+	pbft.sm.enteredAt = now
+	if from == model.States_NotStartd && to != model.States_ViewChanging {
+		pbft.sm.roundStart = now
+	}
+}
+
+// observeCommit 提交区块时记录整轮共识的时间
+func (pbft *PBFT) observeCommit() {
+	if !pbft.sm.roundStart.IsZero() {
+		roundDuration.With().Observe(pbft.clock.Now().Sub(pbft.sm.roundStart).Seconds())
+		pbft.sm.roundStart = time.Time{}
+	}
+}
+
+func msgTypeName(msg *model.PbftMessage) string {
+	if msg.GetEvidence() != nil {
+		return "Evidence"
+	}
+	if info := msgInfoOf(msg); info != nil {
+		return info.MsgType.String()
+	}
+	return "Unknown"
+}
@@ -0,0 +1,156 @@
+package consensus
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+// 本节点产生的消息所属的peer
+const localPeer = ""
+
+// peerQueueFactor 每个peer最多等待处理的消息数量是单个队列上限的倍数
+const peerQueueFactor = 8
+
+// MsgQueue 待处理的共识消息 先按发送的peer 再按签名者和消息类型分别排队 每个队列有上限
+// 取消息时在各个peer之间轮流取 同一个peer内在各个队列之间轮流取
+// 一个peer或者一个签名者发送大量消息不会影响其他peer和签名者
+type MsgQueue struct {
+	peers  map[string]*peerQueue
+	order  []string // 有待处理消息的peer 按轮转顺序排列
+	size   int      // 每个队列最多的消息数量
+	total  int
+	notify chan struct{}
+	sync.Mutex
+}
+
+// peerQueue 一个peer发来的消息
+type peerQueue struct {
+	queues map[string][]*model.PbftMessage
+	keys   []string // 有待处理消息的队列 按轮转顺序排列
+	total  int
+}
+
+func NewMsgQueue(size int) *MsgQueue {
+	if size <= 0 {
+		size = defaultMsgQueueSize
+	}
+	return &MsgQueue{
+		peers:  make(map[string]*peerQueue),
+		size:   size,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// queueKey 消息所属的队列 签名者-消息类型
+// 签名者不是验证者时 签名者可以任意伪造 同一个peer发来的这类消息共用一个队列
+func queueKey(msg *model.PbftMessage, validator bool) string {
+	info := msgInfoOf(msg)
+	if info == nil {
+		return "evidence"
+	}
+	if !validator {
+		return "unknown"
+	}
+	return fmt.Sprintf("%x-%d", info.SignerId, info.MsgType)
+}
+
+// InsertMsg 本节点产生的消息入队
+func (mq *MsgQueue) InsertMsg(msg *model.PbftMessage) bool {
+	return mq.insert(localPeer, queueKey(msg, true), msg)
+}
+
+// InsertPeerMsg peer发来的消息入队 validator表示签名者是否是当前的验证者
+func (mq *MsgQueue) InsertPeerMsg(peer string, validator bool, msg *model.PbftMessage) bool {
+	return mq.insert(peer, queueKey(msg, validator), msg)
+}
+
+// insert 所属队列或者peer的消息已满时丢弃
+func (mq *MsgQueue) insert(peer, key string, msg *model.PbftMessage) bool {
+	mq.Lock()
+	pq := mq.peers[peer]
+	if pq == nil {
+		pq = &peerQueue{queues: make(map[string][]*model.PbftMessage)}
+	}
+	q := pq.queues[key]
+	if len(q) >= mq.size || (peer != localPeer && pq.total >= mq.size*peerQueueFactor) {
+		mq.Unlock()
+		msgDropped.With("queue_full").Inc()
+		return false
+	}
+	if pq.total == 0 {
+		mq.peers[peer] = pq
+		mq.order = append(mq.order, peer)
+	}
+	if len(q) == 0 {
+		pq.keys = append(pq.keys, key)
+	}
+	pq.queues[key] = append(q, msg)
+	pq.total++
+	mq.total++
+	mq.Unlock()
+	mq.signal()
+	return true
+}
+
+// Pop 轮流从各个peer的队列中取出一条消息 没有消息时返回nil
+func (mq *MsgQueue) Pop() *model.PbftMessage {
+	mq.Lock()
+	if len(mq.order) == 0 {
+		mq.Unlock()
+		return nil
+	}
+	peer := mq.order[0]
+	pq := mq.peers[peer]
+	msg := pq.pop()
+	if pq.total == 0 {
+		delete(mq.peers, peer)
+		mq.order = mq.order[1:]
+	} else {
+		mq.order = append(mq.order[1:], peer)
+	}
+	mq.total--
+	remain := mq.total
+	mq.Unlock()
+	// 还有消息 继续通知
+	if remain > 0 {
+		mq.signal()
+	}
+	return msg
+}
+
+// pop 轮流从peer的各个队列中取出一条消息 调用前需要持有锁并且队列不为空
+func (pq *peerQueue) pop() *model.PbftMessage {
+	key := pq.keys[0]
+	q := pq.queues[key]
+	msg := q[0]
+	if len(q) == 1 {
+		delete(pq.queues, key)
+		pq.keys = pq.keys[1:]
+	} else {
+		pq.queues[key] = q[1:]
+		pq.keys = append(pq.keys[1:], key)
+	}
+	pq.total--
+	return msg
+}
+
+func (mq *MsgQueue) signal() {
+	select {
+	case mq.notify <- struct{}{}:
+	default:
+	}
+}
+
+// WaitMsg 有消息入队时通知 收到通知后调用Pop取消息
+func (mq *MsgQueue) WaitMsg() <-chan struct{} {
+	return mq.notify
+}
+
+// Len 等待处理的消息数量
+func (mq *MsgQueue) Len() int {
+	mq.Lock()
+	defer mq.Unlock()
+	return mq.total
+}
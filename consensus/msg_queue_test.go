@@ -0,0 +1,84 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+)
+
+func TestMsgQueueFairness(t *testing.T) {
+	mq := NewMsgQueue(2)
+	msg := func(signer string) *model.PbftMessage {
+		return model.NewPbftMessage(&model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare, SignerId: []byte(signer)}})
+	}
+	// 每个签名者的队列最多两条消息
+	for i := 0; i < 5; i++ {
+		mq.InsertMsg(msg("noisy"))
+	}
+	mq.InsertMsg(msg("quiet"))
+	if mq.Len() != 3 {
+		t.Fatalf("队列长度应为3 实际为%d", mq.Len())
+	}
+	// 轮流取出 安静的签名者不会排在所有噪声消息之后
+	order := make([]string, 0)
+	for m := mq.Pop(); m != nil; m = mq.Pop() {
+		order = append(order, string(m.GetGeneric().Info.SignerId))
+	}
+	if len(order) != 3 || order[1] != "quiet" {
+		t.Fatalf("消息没有轮流取出 %v", order)
+	}
+}
+
+func TestMsgQueuePeers(t *testing.T) {
+	mq := NewMsgQueue(2)
+	msg := func(signer string, view uint64) *model.PbftMessage {
+		return model.NewPbftMessage(&model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare, SignerId: []byte(signer), View: view}})
+	}
+	// 不是验证者的签名者共用一个队列 伪造再多的签名者也只占两条
+	for i := 0; i < 5; i++ {
+		mq.InsertPeerMsg("bad", false, msg(string(rune('a'+i)), 0))
+	}
+	// 同一个peer的消息总数有上限
+	for i := 0; i < 2*peerQueueFactor; i++ {
+		mq.InsertPeerMsg("bad", true, msg(string(rune('a'+i)), 0))
+	}
+	if mq.Len() != 2*peerQueueFactor {
+		t.Fatalf("peer的消息数量应为%d 实际为%d", 2*peerQueueFactor, mq.Len())
+	}
+	// 其他peer转发的消息不受影响 并且和噪声peer轮流取出
+	mq.InsertPeerMsg("good", true, msg("a", 1))
+	mq.Pop()
+	if m := mq.Pop(); m == nil || m.GetGeneric().Info.View != 1 {
+		t.Fatalf("其他peer的消息没有轮流取出")
+	}
+}
+
+func TestStaleMsg(t *testing.T) {
+	pbft := &PBFT{mm: NewMsgManager(), ws: world_state.New(cache.NewMemory(), "")}
+	pbft.mm.StableCheckpoint = 5
+	pbft.ws.SetValue(8, "", "", nil)
+	pbft.ws.SetView(2)
+	msg := func(msgType model.MessageType, seq, view uint64) *model.PbftMessage {
+		return model.NewPbftMessage(&model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: msgType, SeqNum: seq, View: view}})
+	}
+	cases := []struct {
+		msg   *model.PbftMessage
+		stale bool
+	}{
+		{msg(model.MessageType_Commit, 5, 2), true},      // 低于稳定checkpoint
+		{msg(model.MessageType_Commit, 7, 1), true},      // 已经提交的高度上更低的视图
+		{msg(model.MessageType_Checkpoint, 7, 1), false}, // checkpoint不按视图判断
+		{msg(model.MessageType_Commit, 7, 2), false},
+		{msg(model.MessageType_Prepare, 9, 1), false},
+	}
+	for i, c := range cases {
+		if pbft.staleMsg(c.msg) != c.stale {
+			t.Fatalf("case %d: 期望%v", i, c.stale)
+		}
+	}
+}
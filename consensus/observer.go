@@ -0,0 +1,121 @@
+package consensus
+
+import (
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+/*
+	observer: 不是验证者的节点以观察者模式跟随共识
+	观察者定时向其他节点订阅共识消息 验证者把共识消息同时发送给订阅过的观察者
+	观察者只记录消息 不签名任何消息 观察到某个区块的commit消息达到2f+1后直接提交
+*/
+
+// observerTTL 超过此时间没有重新订阅的观察者不再发送共识消息
+const observerTTL = time.Minute
+
+// IsObserver 本节点是否以观察者模式运行
+func (pbft *PBFT) IsObserver() bool {
+	return pbft.observer
+}
+
+// subscribe 观察者向其他节点订阅共识消息
+func (pbft *PBFT) subscribe() {
+	msgPkg := network.BroadcastMsg{
+		ModelID: "consensus",
+		MsgType: model.BroadcastMsgType_subscribe_pbft_msg,
+	}
+	if err := pbft.switcher.Broadcast("consensus", &msgPkg); err != nil {
+		pbft.logger.Debugf("订阅共识消息失败 err: %v", err)
+	}
+}
+
+// onSubscribe 记录订阅共识消息的观察者
+func (pbft *PBFT) onSubscribe(p *network.Peer) {
+	if p == nil || pbft.observer {
+		return
+	}
+	pbft.observerLock.Lock()
+	pbft.observers[p.ID] = pbft.clock.Now()
+	pbft.observerLock.Unlock()
+}
+
+// observerPeers 还在订阅期内的观察者 过期的观察者会被移除
+func (pbft *PBFT) observerPeers() []*network.Peer {
+	now := pbft.clock.Now()
+	pbft.observerLock.Lock()
+	defer pbft.observerLock.Unlock()
+	peers := make([]*network.Peer, 0, len(pbft.observers))
+	for id, t := range pbft.observers {
+		if now.Sub(t) > observerTTL {
+			delete(pbft.observers, id)
+			continue
+		}
+		peers = append(peers, &network.Peer{ID: id})
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers
+}
+
+// observeMsg 观察者处理收到的共识消息
+func (pbft *PBFT) observeMsg(msg *model.PbftMessage) {
+	if !pbft.VerfifyMsg(msg) {
+		return
+	}
+	if ok := pbft.AppendMsg(msg); !ok {
+		return
+	}
+	if gm := msg.GetGeneric(); gm != nil && gm.Info.MsgType == model.MessageType_Checkpoint {
+		pbft.processCheckpoint(gm.Info.SeqNum, gm.Info.BlockId)
+		return
+	}
+	// NewView中重新提议的区块 后续的commit消息会针对这个区块
+	if nv := msg.GetNewView(); nv != nil && nv.PrePrepare != nil && nv.Info.SeqNum > pbft.ws.BlockNum {
+		pbft.mm.addBlock(nv.Info.SeqNum, nv.Info.View, proto.Clone(nv.PrePrepare.Block).(*model.PbftBlock))
+	}
+	pbft.observeCommits()
+}
+
+// observeCommits 依次提交已经观察到2f+1个commit消息的区块
+func (pbft *PBFT) observeCommits() {
+	for {
+		blk := pbft.committedBlock(pbft.ws.BlockNum + 1)
+		if blk == nil {
+			return
+		}
+		if err := pbft.TryApplyBlock(blk); err != nil {
+			pbft.logger.Warnf("观察到的区块校验失败 高度: %d, err: %v", blk.BlockNum, err)
+			return
+		}
+		if err := pbft.CommitBlock(blk); err != nil {
+			pbft.logger.Warnf("观察到的区块提交失败 高度: %d, err: %v", blk.BlockNum, err)
+			return
+		}
+	}
+}
+
+// committedBlock 在任意视图下收到了2f+1个commit消息的区块
+func (pbft *PBFT) committedBlock(seq uint64) *model.PbftBlock {
+	pbft.mm.BlockViewLock.RLock()
+	views := make([]uint64, 0, len(pbft.mm.BlockView[seq]))
+	for v := range pbft.mm.BlockView[seq] {
+		views = append(views, v)
+	}
+	pbft.mm.BlockViewLock.RUnlock()
+	sort.Slice(views, func(i, j int) bool { return views[i] > views[j] })
+
+	for _, v := range views {
+		blk := pbft.FindBlock(seq, v)
+		if blk == nil || blk.PrevBlock != pbft.ws.BlockID {
+			continue
+		}
+		if pbft.hasQuorum(msgSigners(pbft.FindStateMsgByDigest(seq, v, model.MessageType_Commit, blk.BlockId))) {
+			return blk
+		}
+	}
+	return nil
+}
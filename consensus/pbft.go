@@ -1,18 +1,18 @@
 package consensus
 
 import (
-	"encoding/json"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/emirpasic/gods/lists/singlylinkedlist"
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 	"github.com/wupeaking/pbft_impl/common/config"
 	"github.com/wupeaking/pbft_impl/cvm"
 	"github.com/wupeaking/pbft_impl/model"
 	"github.com/wupeaking/pbft_impl/network"
+	"github.com/wupeaking/pbft_impl/storage/database"
 	"github.com/wupeaking/pbft_impl/storage/world_state"
 	"github.com/wupeaking/pbft_impl/transaction"
 )
@@ -25,7 +25,7 @@ import (
 
 新架构方案:
 1. 共识的状态的转移依旧以消息驱动为主, 但是不在频繁进行消息广播. 每次状态迁移只广播一次消息.
-2. 为了解决因为消息驱动不及时导致的状态不能迁移问题. 加上定时轮询
+2. 状态机由事件驱动(见transition.go) 进入新状态后立即处理一次 不再定时轮询
 3. 重构消息管理 包括消息存储 消息查找 消息删除 消息标记
 4. 消息广播任务简单化 只有在viewchange状态 才持续广播
 */
@@ -35,83 +35,54 @@ type PBFT struct {
 	sm *StateMachine
 	mm *MsgManager
 	// verifiers         map[string]*model.Verifier
-	verifierPeerID    map[string]string // peerID --- string(singer)
-	Msgs              *MsgQueue
-	stateTimeout      *time.Timer // 状态转换超时器
-	switcher          network.SwitcherI
-	logger            *log.Entry
-	ws                *world_state.WroldState
-	statepollingTimer *StatePollingTimer // 状态迁移轮询定时器
-	txPool            *transaction.TxPool
-	vm                *cvm.VirtualMachine
-	tryProposalTimer  *time.Timer // 定时尝试提议区块
-	StopFlag          bool
-	cfg               *config.Configure
-	curBroadcastMsg   *StateMsg
-	broadcastSig      chan *StateMsg
+	verifierPeerID   map[string]string // peerID --- string(singer)
+	peerIDLock       sync.RWMutex
+	Msgs             *MsgQueue
+	clock            Clock
+	stateTimeout     Timer // 状态转换超时器
+	switcher         network.SwitcherI
+	logger           *log.Entry
+	ws               *world_state.WroldState
+	txPool           *transaction.TxPool
+	vm               *cvm.VirtualMachine
+	tryProposalTimer Timer  // 定时尝试提议区块
+	broadcastTicker  Ticker // 定时重新广播
+	StopFlag         bool
+	cfg              *config.Configure
+	curBroadcastMsg  *StateMsg
+	broadcastSig     chan *StateMsg
+	wal              *WAL                 // 共识预写日志
+	fault            *faultInjector       // 故障注入 只在测试网络中开启
+	timeouts         timeouts             // 定时器间隔 来自配置
+	elector          LeaderElector        // 主节点选择策略
+	policy           blockPolicy          // 出块策略
+	limits           msgLimits            // 收到共识消息时的限制
+	guard            *peerGuard           // 记录发送无效消息的peer
+	events           *eventBus            // 共识事件订阅
+	observer         bool                 // 观察者模式 只跟随共识 不投票
+	observers        map[string]time.Time // 订阅了共识消息的观察者 peerID --- 最近一次订阅时间
+	observerLock     sync.Mutex
 	sync.Mutex
 }
 
-type StatePollingTimer struct {
-	*time.Timer
-}
-
-func NewStatePollingTimer() *StatePollingTimer {
-	t := &StatePollingTimer{
-		time.NewTimer(500 * time.Millisecond),
-	}
-	//t.Stop()
-	return t
-}
-
-// 正常的轮询间隔
-const normalDuraton = 1000 * time.Millisecond
-
-// 加快轮询
-const fastDuration = 50 * time.Millisecond
-
-func (st *StatePollingTimer) AdjustmentPolling(duration time.Duration) {
-	if !st.Stop() {
-		select {
-		case <-st.C:
-		default:
-		}
-	}
-	st.Reset(duration)
-}
-
-type MsgQueue struct {
-	l         *singlylinkedlist.List
-	comingMsg chan *model.PbftMessage
-	size      int
-	sync.Mutex
-}
-
-func NewMsgQueue() *MsgQueue {
-	return &MsgQueue{
-		l:         singlylinkedlist.New(),
-		comingMsg: make(chan *model.PbftMessage, 10000),
-		size:      1000,
-	}
-}
-
-func (mq *MsgQueue) InsertMsg(msg *model.PbftMessage) {
-	select {
-	case mq.comingMsg <- msg:
-		return
-	default:
-		println("消息写入通道已满...")
-	}
-}
-
-func (mq *MsgQueue) WaitMsg() <-chan *model.PbftMessage {
-	return mq.comingMsg
-}
-
 func New(ws *world_state.WroldState, txPool *transaction.TxPool, switcher network.SwitcherI, vm *cvm.VirtualMachine, cfg *config.Configure) (*PBFT, error) {
 	pbft := &PBFT{}
 	pbft.cfg = cfg
-	pbft.Msgs = NewMsgQueue()
+	pbft.clock = realClock{}
+	pbft.timeouts = newTimeouts(&cfg.ConsensusCfg)
+	pbft.policy = newBlockPolicy(&cfg.ConsensusCfg)
+	elector, err := NewLeaderElector(cfg.ConsensusCfg.LeaderElection, ws,
+		cfg.ConsensusCfg.ReputationWindow, pbft.leaderLag())
+	if err != nil {
+		return nil, err
+	}
+	pbft.elector = elector
+	pbft.events = newEventBus()
+	pbft.observers = make(map[string]time.Time)
+	pbft.registerMetrics()
+	pbft.Msgs = NewMsgQueue(cfg.ConsensusCfg.MsgQueueSize)
+	pbft.limits = newMsgLimits(&cfg.ConsensusCfg)
+	pbft.guard = newPeerGuard(pbft.limits.maxInvalidMsgs, invalidMsgWindow)
 	pbft.sm = NewStateMachine()
 
 	l := log.New()
@@ -139,12 +110,12 @@ func New(ws *world_state.WroldState, txPool *transaction.TxPool, switcher networ
 	// for _, v := range ws.Verifiers {
 	// 	pbft.verifiers[string(v.PublickKey)] = v
 	// }
-	pbft.verifierPeerID = make(map[string]string)
-
-	// 转换验证者的peer id
-	// if err := pbft.LoadVerfierPeerIDs(); err != nil {
-	// 	return nil, err
-	// }
+	// 转换验证者的peer id 共识消息只发送给验证者
+	pbft.LoadVerfierPeerIDs()
+	if cfg.ConsensusCfg.Observer && ws.CurVerfier == nil {
+		pbft.observer = true
+		pbft.logger.Infof("本节点不是验证者 以观察者模式跟随共识")
+	}
 
 	pbft.broadcastSig = make(chan *StateMsg, 100)
 	pbft.txPool = txPool
@@ -154,103 +125,216 @@ func New(ws *world_state.WroldState, txPool *transaction.TxPool, switcher networ
 	pbft.mm = NewMsgManager()
 	pbft.vm = vm
 
+	if fc := cfg.ConsensusCfg.Fault; fc != nil && fc.Enable {
+		if !cfg.ConsensusCfg.TestNet {
+			return nil, fmt.Errorf("故障注入只能在测试网络中开启")
+		}
+		pbft.logger.Warnf("本节点开启了故障注入 会按配置发出恶意消息: %+v", *fc)
+		pbft.fault = newFaultInjector(fc)
+	}
+
+	// 打开预写日志 重放上次退出前的共识消息
+	walDB := database.NewMemDB()
+	if pbft.walPath() != MemoryWAL {
+		db, err := database.NewLevelDB(pbft.walPath())
+		if err != nil {
+			return nil, err
+		}
+		walDB = db
+	}
+	pbft.wal = NewWAL(walDB)
+	if err := pbft.replayWAL(); err != nil {
+		return nil, err
+	}
+
 	return pbft, nil
 }
 
 func (pbft *PBFT) Daemon() {
-	// 注册消息回调
-	pbft.switcher.RegisterOnReceive("consensus", pbft.msgOnRecv)
-
-	go pbft.garbageCollection()
+	pbft.initDaemon()
 	go pbft.BroadcastMsgRoutine()
 
-	pbft.stateTimeout = time.NewTimer(10 * time.Second)
-	pbft.tryProposalTimer = time.NewTimer(5 * time.Second)
-	pbft.statepollingTimer = NewStatePollingTimer()
-	pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-
 	for {
 		select {
-		case msg := <-pbft.Msgs.WaitMsg():
-			if pbft.StopFlag {
-				continue
+		case <-pbft.Msgs.WaitMsg():
+			if msg := pbft.Msgs.Pop(); msg != nil {
+				pbft.onMsg(msg)
 			}
-			// 有消息进入
-			pbft.StateMigrate(msg)
+		case <-pbft.stateTimeout.Chan():
+			pbft.onStateTimeout()
+		case <-pbft.tryProposalTimer.Chan():
+			pbft.onTryProposal()
+		case <-pbft.faultTimerChan():
+			pbft.onFaultTimer()
+		}
+	}
+}
 
-		case <-pbft.statepollingTimer.C:
-			pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-			if pbft.StopFlag {
-				continue
-			}
-			// 定时轮询状态迁移
-			// pbft.logger.Debugf("进入定时轮询状态迁移")
-			pbft.StateMigrate(nil)
+// initDaemon 注册消息回调 创建定时器
+func (pbft *PBFT) initDaemon() {
+	// 注册消息回调
+	pbft.switcher.RegisterOnReceive("consensus", pbft.msgOnRecv)
 
-		case <-pbft.stateTimeout.C:
-			if pbft.StopFlag {
-				continue
-			}
-			// 有超时 则进入viewchang状态 发起viewchange消息
-			pbft.logger.Debugf("超时 进入ViewChanging状态")
-			pbft.ChangeState(model.States_ViewChanging)
-			newMsg := model.PbftViewChange{
-				Info: &model.PbftMessageInfo{MsgType: model.MessageType_ViewChange,
-					View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
-					SignerId: pbft.ws.CurVerfier.PublickKey,
-					Sign:     nil,
-				},
-			}
-			signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
-			if err != nil {
-				pbft.logger.Errorf("在viewchanging状态 进行消息签名时 发生了错误, err: %v", err)
-				continue
-			}
-			pbft.Msgs.InsertMsg(signedMsg)
-			//pbft.AddBroadcastTask(signedMsg)
+	pbft.stateTimeout = pbft.clock.NewTimer(pbft.stateTimeoutDuration())
+	pbft.tryProposalTimer = pbft.clock.NewTimer(pbft.timeouts.tryProposal)
+	pbft.broadcastTicker = pbft.clock.NewTicker(pbft.timeouts.rebroadcast)
+	if pbft.fault != nil {
+		pbft.fault.timer = pbft.clock.NewTimer(time.Hour)
+		pbft.fault.timer.Stop()
+	}
+	if pbft.observer {
+		pbft.subscribe()
+	}
+	// 从预写日志恢复的状态 立即处理一次
+	pbft.fire(evEntered)
+}
 
-		case <-pbft.tryProposalTimer.C:
-			// 1. 检查共识引擎是否可以开始 2.是否处于no_started状态 3. 发起提案广播
-			// 重置timer 重置需要先停止 停止的时候要检查是否已经过期 过期可能需要尝试清空通道
-			if !pbft.tryProposalTimer.Stop() {
-				select {
-				case <-pbft.tryProposalTimer.C: // 要尝试抽空chanel的值
-				default:
-				}
-			}
-			pbft.tryProposalTimer.Reset(5 * time.Second)
+// Step 不阻塞地处理一个已经就绪的事件 没有就绪事件时返回false
+// 和Daemon不同 Step不会启动任何goroutine 事件按固定的优先级处理 便于测试时确定性地驱动共识
+func (pbft *PBFT) Step() bool {
+	if pbft.stateTimeout == nil {
+		pbft.initDaemon()
+	}
+	if msg := pbft.Msgs.Pop(); msg != nil {
+		pbft.onMsg(msg)
+		return true
+	}
+	select {
+	case <-pbft.stateTimeout.Chan():
+		pbft.onStateTimeout()
+		return true
+	default:
+	}
+	select {
+	case <-pbft.tryProposalTimer.Chan():
+		pbft.onTryProposal()
+		return true
+	default:
+	}
+	select {
+	case msg := <-pbft.broadcastSig:
+		pbft.onBroadcastTask(msg)
+		return true
+	default:
+	}
+	select {
+	case <-pbft.broadcastTicker.Chan():
+		pbft.onRebroadcast()
+		return true
+	default:
+	}
+	select {
+	case <-pbft.faultTimerChan():
+		pbft.onFaultTimer()
+		return true
+	default:
+	}
+	return false
+}
 
-			if pbft.StopFlag {
-				continue
-			}
-			if pbft.CurrentState() != model.States_NotStartd {
-				continue
-			}
-			pbft.logger.Debugf("尝试发起新提案...")
-			pbft.requestNewBlockProposal()
-		}
+func (pbft *PBFT) onMsg(msg *model.PbftMessage) {
+	if pbft.StopFlag {
+		return
+	}
+	// 双签证据不参与状态迁移
+	if ev := msg.GetEvidence(); ev != nil {
+		pbft.onEvidence(ev)
+		return
+	}
+	if pbft.observer {
+		pbft.observeMsg(msg)
+		return
+	}
+	// 有消息进入
+	pbft.StateMigrate(msg)
+	pbft.advancePipeline()
+}
 
+func (pbft *PBFT) onStateTimeout() {
+	if pbft.StopFlag || pbft.observer {
+		return
 	}
+	// 有超时 则进入viewchang状态 发起viewchange消息
+	// 如果等待NewView超时 说明新视图的主节点也有问题 继续尝试下一个视图
+	if pbft.CurrentState() == model.States_ViewChanging && pbft.sm.waitingNewView {
+		pbft.logger.Debugf("等待NewView超时 尝试下一个视图")
+		pbft.ws.IncreaseView()
+		pbft.sm.waitingNewView = false
+	}
+	pbft.sm.failedViews++
+	viewChangeCount.Inc()
+	pbft.logger.Debugf("超时 进入ViewChanging状态 下一次超时时间: %v", pbft.stateTimeoutDuration())
+	pbft.emit(&Event{Type: EventViewChange, SeqNum: pbft.ws.BlockNum + 1, View: pbft.ws.View, State: "timeout"})
+	pbft.sm.event = evTimeout
+	pbft.ChangeState(model.States_ViewChanging)
+	newMsg := pbft.newViewChangeMsg()
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(newMsg))
+	if err != nil {
+		pbft.logger.Errorf("在viewchanging状态 进行消息签名时 发生了错误, err: %v", err)
+		return
+	}
+	pbft.Msgs.InsertMsg(signedMsg)
+	//pbft.AddBroadcastTask(signedMsg)
+}
+
+func (pbft *PBFT) onTryProposal() {
+	// 1. 检查共识引擎是否可以开始 2.是否处于no_started状态 3. 发起提案广播
+	// 重置timer 重置需要先停止 停止的时候要检查是否已经过期 过期可能需要尝试清空通道
+	resetTimer(pbft.tryProposalTimer, pbft.timeouts.tryProposal)
+
+	if pbft.StopFlag {
+		return
+	}
+	// 观察者不提议区块 定时重新订阅共识消息
+	if pbft.observer {
+		pbft.subscribe()
+		return
+	}
+	if pbft.CurrentState() != model.States_NotStartd {
+		return
+	}
+	// 还没到出块时间 或者交易池为空且还不需要心跳区块
+	if !pbft.proposalDue() {
+		return
+	}
+	pbft.logger.Debugf("尝试发起新提案...")
+	pbft.requestNewBlockProposal()
 }
 
 // 注册到网络的消息回调
-func (pbft *PBFT) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer) {
+func (pbft *PBFT) msgOnRecv(modelID string, msgPkg *network.BroadcastMsg, p *network.Peer) {
 	//pbft.logger.Debugf("收到其他节点发来的消息...")
 	if modelID != "consensus" {
 		return
 	}
-	var msgPkg network.BroadcastMsg
-	if json.Unmarshal(msgBytes, &msgPkg) != nil {
-		pbft.logger.Debugf("共识模块收到网络包不能解析")
+	if p != nil && pbft.guard.banned(p.ID, pbft.clock.Now()) {
+		msgDropped.With("banned").Inc()
+		return
+	}
+	if len(msgPkg.Msg) > pbft.limits.maxMsgBytes {
+		pbft.rejectMsg(p, "too_large")
+		return
+	}
+	if msgPkg.MsgType == model.BroadcastMsgType_subscribe_pbft_msg {
+		pbft.onSubscribe(p)
 		return
 	}
 	var pbftMsg model.PbftMessage
 	if proto.Unmarshal(msgPkg.Msg, &pbftMsg) != nil {
 		pbft.logger.Debugf("共识模块收到消息不能解析")
+		pbft.rejectMsg(p, "decode")
 		return
 	}
-	//pbft.logger.Debugf("收到其他节点发来的消息...")
-	pbft.Msgs.InsertMsg(&pbftMsg)
+	if reason := pbft.checkIncoming(&pbftMsg); reason != "" {
+		pbft.rejectMsg(p, reason)
+		return
+	}
+	if pbft.staleMsg(&pbftMsg) {
+		msgDropped.With("stale").Inc()
+		return
+	}
+	msgReceived.With(msgTypeName(&pbftMsg)).Inc()
+	pbft.Msgs.InsertPeerMsg(peerKey(p), pbft.signedByVerifier(&pbftMsg), &pbftMsg)
 }
 
 func (pbft *PBFT) Start() {
@@ -262,6 +346,7 @@ func (pbft *PBFT) Start() {
 func (pbft *PBFT) Stop() {
 	pbft.Lock()
 	pbft.StopFlag = true
+	pbft.sm.event = evStop
 	pbft.ChangeState(model.States_NotStartd)
 	pbft.Unlock()
 }
@@ -0,0 +1,124 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+	"github.com/wupeaking/pbft_impl/network/libp2p"
+)
+
+// LoadVerfierPeerIDs 把验证者公钥转换为peer id 验证者集合变化后需要重新加载
+func (pbft *PBFT) LoadVerfierPeerIDs() {
+	ids := make(map[string]string, len(pbft.ws.Verifiers))
+	for _, v := range pbft.ws.Verifiers {
+		id, err := libp2p.PublicString2PeerID(fmt.Sprintf("0x%x", v.PublickKey))
+		if err != nil {
+			pbft.logger.Warnf("验证者公钥不能转换为peer id 公钥: 0x%x, err: %v", v.PublickKey, err)
+			continue
+		}
+		ids[id] = string(v.PublickKey)
+	}
+	pbft.peerIDLock.Lock()
+	pbft.verifierPeerID = ids
+	pbft.peerIDLock.Unlock()
+}
+
+// verifierPeers 验证者对应的peer 不包含本节点 signers不为空时只返回这些验证者
+func (pbft *PBFT) verifierPeers(signers [][]byte) []*network.Peer {
+	pbft.peerIDLock.RLock()
+	defer pbft.peerIDLock.RUnlock()
+	peers := make([]*network.Peer, 0, len(pbft.verifierPeerID))
+	for id, signer := range pbft.verifierPeerID {
+		if pbft.ws.CurVerfier != nil && signer == string(pbft.ws.CurVerfier.PublickKey) {
+			continue
+		}
+		if signers != nil && !containsSigner(signers, []byte(signer)) {
+			continue
+		}
+		peers = append(peers, &network.Peer{ID: id})
+	}
+	// 固定发送顺序
+	sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+	return peers
+}
+
+func containsSigner(signers [][]byte, signer []byte) bool {
+	for _, s := range signers {
+		if bytes.Equal(s, signer) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendToVerifiers 只向已经连接的验证者发送消息 signers为nil时发送给所有验证者和订阅的观察者
+// 没有任何一个目标验证者直接相连时(比如网络层的peer id不是由验证者公钥生成) 退回到向所有节点广播
+func (pbft *PBFT) sendToVerifiers(msg *model.PbftMessage, signers [][]byte) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	msgPkg := network.BroadcastMsg{
+		ModelID: "consensus",
+		MsgType: model.BroadcastMsgType_send_pbft_msg,
+		Msg:     body,
+	}
+	connected := make(map[string]bool)
+	if peers, err := pbft.switcher.Peers(); err == nil {
+		for _, p := range peers {
+			connected[p.ID] = true
+		}
+	}
+	targets := make([]*network.Peer, 0)
+	for _, p := range pbft.verifierPeers(signers) {
+		if connected[p.ID] {
+			targets = append(targets, p)
+		}
+	}
+	if len(targets) == 0 {
+		if signers != nil {
+			// 缺少投票的验证者都没有直接相连 不需要重传
+			return nil
+		}
+		return pbft.switcher.Broadcast("consensus", &msgPkg)
+	}
+	if signers == nil {
+		targets = append(targets, pbft.observerPeers()...)
+	}
+	for _, p := range targets {
+		if err := pbft.switcher.BroadcastToPeer("consensus", &msgPkg, p); err != nil {
+			pbft.logger.Debugf("向验证者%s发送消息失败 err: %v", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// missingVoters 在此位置还没有收到其消息的验证者 不包含本节点
+func (pbft *PBFT) missingVoters(seq, view uint64, msgType model.MessageType) [][]byte {
+	missing := make([][]byte, 0)
+	for _, v := range pbft.ws.Verifiers {
+		if pbft.ws.CurVerfier != nil && bytes.Equal(v.PublickKey, pbft.ws.CurVerfier.PublickKey) {
+			continue
+		}
+		if pbft.FindStateMsgBySinger(seq, view, msgType, v.PublickKey) == nil {
+			missing = append(missing, v.PublickKey)
+		}
+	}
+	return missing
+}
+
+// retransmit 重传消息 只发送给还没有投出同类型票的验证者
+func (pbft *PBFT) retransmit(msg *model.PbftMessage, info *model.PbftMessageInfo) error {
+	missing := pbft.missingVoters(info.SeqNum, info.View, info.MsgType)
+	if len(missing) == 0 {
+		return nil
+	}
+	if pbft.fault != nil {
+		return pbft.faultBroadcast(msg)
+	}
+	return pbft.sendToVerifiers(msg, missing)
+}
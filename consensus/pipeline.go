@@ -0,0 +1,236 @@
+package consensus
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/cvm"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	pipeline: 流水线共识
+	低水位为已经提交的高度 高水位为低水位加上窗口大小
+	当前高度(低水位+1)仍由状态机处理 commit严格按高度顺序进行
+	低水位+2到高水位之间的高度 只要前一个高度已经有了提议 就可以提前进行PrePrepare和Prepare阶段
+	提前提议的区块指向前一个高度还未提交的区块 区块中的交易在祖先区块执行后的状态上模拟执行
+	验证者变更生效高度及以后的区块要使用新的验证者集合和主节点 流水线不跨过还未切换的验证者变更
+	viewchange之后 新视图按NewView中各高度的prepared证书重新提议流水线中的区块
+*/
+
+// pipelineWindow 流水线窗口大小 最小为1 即只处理当前高度
+func (pbft *PBFT) pipelineWindow() uint64 {
+	if pbft.cfg.ConsensusCfg.PipelineWindow <= 1 {
+		return 1
+	}
+	return uint64(pbft.cfg.ConsensusCfg.PipelineWindow)
+}
+
+// watermarks 当前的低水位和高水位
+func (pbft *PBFT) watermarks() (uint64, uint64) {
+	low := pbft.ws.BlockNum
+	return low, low + pbft.pipelineWindow()
+}
+
+// acceptableSeq 是否接收此高度的消息 其他节点可能已经先提交了区块 所以比高水位多接收一个窗口
+func (pbft *PBFT) acceptableSeq(seq uint64) bool {
+	_, high := pbft.watermarks()
+	return seq <= high+pbft.pipelineWindow()
+}
+
+// findBlockByID 在消息日志中查找指定高度下的区块 不区分视图
+func (pbft *PBFT) findBlockByID(num uint64, blockID string) *model.PbftBlock {
+	pbft.mm.BlockViewLock.RLock()
+	views := make([]uint64, 0, len(pbft.mm.BlockView[num]))
+	for v := range pbft.mm.BlockView[num] {
+		views = append(views, v)
+	}
+	pbft.mm.BlockViewLock.RUnlock()
+	for _, v := range views {
+		if blk := pbft.FindBlock(num, v); blk != nil && blk.BlockId == blockID {
+			return blk
+		}
+	}
+	return nil
+}
+
+// pendingAncestors seq之前还未提交的祖先区块 按高度从高到低排列
+func (pbft *PBFT) pendingAncestors(seq uint64, prev string) []*model.PbftBlock {
+	ancestors := make([]*model.PbftBlock, 0)
+	for n := seq - 1; n > pbft.ws.BlockNum && n > 0; n-- {
+		blk := pbft.findBlockByID(n, prev)
+		if blk == nil {
+			break
+		}
+		ancestors = append(ancestors, blk)
+		prev = blk.PrevBlock
+	}
+	return ancestors
+}
+
+// chainSnapshot 依次模拟执行seq之前还未提交的祖先区块 得到seq高度执行前的状态
+func (pbft *PBFT) chainSnapshot(seq uint64, prev string) *cvm.Snapshot {
+	snap := cvm.NewSnapshot()
+	ancestors := pbft.pendingAncestors(seq, prev)
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		for _, tx := range ancestors[i].Tansactions.GetTansactions() {
+			pbft.vm.Eval(tx, snap)
+		}
+	}
+	return snap
+}
+
+// advancePipeline 提前处理当前高度之后 高水位以内的高度
+func (pbft *PBFT) advancePipeline() {
+	if pbft.pipelineWindow() <= 1 || pbft.StopFlag || pbft.CurrentState() == model.States_ViewChanging {
+		return
+	}
+	if !pbft.IsVaildVerifier(pbft.ws.CurVerfier.PublickKey) {
+		return
+	}
+	view := pbft.ws.View
+	low, high := pbft.watermarks()
+	for seq := low + 2; seq <= high; seq++ {
+		// 本节点需要已经对前一个高度投过票 才能继续处理后面的高度
+		prev := pbft.FindStateMsgBySinger(seq-1, view, model.MessageType_Prepare, pbft.ws.CurVerfier.PublickKey)
+		if prev == nil || prev.GenericMsg.Info.BlockId != pbft.proposalDigest(seq-1, view) {
+			return
+		}
+		prevID := prev.GenericMsg.Info.BlockId
+		if pbft.crossesValidatorChange(seq, prevID) {
+			return
+		}
+		if pbft.proposalDigest(seq, view) == "" {
+			if bytes.Compare(pbft.primarySigner(seq, view), pbft.ws.CurVerfier.PublickKey) != 0 {
+				return
+			}
+			if !pbft.proposeAhead(seq, view, prevID) {
+				return
+			}
+		}
+		if !pbft.prepareAhead(seq, view, prevID) {
+			return
+		}
+	}
+}
+
+// crossesValidatorChange seq高度是否可能使用和当前不同的验证者集合
+// 已经提交等待生效的变更 以及还未提交的祖先区块中的变更交易都需要考虑 等切换之后再处理这些高度
+func (pbft *PBFT) crossesValidatorChange(seq uint64, prev string) bool {
+	if next := pbft.ws.NextValidatorChange(); next != 0 && seq >= next {
+		return true
+	}
+	for _, blk := range pbft.pendingAncestors(seq, prev) {
+		for _, tx := range blk.Tansactions.GetTansactions() {
+			if !tx.IsValidatorChange() {
+				continue
+			}
+			// 无法解析的变更交易不会生效 但是执行结果还不确定 按会生效处理
+			c, err := tx.DecodeValidatorChange()
+			if err != nil || seq >= c.EffectiveHeight {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reproposal 新视图中seq高度需要重新提议的区块 没有时返回nil
+func (pbft *PBFT) reproposal(seq, view uint64) *model.PbftBlock {
+	if pbft.sm.reproposalView != view {
+		return nil
+	}
+	return pbft.sm.reproposals[seq]
+}
+
+// conflictsReproposal 新视图中提议的区块是否和prepared证书中的区块不一致
+func (pbft *PBFT) conflictsReproposal(seq, view uint64, blockID string) bool {
+	blk := pbft.reproposal(seq, view)
+	return blk != nil && blk.BlockId != blockID
+}
+
+// proposeAhead 作为主节点提前提议区块 交易池中没有新交易时不提议
+func (pbft *PBFT) proposeAhead(seq, view uint64, prev string) bool {
+	var blk *model.PbftBlock
+	if re := pbft.reproposal(seq, view); re != nil {
+		if re.PrevBlock != prev {
+			return false
+		}
+		blk = proto.Clone(re).(*model.PbftBlock)
+	} else {
+		var err error
+		blk, err = pbft.packageBlockAt(seq, prev)
+		if err != nil {
+			pbft.logger.Warnf("流水线打包区块失败 高度: %d, err: %v", seq, err)
+			return false
+		}
+		if len(blk.Tansactions.Tansactions) == 0 {
+			return false
+		}
+		if err := pbft.checkBlockPolicy(blk); err != nil {
+			return false
+		}
+	}
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&model.PbftGenericMessage{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_PrePrepare,
+			View: view, SeqNum: seq,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+		},
+		Block: blk,
+	}))
+	if err != nil {
+		pbft.logger.Warnf("流水线中发起pre-prepare消息时 签名发生错误 err: %v", err)
+		return false
+	}
+	pbft.logger.Debugf("流水线提前提议区块 高度: %d, 视图: %d, 交易数量: %d", seq, view, len(blk.Tansactions.Tansactions))
+	return pbft.appendAndBroadcast(signedMsg)
+}
+
+// prepareAhead 对提前提议的区块签名并发出prepare消息
+func (pbft *PBFT) prepareAhead(seq, view uint64, prev string) bool {
+	if pbft.FindStateMsgBySinger(seq, view, model.MessageType_Prepare, pbft.ws.CurVerfier.PublickKey) != nil {
+		return true
+	}
+	digest := pbft.proposalDigest(seq, view)
+	blk := pbft.FindBlock(seq, view)
+	if blk == nil || blk.BlockId != digest || blk.PrevBlock != prev {
+		return false
+	}
+	if pbft.conflictsReproposal(seq, view, digest) {
+		pbft.logger.Warnf("流水线中提议的区块和prepared证书不一致 高度: %d, 视图: %d", seq, view)
+		return false
+	}
+	// 收到区块时祖先区块可能还不完整 投票前重新模拟执行一次
+	if err := pbft.TryApplyBlock(blk); err != nil {
+		pbft.logger.Debugf("流水线中的区块执行失败 高度: %d, err: %v", seq, err)
+		return false
+	}
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&model.PbftGenericMessage{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare,
+			View: view, SeqNum: seq,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+			BlockId:  digest,
+		},
+		Block: proto.Clone(blk).(*model.PbftBlock),
+	}))
+	if err != nil {
+		pbft.logger.Warnf("流水线中发起prepare消息时 签名发生错误 err: %v", err)
+		return false
+	}
+	return pbft.appendAndBroadcast(signedMsg)
+}
+
+// appendAndBroadcast 追加到消息日志并立即广播 标记为已广播
+func (pbft *PBFT) appendAndBroadcast(msg *model.PbftMessage) bool {
+	gm := msg.GetGeneric()
+	if !pbft.AppendMsg(msg) {
+		return false
+	}
+	pbft.broadcastStateMsg(msg)
+	if sm := pbft.FindStateMsgBySinger(gm.Info.SeqNum, gm.Info.View, gm.Info.MsgType, gm.Info.SignerId); sm != nil {
+		sm.Lock()
+		sm.Broadcast = true
+		sm.Unlock()
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package consensus
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 默认的出块限制 配置中没有设置时使用
+const (
+	defaultMaxBlockTxs      = 3000
+	defaultMaxBlockBytes    = 4 << 20
+	defaultMaxBlockInterval = 60
+	defaultMaxClockSkew     = 30
+)
+
+// blockPolicy 出块策略 所有验证者在TryApplyBlock中按同样的规则校验
+type blockPolicy struct {
+	maxTxs      int    // 每个区块最多的交易数量
+	maxBytes    int    // 区块中交易和收据最多的字节数
+	minInterval uint64 // 与前一个区块的最小时间间隔 单位秒
+	maxInterval uint64 // 交易池为空时 超过此间隔仍然出一个空块作为心跳 单位秒
+	skipEmpty   bool   // 交易池为空时不出块
+	maxSkew     uint64 // 区块时间戳最多比本地时间快多少秒
+}
+
+func newBlockPolicy(cfg *config.ConsensusCfg) blockPolicy {
+	p := blockPolicy{
+		maxTxs:      cfg.MaxBlockTxs,
+		maxBytes:    cfg.MaxBlockBytes,
+		minInterval: uint64(cfg.MinBlockInterval),
+		maxInterval: uint64(cfg.MaxBlockInterval),
+		skipEmpty:   cfg.SkipEmptyBlocks,
+		maxSkew:     uint64(cfg.MaxClockSkew),
+	}
+	if p.maxTxs <= 0 {
+		p.maxTxs = defaultMaxBlockTxs
+	}
+	if p.maxBytes <= 0 {
+		p.maxBytes = defaultMaxBlockBytes
+	}
+	if p.maxInterval == 0 {
+		p.maxInterval = defaultMaxBlockInterval
+	}
+	if p.maxSkew == 0 {
+		p.maxSkew = defaultMaxClockSkew
+	}
+	if p.maxInterval < p.minInterval {
+		p.maxInterval = p.minInterval
+	}
+	return p
+}
+
+// blockBodySize 区块中交易和收据的字节数
+func blockBodySize(blk *model.PbftBlock) int {
+	return proto.Size(blk.Tansactions) + proto.Size(blk.TransactionReceipts)
+}
+
+// elemSize 交易或收据在Txs/TxReceipts中占用的字节数 包括repeated字段的标签和长度前缀
+// 打包时逐个累加的结果和blockBodySize相同
+func elemSize(m proto.Message) int {
+	return protowire.SizeTag(1) + protowire.SizeBytes(proto.Size(m))
+}
+
+// prevBlockTime 前一个区块的时间戳 前一个区块可能还在流水线中未提交 找不到时返回false
+func (pbft *PBFT) prevBlockTime(seq uint64, prev string) (uint64, bool) {
+	if seq <= 1 {
+		return 0, false
+	}
+	if blk := pbft.findBlockByID(seq-1, prev); blk != nil {
+		return blk.TimeStamp, true
+	}
+	blk, err := pbft.ws.GetBlock(seq - 1)
+	if err != nil || blk == nil || blk.BlockId != prev {
+		return 0, false
+	}
+	return blk.TimeStamp, true
+}
+
+// checkBlockPolicy 检查区块是否满足出块策略
+func (pbft *PBFT) checkBlockPolicy(blk *model.PbftBlock) error {
+	p := pbft.policy
+	txs := len(blk.Tansactions.GetTansactions())
+	if txs > p.maxTxs {
+		return fmt.Errorf("区块交易数量%d 超过上限%d", txs, p.maxTxs)
+	}
+	if size := blockBodySize(blk); size > p.maxBytes {
+		return fmt.Errorf("区块大小%d字节 超过上限%d字节", size, p.maxBytes)
+	}
+	// 时间戳在未来的区块提交后 诚实的主节点要等到这个时间之后才能出块
+	if now := uint64(pbft.clock.Now().Unix()); blk.TimeStamp > now+p.maxSkew {
+		return fmt.Errorf("区块时间戳%d 比本地时间%d快了超过%d秒", blk.TimeStamp, now, p.maxSkew)
+	}
+	prevTime, ok := pbft.prevBlockTime(blk.BlockNum, blk.PrevBlock)
+	if !ok {
+		return nil
+	}
+	if blk.TimeStamp < prevTime+p.minInterval {
+		return fmt.Errorf("距离前一个区块不足%d秒", p.minInterval)
+	}
+	if p.skipEmpty && txs == 0 && blk.TimeStamp < prevTime+p.maxInterval {
+		return fmt.Errorf("空区块距离前一个区块不足%d秒", p.maxInterval)
+	}
+	return nil
+}
+
+// proposalDue 是否到了出块的时间 交易池为空时只在超过最大间隔后出心跳区块
+func (pbft *PBFT) proposalDue() bool {
+	p := pbft.policy
+	if p.minInterval == 0 && !p.skipEmpty {
+		return true
+	}
+	last, err := pbft.ws.GetBlock(pbft.ws.BlockNum)
+	if err != nil || last == nil {
+		return true
+	}
+	now := uint64(pbft.clock.Now().Unix())
+	if now < last.TimeStamp+p.minInterval {
+		return false
+	}
+	if p.skipEmpty && pbft.txPool.Len() == 0 && now < last.TimeStamp+p.maxInterval {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+)
+
+func TestCheckBlockPolicy(t *testing.T) {
+	pbft := &PBFT{mm: NewMsgManager(), ws: world_state.New(cache.NewMemory(), ""), clock: realClock{},
+		policy: newBlockPolicy(&config.ConsensusCfg{MaxBlockTxs: 1, MinBlockInterval: 2, MaxBlockInterval: 10, SkipEmptyBlocks: true})}
+	prev := &model.PbftBlock{BlockNum: 1, BlockId: "prev", TimeStamp: 100}
+	pbft.mm.addBlock(1, 0, prev)
+
+	block := func(ts uint64, txs int) *model.PbftBlock {
+		blk := &model.PbftBlock{BlockNum: 2, PrevBlock: "prev", TimeStamp: ts,
+			Tansactions: &model.Txs{}, TransactionReceipts: &model.TxReceipts{}}
+		for i := 0; i < txs; i++ {
+			blk.Tansactions.Tansactions = append(blk.Tansactions.Tansactions, &model.Tx{Sequeue: "1"})
+		}
+		return blk
+	}
+	cases := []struct {
+		blk *model.PbftBlock
+		ok  bool
+	}{
+		{block(103, 1), true},
+		{block(101, 1), false}, // 小于最小间隔
+		{block(103, 2), false}, // 超过交易数量上限
+		{block(105, 0), false}, // 空块还不到心跳间隔
+		{block(110, 0), true},
+		{block(uint64(time.Now().Unix())+3600, 1), false}, // 时间戳比本地时间快太多
+	}
+	for i, c := range cases {
+		if err := pbft.checkBlockPolicy(c.blk); (err == nil) != c.ok {
+			t.Fatalf("case %d: 期望%v err: %v", i, c.ok, err)
+		}
+	}
+}
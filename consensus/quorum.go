@@ -0,0 +1,43 @@
+package consensus
+
+import (
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+// 所有计算法定数量的地方都使用hasQuorum 按投票权重计算 规则见model.HasQuorum
+
+// hasQuorum 签名者的投票权重之和是否超过当前验证者集合总权重的2/3
+func (pbft *PBFT) hasQuorum(signers [][]byte) bool {
+	return model.HasQuorum(pbft.ws.Verifiers, signers)
+}
+
+// blockHasQuorum 区块上的签名者是否达到法定数量 只统计签名者 不校验签名
+func (pbft *PBFT) blockHasQuorum(blk *model.PbftBlock) bool {
+	return pbft.hasQuorum(blockSigners(blk))
+}
+
+// blockSigners 区块的主节点和其他签名者
+func blockSigners(blk *model.PbftBlock) [][]byte {
+	signers := make([][]byte, 0, len(blk.SignPairs)+1)
+	signers = append(signers, blk.SignerId)
+	for _, pair := range blk.SignPairs {
+		signers = append(signers, pair.SignerId)
+	}
+	return signers
+}
+
+func msgSigners(msgs []*StateMsg) [][]byte {
+	signers := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		signers = append(signers, m.Signer)
+	}
+	return signers
+}
+
+func keySigners(m map[string]struct{}) [][]byte {
+	signers := make([][]byte, 0, len(m))
+	for s := range m {
+		signers = append(signers, []byte(s))
+	}
+	return signers
+}
@@ -0,0 +1,101 @@
+package consensus
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network/memnet"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+)
+
+func TestQuorumEqualPower(t *testing.T) {
+	// 权重相同时和之前的规则一致 3个及以下需要全部签名 4个需要3个
+	cases := []struct{ n, need int }{{1, 1}, {2, 2}, {3, 3}, {4, 3}, {7, 5}}
+	for _, c := range cases {
+		verifiers := make([]*model.Verifier, 0, c.n)
+		signers := make([][]byte, 0, c.n)
+		for i := 0; i < c.n; i++ {
+			verifiers = append(verifiers, &model.Verifier{PublickKey: []byte{byte(i)}})
+			signers = append(signers, []byte{byte(i)})
+		}
+		if model.HasQuorum(verifiers, signers[:c.need-1]) || !model.HasQuorum(verifiers, signers[:c.need]) {
+			t.Fatalf("%d个验证者时需要%d个签名", c.n, c.need)
+		}
+	}
+}
+
+func TestQuorumWeighted(t *testing.T) {
+	verifiers := []*model.Verifier{
+		{PublickKey: []byte{1}, Weight: 4},
+		{PublickKey: []byte{2}, Weight: 1},
+		{PublickKey: []byte{3}, Weight: 1},
+		{PublickKey: []byte{4}, Weight: 1},
+	}
+	// 总权重7 需要超过14/3 即至少5
+	if model.HasQuorum(verifiers, [][]byte{{2}, {3}, {4}}) {
+		t.Fatalf("权重之和为3时不应该达成共识")
+	}
+	if model.HasQuorum(verifiers, [][]byte{{1}, {1}, {9}}) {
+		t.Fatalf("重复的签名者和不是验证者的签名者不应该计算")
+	}
+	if !model.HasQuorum(verifiers, [][]byte{{1}, {3}}) {
+		t.Fatalf("权重之和为5时应该达成共识")
+	}
+
+	bitmap := model.SignerBitmap(verifiers, [][]byte{{1}, {4}})
+	signers := model.BitmapSigners(verifiers, bitmap)
+	if len(signers) != 2 || signers[0][0] != 1 || signers[1][0] != 4 {
+		t.Fatalf("签名位图解析错误: %v", signers)
+	}
+	if model.BitmapSigners(verifiers[:3], append(bitmap, 0)) != nil {
+		t.Fatalf("位图长度不一致时应该返回nil")
+	}
+}
+
+func TestSplitPrepareNoQuorum(t *testing.T) {
+	net := memnet.New(1)
+	defer net.Close()
+	switcher, err := net.NewSwitcher("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := world_state.New(cache.NewMemory(), "")
+	for i := 1; i <= 4; i++ {
+		ws.Verifiers = append(ws.Verifiers, &model.Verifier{PublickKey: []byte{byte(i)}})
+	}
+	pbft := &PBFT{mm: NewMsgManager(), ws: ws, cfg: &config.Configure{}, clock: realClock{},
+		events: newEventBus(), logger: log.NewEntry(log.New()), switcher: switcher}
+	prepare := func(signer byte, blockID string) *model.PbftMessage {
+		return model.NewPbftMessage(&model.PbftGenericMessage{Info: &model.PbftMessageInfo{
+			MsgType: model.MessageType_Prepare, SeqNum: 1, View: 0, SignerId: []byte{signer}, BlockId: blockID}})
+	}
+	// 3个prepare分别投给两个区块 总数达到2f+1 但每个区块都没有达到法定数量
+	for _, m := range []*model.PbftMessage{prepare(1, "a"), prepare(2, "a"), prepare(3, "b")} {
+		if !pbft.AppendMsg(m) {
+			t.Fatalf("prepare消息应该被追加")
+		}
+	}
+	if len(pbft.FindStateMsg(1, 0, model.MessageType_Prepare)) != 3 {
+		t.Fatalf("应该记录3个prepare消息")
+	}
+	for _, id := range []string{"a", "b"} {
+		if pbft.hasQuorum(msgSigners(pbft.FindStateMsgByDigest(1, 0, model.MessageType_Prepare, id))) {
+			t.Fatalf("区块%s的投票不应该达到法定数量", id)
+		}
+	}
+
+	// 同一个签名者再对另一个区块投票 不计入投票 记录为双签
+	if pbft.AppendMsg(prepare(1, "b")) {
+		t.Fatalf("双签的投票不应该被追加")
+	}
+	if n := len(pbft.FindStateMsgByDigest(1, 0, model.MessageType_Prepare, "b")); n != 1 {
+		t.Fatalf("双签的投票不应该被计算 区块b的投票数: %d", n)
+	}
+	evs := pbft.Equivocations()
+	if len(evs) != 1 || evs[0].Evidence.First.BlockId != "a" || evs[0].Evidence.Second.BlockId != "b" {
+		t.Fatalf("应该记录一条双签证据 %v", evs)
+	}
+}
@@ -0,0 +1,156 @@
+package consensus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+// 默认的消息限制 配置中没有设置时使用
+const (
+	defaultMsgQueueSize   = 128
+	defaultMaxMsgBytes    = 8 << 20
+	defaultMaxInvalidMsgs = 10
+	invalidMsgWindow      = time.Minute
+)
+
+// msgLimits 收到共识消息时的检查
+type msgLimits struct {
+	maxMsgBytes    int // 单条消息最多的字节数
+	maxInvalidMsgs int // 一个窗口内每个peer最多发送的无效消息数量 超过后断开连接
+}
+
+func newMsgLimits(cfg *config.ConsensusCfg) msgLimits {
+	l := msgLimits{maxMsgBytes: cfg.MaxMsgBytes, maxInvalidMsgs: cfg.MaxInvalidMsgs}
+	if l.maxMsgBytes <= 0 {
+		l.maxMsgBytes = defaultMaxMsgBytes
+	}
+	if l.maxInvalidMsgs <= 0 {
+		l.maxInvalidMsgs = defaultMaxInvalidMsgs
+	}
+	return l
+}
+
+// peerGuard 记录每个peer发送的无效消息 超过上限的peer在窗口结束前不再处理其消息
+type peerGuard struct {
+	sync.Mutex
+	limit  int
+	window time.Duration
+	peers  map[string]*peerViolations
+}
+
+type peerViolations struct {
+	start  time.Time
+	count  int
+	banned bool
+}
+
+func newPeerGuard(limit int, window time.Duration) *peerGuard {
+	return &peerGuard{limit: limit, window: window, peers: make(map[string]*peerViolations)}
+}
+
+// report 记录一次无效消息 刚好超过上限时返回true
+func (g *peerGuard) report(id string, now time.Time) bool {
+	g.Lock()
+	defer g.Unlock()
+	v, ok := g.peers[id]
+	if !ok || now.Sub(v.start) > g.window {
+		v = &peerViolations{start: now}
+		g.peers[id] = v
+	}
+	v.count++
+	if v.count > g.limit && !v.banned {
+		v.banned = true
+		return true
+	}
+	return false
+}
+
+// banned peer是否还在禁止期内
+func (g *peerGuard) banned(id string, now time.Time) bool {
+	g.Lock()
+	defer g.Unlock()
+	v, ok := g.peers[id]
+	if !ok {
+		return false
+	}
+	if now.Sub(v.start) > g.window {
+		delete(g.peers, id)
+		return false
+	}
+	return v.banned
+}
+
+// checkIncoming 在入队之前检查消息 返回不为空时表示消息无效及原因
+// 只检查区块大小和签名 其他和状态有关的检查在处理消息时进行
+func (pbft *PBFT) checkIncoming(msg *model.PbftMessage) string {
+	if gm := msg.GetGeneric(); gm != nil && gm.Block != nil && blockBodySize(gm.Block) > pbft.policy.maxBytes {
+		return "block_too_large"
+	}
+	info := msgInfoOf(msg)
+	if info == nil {
+		return ""
+	}
+	// 签名者不是当前的验证者时 可能是验证者集合还没有同步 不算作恶
+	if pbft.IsVaildVerifier(info.SignerId) && !pbft.verifyInfoSign(info) {
+		return "invalid_sign"
+	}
+	return ""
+}
+
+// signedByVerifier 消息的签名者是否是当前的验证者 双签证据不区分签名者
+func (pbft *PBFT) signedByVerifier(msg *model.PbftMessage) bool {
+	info := msgInfoOf(msg)
+	return info == nil || pbft.IsVaildVerifier(info.SignerId)
+}
+
+// staleMsg 过期的消息 不会再被处理 可能是其他节点的重放 入队之前直接丢弃
+// 低于稳定checkpoint的消息 以及本地已经提交的高度上视图低于当前视图的消息
+// checkpoint消息在已经提交的高度上仍然需要收集 不按视图判断
+func (pbft *PBFT) staleMsg(msg *model.PbftMessage) bool {
+	info := msgInfoOf(msg)
+	if info == nil {
+		return false
+	}
+	if info.SeqNum <= pbft.mm.stableCheckpoint() {
+		return true
+	}
+	num, view := pbft.ws.Progress()
+	return info.MsgType != model.MessageType_Checkpoint && info.SeqNum <= num && info.View < view
+}
+
+// peerKey 消息队列中peer的标识
+func peerKey(p *network.Peer) string {
+	if p == nil {
+		return "unknown"
+	}
+	return p.ID
+}
+
+// rejectEvent 丢弃消息的原因对应的peer行为
+func rejectEvent(reason string) network.PeerEvent {
+	switch reason {
+	case "invalid_sign":
+		return network.EventBadSignature
+	case "block_too_large":
+		return network.EventInvalidBlock
+	}
+	return network.EventBadMessage
+}
+
+// rejectMsg 丢弃peer发来的无效消息 频繁发送无效消息的peer会被断开
+func (pbft *PBFT) rejectMsg(p *network.Peer, reason string) {
+	msgDropped.With(reason).Inc()
+	if p == nil {
+		return
+	}
+	pbft.logger.Debugf("丢弃节点%s发来的无效共识消息 原因: %s", p.ID, reason)
+	network.ReportPeer(pbft.switcher, p, rejectEvent(reason))
+	if pbft.guard.report(p.ID, pbft.clock.Now()) {
+		pbft.logger.Warnf("节点%s 频繁发送无效的共识消息 断开连接", p.ID)
+		pbft.switcher.RemovePeer(p)
+	}
+}
@@ -0,0 +1,52 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+func TestCheckpointTruncate(t *testing.T) {
+	const interval = 5
+	c, err := NewClusterWithConfig(4, 5, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.CheckpointInterval = interval
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stableAtLeast := func(h uint64) bool {
+		for _, r := range c.Replicas {
+			if stable, _ := r.PBFT.StableCheckpoint(); stable < h {
+				return false
+			}
+		}
+		return true
+	}
+	if !c.RunUntil(func() bool { return stableAtLeast(interval) }, 10*time.Minute) {
+		t.Fatalf("checkpoint没有稳定 当前高度: %d", c.MinHeight())
+	}
+	first, _ := c.Replicas[0].PBFT.StableCheckpoint()
+	if !c.RunUntil(func() bool { return stableAtLeast(2*interval + 1) }, 10*time.Minute) {
+		t.Fatalf("超过2个checkpoint间隔后稳定checkpoint没有前进 当前高度: %d", c.MinHeight())
+	}
+
+	for _, r := range c.Replicas {
+		stable, id := r.PBFT.StableCheckpoint()
+		if stable <= first || stable%interval != 0 {
+			t.Fatalf("%s: 稳定checkpoint %d 没有从 %d 前进到checkpoint高度", r.ID, stable, first)
+		}
+		blk, err := r.WS.GetBlock(stable)
+		if err != nil || blk == nil || blk.BlockId != id {
+			t.Fatalf("%s: 稳定checkpoint的区块ID %s 与提交的区块不一致", r.ID, id)
+		}
+		for _, h := range r.PBFT.LoggedHeights() {
+			if h <= stable {
+				t.Fatalf("%s: 稳定checkpoint %d 以下仍保留高度 %d 的日志", r.ID, stable, h)
+			}
+		}
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,125 @@
+package sim
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/consensus"
+)
+
+// Clock 虚拟时钟 只有调用Advance时时间才会前进 到期的定时器按到期时间和创建顺序触发
+type Clock struct {
+	sync.Mutex
+	now    time.Time
+	nextID int
+	timers []*timer
+}
+
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) consensus.Timer {
+	return c.addTimer(d, 0)
+}
+
+func (c *Clock) NewTicker(d time.Duration) consensus.Ticker {
+	return &ticker{c.addTimer(d, d)}
+}
+
+func (c *Clock) addTimer(d, period time.Duration) *timer {
+	c.Lock()
+	defer c.Unlock()
+	t := &timer{
+		clock:  c,
+		id:     c.nextID,
+		ch:     make(chan time.Time, 1),
+		when:   c.now.Add(d),
+		period: period,
+		active: true,
+	}
+	c.nextID++
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance 时间前进d 期间到期的定时器依次触发
+func (c *Clock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	target := c.now.Add(d)
+	for {
+		var next *timer
+		for _, t := range c.timers {
+			if !t.active || t.when.After(target) {
+				continue
+			}
+			if next == nil || t.when.Before(next.when) || (t.when.Equal(next.when) && t.id < next.id) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.when
+		// 和time.Timer一致 通道中已有未读取的值时丢弃本次触发
+		select {
+		case next.ch <- c.now:
+		default:
+		}
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			next.active = false
+		}
+	}
+	c.now = target
+}
+
+type timer struct {
+	clock  *Clock
+	id     int
+	ch     chan time.Time
+	when   time.Time
+	period time.Duration
+	active bool
+}
+
+func (t *timer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+func (t *timer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *timer) Reset(d time.Duration) bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	active := t.active
+	t.when = t.clock.now.Add(d)
+	t.active = true
+	return active
+}
+
+type ticker struct {
+	t *timer
+}
+
+func (t *ticker) Chan() <-chan time.Time {
+	return t.t.ch
+}
+
+func (t *ticker) Stop() {
+	t.t.Stop()
+}
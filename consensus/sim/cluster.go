@@ -0,0 +1,296 @@
+package sim
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/consensus"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/cvm"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network/libp2p"
+	"github.com/wupeaking/pbft_impl/network/memnet"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+	"github.com/wupeaking/pbft_impl/transaction"
+)
+
+/*
+	sim: 在一个进程内运行多个共识节点
+	所有节点共享一个虚拟时钟和一个手动投递的memnet内存网络 不启动任何goroutine
+	每一轮先让所有节点处理完就绪的事件 并逐条投递到期的网络消息 然后虚拟时钟前进一个Tick
+	链路的延迟 抖动 丢包和分区通过Net设置 延迟按虚拟时钟计算
+	消息投递顺序由种子决定 相同的种子得到相同的运行过程
+*/
+
+type Replica struct {
+	ID       string
+	PBFT     *consensus.PBFT
+	WS       *world_state.WroldState
+	Switcher *memnet.Switcher
+	TxPool   *transaction.TxPool
+	DB       *cache.DBCache
+	Cfg      *config.Configure
+}
+
+type Cluster struct {
+	Clock    *Clock
+	Net      *memnet.Network
+	Replicas []*Replica
+	// 每一轮虚拟时钟前进的时间
+	Tick time.Duration
+	// 创世区块中的验证者
+	verifiers []*model.Verifier
+}
+
+// NewCluster 创建n个验证节点组成的集群
+func NewCluster(n int, seed int64) (*Cluster, error) {
+	return NewClusterWithConfig(n, seed, nil)
+}
+
+// NewClusterWithConfig 创建集群 setup可以修改每个节点的配置 比如开启故障注入
+func NewClusterWithConfig(n int, seed int64, setup func(i int, cfg *config.Configure)) (*Cluster, error) {
+	c := &Cluster{
+		Clock: NewClock(time.Unix(1600000000, 0)),
+		Tick:  100 * time.Millisecond,
+	}
+	c.Net = memnet.NewManual(seed, c.Clock.Now)
+
+	type keyPair struct{ pub, priv []byte }
+	keys := make([]keyPair, 0, n)
+	verifiers := make([]*model.Verifier, 0, n)
+	for i := 0; i < n; i++ {
+		priv, pub, err := generateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, keyPair{pub: pub, priv: priv})
+		verifiers = append(verifiers, &model.Verifier{PublickKey: pub, SeqNum: int32(i)})
+	}
+
+	for i := 0; i < n; i++ {
+		cur := &model.Verifier{PublickKey: keys[i].pub, PrivateKey: keys[i].priv, SeqNum: int32(i)}
+		cfg := defaultConfig()
+		if setup != nil {
+			setup(i, cfg)
+		}
+		r, err := c.newReplica(fmt.Sprintf("replica-%d", i), cur, i, keys[i].pub, verifiers, cfg)
+		if err != nil {
+			return nil, err
+		}
+		c.Replicas = append(c.Replicas, r)
+	}
+	c.verifiers = verifiers
+	return c, nil
+}
+
+func defaultConfig() *config.Configure {
+	cfg := &config.Configure{}
+	cfg.ConsensusCfg.LogLevel = "error"
+	cfg.ConsensusCfg.WALPath = consensus.MemoryWAL
+	cfg.TxCfg.MaxTxNum = 10000
+	cfg.TxCfg.LogLevel = "error"
+	cfg.ConsensusCfg.TestNet = true
+	return cfg
+}
+
+// AddObserver 添加一个不是验证者的观察者节点 只跟随共识 不投票
+func (c *Cluster) AddObserver() (*Replica, error) {
+	_, pub, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	cfg := defaultConfig()
+	cfg.ConsensusCfg.Observer = true
+	r, err := c.newReplica(fmt.Sprintf("observer-%d", len(c.Replicas)), nil, -1, pub, c.verifiers, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.Replicas = append(c.Replicas, r)
+	return r, nil
+}
+
+// newReplica 创建一个节点 cur为nil时节点不是验证者
+func (c *Cluster) newReplica(id string, cur *model.Verifier, no int, pub []byte, verifiers []*model.Verifier,
+	cfg *config.Configure) (*Replica, error) {
+	db := cache.NewMemory()
+	ws := world_state.New(db, "")
+	genesis := &model.Genesis{Verifiers: verifiers}
+	if err := ws.SetGenesis(genesis); err != nil {
+		return nil, err
+	}
+	ws.CurVerfier = cur
+	ws.VerifierNo = no
+	ws.SetValue(0, "", model.GenesisBlockId, verifiers)
+	if err := ws.UpdateLastWorldState(); err != nil {
+		return nil, err
+	}
+	if _, err := ws.GetBlockMeta(); err != nil {
+		return nil, err
+	}
+	for _, a := range cfg.AccountCfg {
+		acc := &model.Account{
+			Id:          &model.Address{Address: a.Address},
+			Balance:     &model.Amount{Amount: fmt.Sprintf("%d", a.Amount)},
+			AccountType: int32(a.Type),
+		}
+		if err := db.Insert(acc); err != nil {
+			return nil, err
+		}
+	}
+
+	// 节点在网络中的id由公钥生成 和libp2p网络一致
+	peerID, err := libp2p.PublicString2PeerID(fmt.Sprintf("0x%x", pub))
+	if err != nil {
+		return nil, err
+	}
+	sw, err := c.Net.NewSwitcher(peerID)
+	if err != nil {
+		return nil, err
+	}
+	vm := cvm.New(db, cfg)
+	txPool := transaction.NewTxPool(sw, cfg, db)
+	pbft, err := consensus.New(ws, txPool, sw, vm, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pbft.SetClock(c.Clock)
+	pbft.Start()
+	return &Replica{ID: id, PBFT: pbft, WS: ws, Switcher: sw, TxPool: txPool, DB: db, Cfg: cfg}, nil
+}
+
+// generateKey 生成公钥长度固定为64字节的密钥对
+func generateKey() ([]byte, []byte, error) {
+	for {
+		privHex, pubHex, err := cryptogo.GenerateKeyPairs()
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, err := cryptogo.Hex2Bytes(pubHex)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(pub) != 64 {
+			continue
+		}
+		priv, err := cryptogo.Hex2Bytes(privHex)
+		if err != nil {
+			return nil, nil, err
+		}
+		return priv, pub, nil
+	}
+}
+
+// Crash 节点宕机 不再处理任何事件 收发的消息全部丢失
+func (c *Cluster) Crash(i int) {
+	c.Net.SetDown(c.Replicas[i].Switcher.ID(), true)
+}
+
+// Recover 宕机的节点恢复运行
+func (c *Cluster) Recover(i int) {
+	c.Net.SetDown(c.Replicas[i].Switcher.ID(), false)
+}
+
+// Round 处理完所有就绪的事件和网络消息 然后虚拟时钟前进一个Tick
+func (c *Cluster) Round() {
+	for {
+		progressed := false
+		for _, r := range c.Replicas {
+			if c.Net.IsDown(r.Switcher.ID()) {
+				continue
+			}
+			for r.PBFT.Step() {
+				progressed = true
+			}
+		}
+		if c.Net.Deliver() {
+			progressed = true
+		}
+		if !progressed {
+			break
+		}
+	}
+	c.Clock.Advance(c.Tick)
+}
+
+// RunFor 运行指定的虚拟时间
+func (c *Cluster) RunFor(d time.Duration) {
+	end := c.Clock.Now().Add(d)
+	for c.Clock.Now().Before(end) {
+		c.Round()
+	}
+}
+
+// RunUntil 一直运行到cond满足 超过max虚拟时间仍不满足则返回false
+func (c *Cluster) RunUntil(cond func() bool, max time.Duration) bool {
+	end := c.Clock.Now().Add(max)
+	for c.Clock.Now().Before(end) {
+		if cond() {
+			return true
+		}
+		c.Round()
+	}
+	return cond()
+}
+
+// Faulty 节点是否开启了故障注入
+func (r *Replica) Faulty() bool {
+	return r.Cfg.ConsensusCfg.Fault != nil && r.Cfg.ConsensusCfg.Fault.Enable
+}
+
+// SubmitTx 把交易放入所有节点的交易池
+func (c *Cluster) SubmitTx(tx *model.Tx) {
+	for _, r := range c.Replicas {
+		r.TxPool.AddTx(tx)
+	}
+}
+
+// MinHeight 没有宕机且没有作恶的节点中最低的区块高度
+func (c *Cluster) MinHeight() uint64 {
+	min := uint64(0)
+	first := true
+	for _, r := range c.Replicas {
+		if c.Net.IsDown(r.Switcher.ID()) || r.Faulty() {
+			continue
+		}
+		if first || r.WS.BlockNum < min {
+			min = r.WS.BlockNum
+			first = false
+		}
+	}
+	return min
+}
+
+// CheckSafety 检查同一高度下所有诚实节点提交的区块是否一致
+func (c *Cluster) CheckSafety() error {
+	max := uint64(0)
+	for _, r := range c.Replicas {
+		if r.Faulty() {
+			continue
+		}
+		if r.WS.BlockNum > max {
+			max = r.WS.BlockNum
+		}
+	}
+	for h := uint64(1); h <= max; h++ {
+		committed := ""
+		for _, r := range c.Replicas {
+			if r.Faulty() || r.WS.BlockNum < h {
+				continue
+			}
+			blk, err := r.WS.GetBlock(h)
+			if err != nil || blk == nil {
+				return fmt.Errorf("%s 读取高度%d的区块失败 err: %v", r.ID, h, err)
+			}
+			if committed == "" {
+				committed = blk.BlockId
+				continue
+			}
+			if blk.BlockId != committed {
+				return fmt.Errorf("高度%d提交了不同的区块 %s: %s, 其他节点: %s", h, r.ID, blk.BlockId, committed)
+			}
+		}
+	}
+	return nil
+}
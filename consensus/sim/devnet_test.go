@@ -0,0 +1,59 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/network/memnet"
+)
+
+// 链路有延迟 抖动 丢包和重复时 消息乱序到达 共识仍然有进展
+func TestLossyLinks(t *testing.T) {
+	c, err := NewCluster(4, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Net.Default = memnet.LinkConfig{Latency: 20 * time.Millisecond, Jitter: 300 * time.Millisecond, LossRate: 0.05, DupRate: 0.05}
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 3 }, 10*time.Minute) {
+		t.Fatalf("有丢包和乱序时共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 分区中少于2f+1个节点时不能出块 分区恢复后继续出块
+func TestPartitionHeal(t *testing.T) {
+	c, err := NewCluster(4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 1 }, time.Minute) {
+		t.Fatalf("共识没有进展")
+	}
+	ids := make([]string, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		ids = append(ids, r.Switcher.ID())
+	}
+	c.Net.Partition(ids[:2], ids[2:])
+	c.RunFor(30 * time.Second)
+	h := uint64(0)
+	for _, r := range c.Replicas {
+		if r.WS.BlockNum > h {
+			h = r.WS.BlockNum
+		}
+	}
+	c.RunFor(time.Minute)
+	for _, r := range c.Replicas {
+		if r.WS.BlockNum > h {
+			t.Fatalf("%s 在分区中继续出块 高度: %d", r.ID, r.WS.BlockNum)
+		}
+	}
+	c.Net.Heal()
+	if !c.RunUntil(func() bool { return c.MinHeight() > h+2 }, 10*time.Minute) {
+		t.Fatalf("分区恢复后共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,52 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/consensus"
+)
+
+func TestEventStream(t *testing.T) {
+	c, err := NewCluster(4, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := c.Replicas[0].PBFT.Subscribe()
+	defer cancel()
+	c.Crash(1)
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 3 }, 20*time.Minute) {
+		t.Fatalf("共识没有进展 当前高度: %d", c.MinHeight())
+	}
+
+	seen := make(map[string]int)
+	var last int64
+	commits := make([]uint64, 0)
+drain:
+	for {
+		select {
+		case e := <-events:
+			if e.Time < last {
+				t.Fatalf("事件时间倒退 %d < %d", e.Time, last)
+			}
+			last = e.Time
+			seen[e.Type]++
+			if e.Type == consensus.EventCommit {
+				commits = append(commits, e.SeqNum)
+			}
+		default:
+			break drain
+		}
+	}
+	for _, typ := range []string{consensus.EventState, consensus.EventMessage, consensus.EventQuorum,
+		consensus.EventViewChange, consensus.EventCommit} {
+		if seen[typ] == 0 {
+			t.Fatalf("没有收到%s事件 %v", typ, seen)
+		}
+	}
+	for i := range commits {
+		if commits[i] != uint64(i+1) {
+			t.Fatalf("提交事件的高度不连续 %v", commits)
+		}
+	}
+}
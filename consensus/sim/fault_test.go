@@ -0,0 +1,108 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+// faultyCluster 第faulty个节点按fc开启故障注入
+func faultyCluster(t *testing.T, seed int64, faulty int, fc config.FaultCfg) *Cluster {
+	fc.Enable = true
+	c, err := NewClusterWithConfig(4, seed, func(i int, cfg *config.Configure) {
+		if i == faulty {
+			f := fc
+			cfg.ConsensusCfg.Fault = &f
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEquivocatingPrimary(t *testing.T) {
+	c := faultyCluster(t, 3, 1, config.FaultCfg{EquivocatePrimary: true})
+	c.RunUntil(func() bool { return c.MinHeight() >= 6 }, 20*time.Minute)
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	if c.MinHeight() < 6 {
+		t.Fatalf("主节点作恶时共识没有进展 当前高度: %d", c.MinHeight())
+	}
+}
+
+func TestWithholdingReplica(t *testing.T) {
+	c := faultyCluster(t, 5, 2, config.FaultCfg{WithholdVotes: true, ReplayStale: true})
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 5 }, 20*time.Minute) {
+		t.Fatalf("一个节点不投票时共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptSignatureReplica(t *testing.T) {
+	c := faultyCluster(t, 9, 0, config.FaultCfg{CorruptSign: true, DropRate: 0.2, MaxDelay: 500})
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 5 }, 20*time.Minute) {
+		t.Fatalf("一个节点签名错误时共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	// 持续发送错误签名的节点会被其他节点断开
+	bad := c.Replicas[0].Switcher.ID()
+	for _, r := range c.Replicas[1:] {
+		if !r.Switcher.Removed(bad) {
+			t.Fatalf("%s 没有断开发送错误签名的节点", r.ID)
+		}
+	}
+}
+
+func TestEquivocationEvidence(t *testing.T) {
+	c := faultyCluster(t, 3, 1, config.FaultCfg{EquivocatePrimary: true})
+	// 所有正常节点都应该收到证据 并且证据最终被打包进区块
+	included := func() bool {
+		for _, r := range c.Replicas {
+			if r.Faulty() {
+				continue
+			}
+			found := false
+			for _, e := range r.PBFT.Equivocations() {
+				if e.Height != 0 {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	if !c.RunUntil(included, 30*time.Minute) {
+		t.Fatalf("双签证据没有上链 当前高度: %d", c.MinHeight())
+	}
+	signer := c.Replicas[1].WS.CurVerfier.PublickKey
+	for _, r := range c.Replicas {
+		if r.Faulty() {
+			continue
+		}
+		for _, e := range r.PBFT.Equivocations() {
+			if !bytes.Equal(e.Evidence.First.SignerId, signer) {
+				t.Fatalf("%s 记录了错误的作恶节点 %x", r.ID, e.Evidence.First.SignerId)
+			}
+			if e.Height == 0 {
+				continue
+			}
+			blk, err := r.WS.GetBlock(e.Height)
+			if err != nil || blk == nil || len(blk.Evidences) == 0 {
+				t.Fatalf("%s 高度%d的区块中没有双签证据", r.ID, e.Height)
+			}
+		}
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+// runWithCrashedReplica 一个节点宕机后运行固定时间 返回最低高度和最大视图
+func runWithCrashedReplica(t *testing.T, election string) (uint64, uint64) {
+	c, err := NewClusterWithConfig(4, 5, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.LeaderElection = election
+		cfg.ConsensusCfg.ReputationWindow = 100
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 1 }, 10*time.Minute) {
+		t.Fatalf("共识没有进展")
+	}
+	c.Crash(1)
+	c.RunFor(30 * time.Minute)
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	view := uint64(0)
+	for _, r := range c.Replicas {
+		if r.WS.View > view {
+			view = r.WS.View
+		}
+	}
+	return c.MinHeight(), view
+}
+
+func TestReputationSkipsCrashedLeader(t *testing.T) {
+	rrHeight, rrView := runWithCrashedReplica(t, "round_robin")
+	repHeight, repView := runWithCrashedReplica(t, "reputation")
+	t.Logf("round_robin 高度: %d 视图: %d, reputation 高度: %d 视图: %d", rrHeight, rrView, repHeight, repView)
+	if repHeight <= rrHeight || repView >= rrView {
+		t.Fatalf("按信誉选择主节点应该减少视图切换")
+	}
+}
@@ -0,0 +1,28 @@
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserverFollowsConsensus(t *testing.T) {
+	c, err := NewCluster(4, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obs, err := c.AddObserver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !obs.PBFT.IsObserver() {
+		t.Fatal("节点没有以观察者模式运行")
+	}
+	// 宕机的验证者轮到主节点时需要viewchange 观察者也要能跟上新视图中提交的区块
+	c.Crash(3)
+	if !c.RunUntil(func() bool { return obs.WS.BlockNum >= 8 }, 20*time.Minute) {
+		t.Fatalf("观察者没有跟上共识 观察者高度: %d, 验证者最低高度: %d", obs.WS.BlockNum, c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
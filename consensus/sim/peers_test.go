@@ -0,0 +1,33 @@
+package sim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+func TestConsensusOnlyToVerifiers(t *testing.T) {
+	c, err := NewCluster(4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不是验证者的节点 不应该收到任何共识消息
+	outsider, err := c.Net.NewSwitcher("outsider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := 0
+	outsider.RegisterOnReceive("consensus", func(modelID string, msg *network.BroadcastMsg, p *network.Peer) {
+		received++
+	})
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 5 }, 10*time.Minute) {
+		t.Fatalf("共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if received != 0 {
+		t.Fatalf("非验证者节点收到了%d条共识消息", received)
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
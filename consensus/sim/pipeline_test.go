@@ -0,0 +1,144 @@
+package sim
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+// newAccount 生成一个账户的私钥和地址
+func newAccount(t *testing.T) (*ecdsa.PrivateKey, *model.Address) {
+	// 交易中的公钥是X和Y直接拼接 不足64字节时签名不能校验 和generateKey一样重新生成
+	for {
+		privHex, _, err := cryptogo.GenerateKeyPairs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, err := cryptogo.LoadPrivateKey(privHex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub := append(priv.PublicKey.X.Bytes(), priv.PublicKey.Y.Bytes()...)
+		if len(pub) != 64 {
+			continue
+		}
+		return priv, model.PublicKeyToAddress(pub)
+	}
+}
+
+// runTxStream 持续提交转账交易 返回提交的交易数量
+func runTxStream(t *testing.T, window int, d time.Duration) (*Cluster, int) {
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	c, err := NewClusterWithConfig(4, 21, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.PipelineWindow = window
+		cfg.ConsensusCfg.ProposalInterval = 200
+		cfg.AccountCfg = config.AccountCfg{{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000000}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每条消息需要一轮才能到达 单个区块的共识至少需要几轮
+	c.Net.Default.Latency = c.Tick
+	n := 0
+	for end := c.Clock.Now().Add(d); c.Clock.Now().Before(end); n++ {
+		tx := &model.Tx{
+			Sender:    from,
+			Recipient: to,
+			Amount:    &model.Amount{Amount: "1"},
+			Sequeue:   fmt.Sprintf("%d", n),
+			TimeStamp: uint64(c.Clock.Now().Unix()),
+		}
+		if err := tx.SignTx(priv); err != nil {
+			t.Fatal(err)
+		}
+		c.SubmitTx(tx)
+		c.Round()
+	}
+	return c, n
+}
+
+func committedTxs(r *Replica) int {
+	cnt := 0
+	for h := uint64(1); h <= r.WS.BlockNum; h++ {
+		blk, _ := r.WS.GetBlock(h)
+		cnt += len(blk.Tansactions.GetTansactions())
+	}
+	return cnt
+}
+
+func TestPipeline(t *testing.T) {
+	serial, _ := runTxStream(t, 1, 20*time.Second)
+	pipelined, n := runTxStream(t, 4, 20*time.Second)
+	if pipelined.MinHeight() <= serial.MinHeight() {
+		t.Fatalf("流水线没有提高出块速度 串行高度: %d, 流水线高度: %d", serial.MinHeight(), pipelined.MinHeight())
+	}
+	if !pipelined.RunUntil(func() bool { return committedTxs(pipelined.Replicas[0]) == n }, time.Minute) {
+		t.Fatalf("流水线模式下交易没有全部提交 提交数量: %d, 交易数量: %d", committedTxs(pipelined.Replicas[0]), n)
+	}
+	if err := pipelined.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineViewChange(t *testing.T) {
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	c, err := NewClusterWithConfig(4, 23, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.PipelineWindow = 4
+		cfg.ConsensusCfg.ProposalInterval = 200
+		cfg.AccountCfg = config.AccountCfg{{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000000}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Net.Default.Latency = c.Tick
+	n := 0
+	submit := func(d time.Duration) {
+		for end := c.Clock.Now().Add(d); c.Clock.Now().Before(end); n++ {
+			tx := &model.Tx{Sender: from, Recipient: to, Amount: &model.Amount{Amount: "1"},
+				Sequeue: fmt.Sprintf("%d", n), TimeStamp: uint64(c.Clock.Now().Unix())}
+			if err := tx.SignTx(priv); err != nil {
+				t.Fatal(err)
+			}
+			c.SubmitTx(tx)
+			c.Round()
+		}
+	}
+	submit(5 * time.Second)
+	// 流水线中还有提前prepared的区块时两个节点宕机 恢复后viewchange 这些区块重新提议 交易不会丢失
+	c.Crash(2)
+	c.Crash(3)
+	submit(15 * time.Second)
+	alive := c.Replicas[0]
+	// 宕机前已经收集到2f+1个prepare的区块
+	prepared := make(map[uint64]string)
+	for seq := alive.WS.BlockNum + 1; seq <= alive.WS.BlockNum+4; seq++ {
+		blk := alive.PBFT.FindBlock(seq, alive.WS.View)
+		if blk != nil && len(alive.PBFT.FindStateMsgByDigest(seq, alive.WS.View, model.MessageType_Prepare, blk.BlockId)) >= 3 {
+			prepared[seq] = blk.BlockId
+		}
+	}
+	if len(prepared) < 2 {
+		t.Fatalf("宕机时流水线中没有多个prepared的区块 %v", prepared)
+	}
+	c.Recover(2)
+	c.Recover(3)
+	if !c.RunUntil(func() bool { return committedTxs(alive) == n }, 10*time.Minute) {
+		t.Fatalf("viewchange后交易没有全部提交 提交数量: %d, 交易数量: %d", committedTxs(alive), n)
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	for seq, id := range prepared {
+		blk, err := alive.WS.GetBlock(seq)
+		if err != nil || blk == nil || blk.BlockId != id {
+			t.Fatalf("高度%d提交的不是viewchange之前已经prepared的区块", seq)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestBlockPolicy(t *testing.T) {
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	c, err := NewClusterWithConfig(4, 9, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.SkipEmptyBlocks = true
+		cfg.ConsensusCfg.MaxBlockInterval = 30
+		cfg.ConsensusCfg.MaxBlockTxs = 2
+		cfg.AccountCfg = config.AccountCfg{{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000000}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 交易池为空时只出心跳区块
+	c.RunFor(2 * time.Minute)
+	if h := c.MinHeight(); h == 0 || h > 4 {
+		t.Fatalf("交易池为空时出块数量不符合心跳间隔 高度: %d", h)
+	}
+
+	start := c.MinHeight()
+	for n := 0; n < 5; n++ {
+		tx := &model.Tx{
+			Sender:    from,
+			Recipient: to,
+			Amount:    &model.Amount{Amount: "1"},
+			Sequeue:   fmt.Sprintf("%d", n),
+			TimeStamp: uint64(c.Clock.Now().Unix()),
+		}
+		if err := tx.SignTx(priv); err != nil {
+			t.Fatal(err)
+		}
+		c.SubmitTx(tx)
+	}
+	if !c.RunUntil(func() bool { return committedTxs(c.Replicas[0]) == 5 }, 30*time.Second) {
+		t.Fatalf("有交易时没有及时出块 提交交易数量: %d", committedTxs(c.Replicas[0]))
+	}
+	r := c.Replicas[0]
+	for h := start + 1; h <= r.WS.BlockNum; h++ {
+		blk, _ := r.WS.GetBlock(h)
+		if len(blk.Tansactions.GetTansactions()) > 2 {
+			t.Fatalf("高度%d的区块交易数量超过上限: %d", h, len(blk.Tansactions.GetTansactions()))
+		}
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockSizeLimit(t *testing.T) {
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	newTx := func(c *Cluster, n int) *model.Tx {
+		tx := &model.Tx{Sender: from, Recipient: to, Amount: &model.Amount{Amount: "1"},
+			Sequeue: fmt.Sprintf("%d", n), TimeStamp: uint64(c.Clock.Now().Unix())}
+		if err := tx.SignTx(priv); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	setup := func(maxBytes int) *Cluster {
+		c, err := NewClusterWithConfig(4, 5, func(i int, cfg *config.Configure) {
+			cfg.ConsensusCfg.MaxBlockBytes = maxBytes
+			cfg.AccountCfg = config.AccountCfg{{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000000}}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// 先得到只包含一笔交易的区块大小 所有交易的大小相同
+	c := setup(0)
+	c.SubmitTx(newTx(c, 0))
+	if !c.RunUntil(func() bool { return committedTxs(c.Replicas[0]) == 1 }, time.Minute) {
+		t.Fatalf("交易没有提交")
+	}
+	one := 0
+	r := c.Replicas[0]
+	for h := uint64(1); h <= r.WS.BlockNum; h++ {
+		blk, _ := r.WS.GetBlock(h)
+		if len(blk.Tansactions.GetTansactions()) == 1 {
+			one = proto.Size(blk.Tansactions) + proto.Size(blk.TransactionReceipts)
+		}
+	}
+
+	// 上限比三笔交易少一个字节 每个区块最多打包两笔交易 区块正好打包到上限以内
+	limit := 3*one - 1
+	c = setup(limit)
+	for n := 0; n < 6; n++ {
+		c.SubmitTx(newTx(c, n))
+	}
+	r = c.Replicas[0]
+	if !c.RunUntil(func() bool { return committedTxs(r) == 6 }, 5*time.Minute) {
+		t.Fatalf("接近区块大小上限的区块没有提交 提交交易数量: %d", committedTxs(r))
+	}
+	full := false
+	for h := uint64(1); h <= r.WS.BlockNum; h++ {
+		blk, _ := r.WS.GetBlock(h)
+		if size := proto.Size(blk.Tansactions) + proto.Size(blk.TransactionReceipts); size > limit {
+			t.Fatalf("高度%d的区块大小%d超过上限%d", h, size, limit)
+		}
+		if len(blk.Tansactions.GetTansactions()) == 2 {
+			full = true
+		}
+	}
+	if !full {
+		t.Fatalf("没有打包到上限的区块")
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+package sim
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/consensus"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestSafetyAndLiveness(t *testing.T) {
+	for seed := int64(1); seed <= 3; seed++ {
+		c, err := NewCluster(4, seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !c.RunUntil(func() bool { return c.MinHeight() >= 5 }, 10*time.Minute) {
+			t.Fatalf("seed %d: 共识没有进展 当前高度: %d", seed, c.MinHeight())
+		}
+		if err := c.CheckSafety(); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+func TestCrashedReplica(t *testing.T) {
+	c, err := NewCluster(4, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 宕机节点会轮流成为主节点 需要通过viewchange才能继续出块
+	c.Crash(3)
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 6 }, 20*time.Minute) {
+		t.Fatalf("一个节点宕机后共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func() []string {
+		c, err := NewCluster(4, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.RunFor(time.Minute)
+		ids := make([]string, 0)
+		r := c.Replicas[0]
+		for h := uint64(1); h <= r.WS.BlockNum; h++ {
+			blk, _ := r.WS.GetBlock(h)
+			ids = append(ids, blk.BlockId)
+		}
+		return ids
+	}
+	a, b := run(), run()
+	if len(a) == 0 || len(a) != len(b) {
+		t.Fatalf("相同种子的运行结果不一致 高度: %d, %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("相同种子在高度%d提交了不同的区块", i+1)
+		}
+	}
+}
+
+func TestViewChangeWithoutQuorum(t *testing.T) {
+	c, err := NewCluster(4, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := c.Replicas[0].PBFT.Subscribe()
+	defer cancel()
+	// 两个节点宕机 剩下的f+1个节点超时后收集不到2f+1个viewchange消息
+	c.Crash(2)
+	c.Crash(3)
+	timeouts := make([]int64, 0)
+	for i := 0; i < 60 && len(timeouts) < 4; i++ {
+		c.RunFor(10 * time.Second)
+	drain:
+		for {
+			select {
+			case e := <-events:
+				if e.Type == consensus.EventViewChange && e.State == "timeout" {
+					timeouts = append(timeouts, e.Time)
+				}
+			default:
+				break drain
+			}
+		}
+	}
+	if len(timeouts) < 4 {
+		t.Fatalf("没有达到viewchange法定数量时没有再次超时 超时次数: %d", len(timeouts))
+	}
+	// 超时间隔按指数退避增长
+	for i := 2; i < len(timeouts); i++ {
+		if timeouts[i]-timeouts[i-1] <= timeouts[i-1]-timeouts[i-2] {
+			t.Fatalf("超时间隔没有增长 %v", timeouts)
+		}
+	}
+
+	c.Recover(2)
+	c.Recover(3)
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 2 }, 30*time.Minute) {
+		t.Fatalf("节点恢复后共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReproposePreparedBlock(t *testing.T) {
+	c, err := NewCluster(4, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Net.Default.Latency = c.Tick
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 1 }, 10*time.Minute) {
+		t.Fatalf("共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	seq, view := c.Replicas[0].WS.BlockNum+1, c.Replicas[0].WS.View
+	// 找到下一个区块的主节点 其他节点都收集到2f+1个prepare之后 主节点在commit之前宕机
+	primary, prepared := -1, ""
+	preparedAll := func() bool {
+		blk := c.Replicas[0].PBFT.FindBlock(seq, view)
+		if blk == nil {
+			return false
+		}
+		for i, r := range c.Replicas {
+			if bytes.Equal(r.WS.CurVerfier.PublickKey, blk.SignerId) {
+				primary = i
+				continue
+			}
+			if r.WS.BlockNum >= seq ||
+				len(r.PBFT.FindStateMsgByDigest(seq, view, model.MessageType_Prepare, blk.BlockId)) < 3 {
+				return false
+			}
+		}
+		prepared = blk.BlockId
+		return true
+	}
+	if !c.RunUntil(preparedAll, time.Minute) {
+		t.Fatalf("高度%d的区块没有在视图%d中prepared", seq, view)
+	}
+	if c.MinHeight() >= seq {
+		t.Fatalf("高度%d的区块在主节点宕机之前已经提交", seq)
+	}
+	c.Crash(primary)
+	// 丢弃已经发出的commit消息 各节点只能通过viewchange继续
+	groups := make([][]string, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		groups = append(groups, []string{r.Switcher.ID()})
+	}
+	c.Net.Partition(groups...)
+	c.Round()
+	c.Net.Heal()
+
+	alive := c.Replicas[(primary+1)%len(c.Replicas)]
+	if !c.RunUntil(func() bool { return alive.WS.BlockNum >= seq }, 30*time.Minute) {
+		t.Fatalf("主节点宕机后高度%d没有提交", seq)
+	}
+	if alive.WS.View <= view {
+		t.Fatalf("主节点宕机后没有进入新视图 视图: %d", alive.WS.View)
+	}
+	var nv *model.PbftNewView
+	for v := view + 1; v <= alive.WS.View && nv == nil; v++ {
+		if msgs := alive.PBFT.FindStateMsg(seq, v, model.MessageType_NewView); len(msgs) > 0 {
+			nv = msgs[0].NewViewMsg
+		}
+	}
+	if nv == nil || nv.PrePrepare == nil || nv.PrePrepare.Block == nil {
+		t.Fatal("新视图中没有重新提议prepared的区块")
+	}
+	if nv.PrePrepare.Block.BlockId != prepared {
+		t.Fatalf("NewView重新提议的区块 %s 不是prepared的区块 %s", nv.PrePrepare.Block.BlockId, prepared)
+	}
+	blk, err := alive.WS.GetBlock(seq)
+	if err != nil || blk == nil || blk.BlockId != prepared {
+		t.Fatalf("高度%d提交的区块不是prepared的区块 %s", seq, prepared)
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,172 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/consensus"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestRemoveValidator(t *testing.T) {
+	privHex, _, err := cryptogo.GenerateKeyPairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := cryptogo.LoadPrivateKey(privHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := append(priv.PublicKey.X.Bytes(), priv.PublicKey.Y.Bytes()...)
+	admin := model.PublicKeyToAddress(pub)
+
+	c, err := NewClusterWithConfig(4, 11, func(i int, cfg *config.Configure) {
+		cfg.AccountCfg = config.AccountCfg{{Address: admin.Address, Type: int(model.AccountType_Admin), Amount: 1}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 1 }, 10*time.Minute) {
+		t.Fatalf("共识没有进展")
+	}
+
+	removed := c.Replicas[3].WS.CurVerfier.PublickKey
+	effective := c.MinHeight() + 4
+	tx, err := model.NewValidatorChangeTx(admin, &model.ValidatorChange{
+		Op: model.ValidatorOp_ValidatorRemove, PublickKey: removed, EffectiveHeight: effective,
+	}, "1", uint64(c.Clock.Now().Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.SignTx(priv); err != nil {
+		t.Fatal(err)
+	}
+	c.SubmitTx(tx)
+
+	// 被移除的节点不再参与共识 所有节点提交生效高度的前一个区块后都应该切换了验证者集合
+	if !c.RunUntil(func() bool { return c.MinHeight() >= effective-1 }, 20*time.Minute) {
+		t.Fatalf("共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	for _, r := range c.Replicas {
+		meta, err := r.WS.GetBlockMeta()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(meta.Verifiers) != 3 || len(meta.PendingChanges) != 0 {
+			t.Fatalf("%s 验证者变更没有生效 验证者数量: %d", r.ID, len(meta.Verifiers))
+		}
+		for _, v := range meta.Verifiers {
+			if bytes.Equal(v.PublickKey, removed) {
+				t.Fatalf("%s 被移除的验证者仍然存在", r.ID)
+			}
+		}
+	}
+
+	// 剩下的验证者可以继续出块
+	c.Crash(3)
+	target := effective + 3
+	if !c.RunUntil(func() bool { return c.MinHeight() >= target }, 10*time.Minute) {
+		t.Fatalf("移除验证者后共识没有进展 当前高度: %d", c.MinHeight())
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveValidatorPipelined(t *testing.T) {
+	adminPriv, admin := newAccount(t)
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	c, err := NewClusterWithConfig(4, 17, func(i int, cfg *config.Configure) {
+		cfg.ConsensusCfg.PipelineWindow = 4
+		cfg.ConsensusCfg.ProposalInterval = 200
+		cfg.AccountCfg = config.AccountCfg{
+			{Address: admin.Address, Type: int(model.AccountType_Admin), Amount: 1},
+			{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000000},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Net.Default.Latency = c.Tick
+	n := 0
+	// 持续提交转账交易 让流水线中始终有提前提议的区块
+	runWithTxs := func(cond func() bool, max time.Duration) bool {
+		for end := c.Clock.Now().Add(max); c.Clock.Now().Before(end); n++ {
+			if cond() {
+				return true
+			}
+			tx := &model.Tx{Sender: from, Recipient: to, Amount: &model.Amount{Amount: "1"},
+				Sequeue: fmt.Sprintf("%d", n), TimeStamp: uint64(c.Clock.Now().Unix())}
+			if err := tx.SignTx(priv); err != nil {
+				t.Fatal(err)
+			}
+			c.SubmitTx(tx)
+			c.Round()
+		}
+		return cond()
+	}
+	if !runWithTxs(func() bool { return c.MinHeight() >= 2 }, 10*time.Minute) {
+		t.Fatalf("共识没有进展")
+	}
+
+	// 交易会被打包进流水线窗口内的某个高度 生效高度只比窗口多出ValidatorChangeDelay 流水线一定会跨过生效高度
+	removed := c.Replicas[3].WS.CurVerfier.PublickKey
+	var effective uint64
+	for _, r := range c.Replicas {
+		if r.WS.BlockNum > effective {
+			effective = r.WS.BlockNum
+		}
+	}
+	effective += 4 + consensus.ValidatorChangeDelay
+	tx, err := model.NewValidatorChangeTx(admin, &model.ValidatorChange{
+		Op: model.ValidatorOp_ValidatorRemove, PublickKey: removed, EffectiveHeight: effective,
+	}, "1", uint64(c.Clock.Now().Unix()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.SignTx(adminPriv); err != nil {
+		t.Fatal(err)
+	}
+	c.SubmitTx(tx)
+
+	target := effective + 4
+	// 被移除的节点不再参与共识 只检查剩下的验证者
+	remaining := func() bool {
+		for _, r := range c.Replicas[:3] {
+			if r.WS.BlockNum < target {
+				return false
+			}
+		}
+		return true
+	}
+	if !runWithTxs(remaining, 10*time.Minute) {
+		t.Fatalf("移除验证者后共识没有进展")
+	}
+	if err := c.CheckSafety(); err != nil {
+		t.Fatal(err)
+	}
+	// 生效高度及以后的区块只能由新的验证者集合提议
+	for _, r := range c.Replicas[:3] {
+		meta, err := r.WS.GetBlockMeta()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(meta.Verifiers) != 3 {
+			t.Fatalf("%s 验证者变更没有生效 验证者数量: %d", r.ID, len(meta.Verifiers))
+		}
+		for h := effective; h <= target; h++ {
+			blk, err := r.WS.GetBlock(h)
+			if err != nil || blk == nil {
+				t.Fatalf("%s 读取高度%d的区块失败 err: %v", r.ID, h, err)
+			}
+			if bytes.Equal(blk.SignerId, removed) {
+				t.Fatalf("%s 高度%d的区块由已经移除的验证者提议", r.ID, h)
+			}
+		}
+	}
+}
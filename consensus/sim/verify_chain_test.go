@@ -0,0 +1,77 @@
+package sim
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/blockchain"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestVerifyChain(t *testing.T) {
+	priv, from := newAccount(t)
+	_, to := newAccount(t)
+	c, err := NewClusterWithConfig(4, 13, func(i int, cfg *config.Configure) {
+		cfg.AccountCfg = config.AccountCfg{{Address: from.Address, Type: int(model.AccountType_Normal), Amount: 1000}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 5; n++ {
+		tx := &model.Tx{
+			Sender:    from,
+			Recipient: to,
+			Amount:    &model.Amount{Amount: "10"},
+			Sequeue:   fmt.Sprintf("%d", n),
+			TimeStamp: uint64(c.Clock.Now().Unix()),
+		}
+		if err := tx.SignTx(priv); err != nil {
+			t.Fatal(err)
+		}
+		c.SubmitTx(tx)
+	}
+	r := c.Replicas[0]
+	if !c.RunUntil(func() bool { return c.MinHeight() >= 3 && committedTxs(r) == 5 }, 10*time.Minute) {
+		t.Fatalf("交易没有全部提交 当前高度: %d", c.MinHeight())
+	}
+
+	// 提交的区块记录了签名者位图
+	blk, _ := r.WS.GetBlock(uint64(1))
+	if signers := model.BitmapSigners(r.WS.Verifiers, blk.SignerBitmap); !model.HasQuorum(r.WS.Verifiers, signers) {
+		t.Fatalf("区块的签名位图没有达到法定数量")
+	}
+
+	report, err := blockchain.VerifyChain(r.DB, r.Cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Diverged || report.Verified != report.Height {
+		t.Fatalf("正常的链校验失败 高度: %d 原因: %s", report.DivergentHeight, report.Reason)
+	}
+
+	// 篡改账户余额后 应该报告最后修改该账户的区块
+	acc, err := r.DB.GetAccountByID(to.Address)
+	if err != nil || acc == nil {
+		t.Fatalf("接收方账户不存在 err: %v", err)
+	}
+	acc.Balance = &model.Amount{Amount: "1"}
+	if err := r.DB.Insert(acc); err != nil {
+		t.Fatal(err)
+	}
+	var last uint64
+	for h := uint64(1); h <= report.Height; h++ {
+		blk, _ := r.WS.GetBlock(h)
+		if len(blk.Tansactions.GetTansactions()) > 0 {
+			last = h
+		}
+	}
+	report, err = blockchain.VerifyChain(r.DB, r.Cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Diverged || report.DivergentHeight != last {
+		t.Fatalf("没有发现被篡改的账户 报告的高度: %d 期望: %d", report.DivergentHeight, last)
+	}
+}
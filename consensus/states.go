@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/wupeaking/pbft_impl/model"
 )
 
@@ -17,39 +18,70 @@ type StateMachine struct {
 	// Receive
 	receivedBlock *model.PbftBlock
 	changeSig     chan model.States
+	// 已经收集到足够的viewchange消息 正在等待新视图主节点的NewView消息
+	waitingNewView bool
+	// 新视图中需要重新提议的流水线区块 按高度索引 来自NewView中各高度视图最高的prepared证书
+	reproposals    map[uint64]*model.PbftBlock
+	reproposalView uint64
+	// 连续失败的视图数量 用于超时的指数退避 提交区块后清零
+	failedViews int
+	// 进入当前状态的时间和开始处理当前高度的时间 用于统计各阶段耗时
+	enteredAt  time.Time
+	roundStart time.Time
+	// 触发当前状态处理的事件 用于校验状态迁移
+	event smEvent
+}
+
+// resetTimer 停止定时器并抽空channel后 重新设置超时时间
+func resetTimer(t Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.Chan(): // try to drain the channel
+		default:
+		}
+	}
+	t.Reset(d)
 }
 
 func (pbft *PBFT) ChangeState(s model.States) {
+	if !canTransit(pbft.sm.state, pbft.sm.event, s) {
+		pbft.logger.Errorf("非法的状态迁移 事件: %s, 从%s 转换为%s", pbft.sm.event,
+			model.States_name[int32(pbft.sm.state)], model.States_name[int32(s)])
+		return
+	}
 	pbft.logger.Debugf("状态从%s 转换为%s",
 		model.States_name[int32(pbft.sm.state)], model.States_name[int32(s)])
+	pbft.walSaveState(s)
 	if s == model.States_NotStartd || s == model.States_ViewChanging {
 		pbft.sm.receivedBlock = nil
+		pbft.sm.waitingNewView = false
 		// pbft.sm.logBlock.ResetBlock(pbft.ws.BlockNum + 1)
 	}
 	if s == model.States_NotStartd {
 		if !pbft.stateTimeout.Stop() {
 			select {
-			case <-pbft.stateTimeout.C: // try to drain the channel
+			case <-pbft.stateTimeout.Chan(): // try to drain the channel
 			default:
 			}
 		}
 	}
+	// 每次进入或者再次进入viewchanging都重新计时 没有收集到足够的viewchange消息时 超时后按退避的时间再次发送
+	if s == model.States_ViewChanging {
+		resetTimer(pbft.stateTimeout, pbft.stateTimeoutDuration())
+	}
 
 	if s == pbft.sm.state {
 		return
 	}
 
+	from := pbft.sm.state
 	pbft.sm.Lock()
 	pbft.sm.state = s
 	pbft.sm.Unlock()
+	pbft.emitState(from, s)
+	pbft.observeState(from, s)
 	if s != model.States_NotStartd && s != model.States_ViewChanging {
-		if !pbft.stateTimeout.Stop() {
-			select {
-			case <-pbft.stateTimeout.C: // try to drain the channel
-			default:
-			}
-		}
-		pbft.stateTimeout.Reset(10 * time.Second)
+		resetTimer(pbft.stateTimeout, pbft.stateTimeoutDuration())
 		pbft.logger.Debugf("重置超时...")
 	}
 }
@@ -67,7 +99,7 @@ func NewStateMachine() *StateMachine {
 	}
 }
 
-//Migrate  状态转移
+// Migrate  状态转移
 func (pbft *PBFT) StateMigrate(msg *model.PbftMessage) {
 	if msg != nil && !pbft.VerfifyMsg(msg) {
 		pbft.logger.Warnf("接收到无效的msg")
@@ -80,310 +112,340 @@ func (pbft *PBFT) StateMigrate(msg *model.PbftMessage) {
 			pbft.logger.Debugf("此消息已经追加过 不再触发状态处理")
 			return
 		}
-	}
-
-	curState := pbft.CurrentState()
-	switch curState {
-	case model.States_NotStartd:
-		// 处于此状态 期望接收到 新区块提议
-		defer pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-		msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_NewBlockProposal)
-		if len(msgBysigners) == 0 {
-			pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
-				model.States_name[int32(curState)], model.MessageType_name[int32(model.MessageType_NewBlockProposal)])
+		// checkpoint消息与当前状态无关 单独处理
+		if gm := msg.GetGeneric(); gm != nil && gm.Info.MsgType == model.MessageType_Checkpoint {
+			pbft.processCheckpoint(gm.Info.SeqNum, gm.Info.BlockId)
 			return
 		}
-
-		// 根据当前状态 判断是否是 primary Verifier
-		if pbft.IsPrimaryVerfier() {
-			pbft.logger.Debugf("当前状态为 %s, 提议的新区块为: %d, 视图编号为: %d, 当前节点为主验证节点 ",
-				model.States_name[int32(curState)], pbft.ws.BlockNum+1, pbft.ws.View)
-
-			// 检查之前是否已经广播过PrePrepare消息
-			// prePrepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare, pbft.ws.CurVerfier.PublickKey)
-			// if prePrepareMsg != nil {
-			// 	if prePrepareMsg.Broadcast == false {
-			// 		// 广播消息
-			// 		pbft.AddBroadcastTask(prePrepareMsg)
-			// 		// 直接迁移到 prepare状态
-			// 		pbft.ChangeState(model.States_Preparing)
-			// 		// 主动触发状态迁移
-			// 		// pbft.Msgs.InsertMsg(signedMsg)
-			// 	}
-			// }
-
-			// 尝试打包一个区块
-			blk, err := pbft.packageBlock()
-			if err != nil {
-				pbft.logger.Errorf("当前状态为 %s, 准备打包新区块时发生了错误 err: %v",
-					model.States_name[int32(curState)], err)
-				return
-			}
-			// 向所有验证者发起pre-prepare 消息
-			newMsg := model.PbftGenericMessage{
-				Info: &model.PbftMessageInfo{MsgType: model.MessageType_PrePrepare,
-					View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
-					SignerId: pbft.ws.CurVerfier.PublickKey,
-					Sign:     nil,
-				},
-				Block: blk,
-			}
-			// 签名
-			signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
-			if err != nil {
-				pbft.logger.Warnf("当前状态为 %s, 发起pre-prepare消息时 在签名过程中发生错误 err: %v ",
-					model.States_name[int32(curState)], err)
-				return
+		// 收到当前高度更高视图的NewView消息 校验通过后直接进入新视图
+		if nv := msg.GetNewView(); nv != nil {
+			if nv.Info.SeqNum == pbft.ws.BlockNum+1 && nv.Info.View > pbft.ws.View {
+				pbft.enterNewView(nv)
+				pbft.fire(evEntered)
 			}
+			return
+		}
+	}
 
-			// 广播消息
-			pbft.broadcastStateMsg(signedMsg)
-			// 直接迁移到 prepare状态
-			pbft.ChangeState(model.States_Preparing)
-			// 主动触发状态迁移
-			pbft.Msgs.InsertMsg(signedMsg)
+	pbft.fire(evMessage)
+}
 
-		} else {
-			// 如果此次自己不是主验证者 切换到pre-prepare状态 开启超时 等待接收pre-prepare消息
-			pbft.logger.Debugf("当前状态为 %s, 提议的新区块为: %d, 视图编号为: %d, 当前节点为副本验证节点 转换到pre-prepareing状态",
-				model.States_name[int32(curState)], pbft.ws.BlockNum+1, pbft.ws.View)
-			pbft.ChangeState(model.States_PrePreparing)
-		}
+// migrateNotStartd 等待新区块提议 主节点打包并发起pre-prepare 副本节点进入PrePreparing
+func (pbft *PBFT) migrateNotStartd() {
+	// 处于此状态 期望接收到 新区块提议
+	msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_NewBlockProposal)
+	// 流水线中已经提前提议了当前高度的区块 不需要再等待新区块提议
+	if len(msgBysigners) == 0 && pbft.proposalDigest(pbft.ws.BlockNum+1, pbft.ws.View) == "" {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_NotStartd)], model.MessageType_name[int32(model.MessageType_NewBlockProposal)])
+		return
+	}
 
-	case model.States_PrePreparing:
-		defer pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-		// 此状态需要接收到 主节点发送的MessageType_PrePrepare
-		// msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare)
-		primary := (pbft.ws.BlockNum + 1 + pbft.ws.View) % uint64(len(pbft.ws.Verifiers))
-		if len(pbft.ws.Verifiers) == 1 {
-			primary = 0
-		}
-		primarySigner := pbft.ws.Verifiers[primary].PublickKey
-		preprepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare, primarySigner)
-		if preprepareMsg == nil {
-			pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
-				model.States_name[int32(curState)], model.MessageType_name[int32(model.MessageType_PrePrepare)])
+	// 根据当前状态 判断是否是 primary Verifier
+	if pbft.IsPrimaryVerfier() {
+		pbft.logger.Debugf("当前状态为 %s, 提议的新区块为: %d, 视图编号为: %d, 当前节点为主验证节点 ",
+			model.States_name[int32(model.States_NotStartd)], pbft.ws.BlockNum+1, pbft.ws.View)
+
+		// 检查之前是否已经广播过PrePrepare消息
+		// prePrepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare, pbft.ws.CurVerfier.PublickKey)
+		// if prePrepareMsg != nil {
+		// 	if prePrepareMsg.Broadcast == false {
+		// 		// 广播消息
+		// 		pbft.AddBroadcastTask(prePrepareMsg)
+		// 		// 直接迁移到 prepare状态
+		// 		pbft.ChangeState(model.States_Preparing)
+		// 		// 主动触发状态迁移
+		// 		// pbft.Msgs.InsertMsg(signedMsg)
+		// 	}
+		// }
+
+		// 流水线中已经提前提议过 直接进入prepare状态
+		if pp := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare, pbft.ws.CurVerfier.PublickKey); pp != nil {
+			if !pp.Broadcast {
+				pbft.AddBroadcastTask(pp)
+			}
+			pbft.ChangeState(model.States_Preparing)
 			return
 		}
-		// 检查是否已经广播过
-		if !preprepareMsg.Broadcast {
-			// 如果没有广播 帮住广播一次
-			pbft.AddBroadcastTask(preprepareMsg)
-		}
-
-		// 执行到此处 说明收到了正确的由主节点发送的pre-prepare消息
-		// 如果收到区块　校验区块　如果校验成功　则加入自己的签名 如果已经签名 并且数量已经等于2f+1 则不再广播blk
-		var broadcastBlk *model.PbftBlock
-		blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
-		// 对blk签名
-		if blk != nil {
-			signed := false
-			// 检查区块是否已经由本节点签名
-			for i := range blk.SignPairs {
-				if bytes.Compare(blk.SignPairs[i].SignerId, pbft.ws.CurVerfier.PublickKey) == 0 {
-					signed = true
-					break
-				}
+		// 新视图中已经prepared的区块需要重新提议 否则尝试打包一个区块
+		var blk *model.PbftBlock
+		if re := pbft.reproposal(pbft.ws.BlockNum+1, pbft.ws.View); re != nil && re.PrevBlock == pbft.ws.BlockID {
+			blk = proto.Clone(re).(*model.PbftBlock)
+		} else {
+			var err error
+			blk, err = pbft.packageBlock()
+			if err != nil {
+				pbft.logger.Errorf("当前状态为 %s, 准备打包新区块时发生了错误 err: %v",
+					model.States_name[int32(model.States_NotStartd)], err)
+				return
 			}
-			// if !signed && bytes.Compare(blk.SignerId, pbft.ws.CurVerfier.PublickKey) == 0 {
-			// 	signed = true
-			// }
-
-			switch {
-			// 虽然本节点已经签名 但是签名数量还不够 再次广播自己签名签名的区块
-			case signed == true && len(blk.SignPairs)+1 < pbft.minNodeNum():
-				broadcastBlk = blk
-			case signed == false:
-				// 本节点没有签名 那么签名此区块
-				b, err := pbft.signBlock(blk)
-				if err != nil {
-					pbft.logger.Warnf("当前节点处于PrePreparing 对区块进行签名是发生错误 err: %v",
-						err)
-					return
-				}
-				pbft.logger.Debugf("本节点还未签名本区块 签名并广播本区块")
-				broadcastBlk = b
-			case signed == true && len(blk.SignPairs)+1 >= pbft.minNodeNum():
-				pbft.sm.receivedBlock = blk
+			// 不满足出块策略的区块会被其他验证者拒绝 等待下一次提议
+			if err := pbft.checkBlockPolicy(blk); err != nil {
+				pbft.logger.Debugf("当前不能出块 %v", err)
+				return
 			}
 		}
-
-		// 切换到prepare状态 同时添加广播 prepare消息
+		// 向所有验证者发起pre-prepare 消息
 		newMsg := model.PbftGenericMessage{
-			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare,
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_PrePrepare,
 				View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
 				SignerId: pbft.ws.CurVerfier.PublickKey,
 				Sign:     nil,
 			},
-			Block: broadcastBlk,
+			Block: blk,
 		}
-
 		// 签名
 		signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
 		if err != nil {
-			pbft.logger.Warnf("当前状态为 %s, 发起prepare消息时 在签名过程中发生错误 err: %v ",
-				model.States_name[int32(curState)], err)
+			pbft.logger.Warnf("当前状态为 %s, 发起pre-prepare消息时 在签名过程中发生错误 err: %v ",
+				model.States_name[int32(model.States_NotStartd)], err)
 			return
 		}
 
 		// 广播消息
-		// pbft.AddBroadcastTask(signedMsg)
+		pbft.broadcastStateMsg(signedMsg)
+		// 直接迁移到 prepare状态
 		pbft.ChangeState(model.States_Preparing)
+		// 主动触发状态迁移
 		pbft.Msgs.InsertMsg(signedMsg)
 
-	case model.States_Preparing:
-		//检查自己是否已经发起prepare消息 如果没有 则发起
-		prepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Prepare, pbft.ws.CurVerfier.PublickKey)
-		if prepareMsg != nil {
-			// 如果未广播则广播
-			if !prepareMsg.Broadcast {
-				pbft.AddBroadcastTask(prepareMsg)
-			}
-		} else {
-			// 说明自己还未发起prepare消息
-			newMsg := model.PbftGenericMessage{
-				Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare,
-					View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
-					SignerId: pbft.ws.CurVerfier.PublickKey,
-					Sign:     nil,
-				},
-			}
+	} else {
+		// 如果此次自己不是主验证者 切换到pre-prepare状态 开启超时 等待接收pre-prepare消息
+		pbft.logger.Debugf("当前状态为 %s, 提议的新区块为: %d, 视图编号为: %d, 当前节点为副本验证节点 转换到pre-prepareing状态",
+			model.States_name[int32(model.States_NotStartd)], pbft.ws.BlockNum+1, pbft.ws.View)
+		pbft.ChangeState(model.States_PrePreparing)
+	}
+}
+
+// migratePrePreparing 等待主节点的pre-prepare消息 收到后发起prepare
+func (pbft *PBFT) migratePrePreparing() {
+	// 此状态需要接收到 主节点发送的MessageType_PrePrepare
+	// msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare)
+	primarySigner := pbft.primarySigner(pbft.ws.BlockNum+1, pbft.ws.View)
+	preprepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_PrePrepare, primarySigner)
+	if preprepareMsg == nil {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_PrePreparing)], model.MessageType_name[int32(model.MessageType_PrePrepare)])
+		return
+	}
+	// 检查是否已经广播过
+	if !preprepareMsg.Broadcast {
+		// 如果没有广播 帮住广播一次
+		pbft.AddBroadcastTask(preprepareMsg)
+	}
 
-			// 签名
-			signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
+	// 执行到此处 说明收到了正确的由主节点发送的pre-prepare消息
+	// 如果收到区块　校验区块　如果校验成功　则加入自己的签名 如果已经签名 并且数量已经等于2f+1 则不再广播blk
+	// prepare消息只对主节点提议的区块投票
+	digest := preprepareMsg.GenericMsg.Info.BlockId
+	var broadcastBlk *model.PbftBlock
+	blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
+	// 流水线中提前提议的区块 指向的前一个区块必须是本节点已经提交的区块
+	if blk != nil && blk.BlockId == digest && blk.PrevBlock != pbft.ws.BlockID {
+		pbft.logger.Warnf("当前高度提议的区块指向的前一个区块不是已经提交的区块 等待超时")
+		return
+	}
+	if pbft.conflictsReproposal(pbft.ws.BlockNum+1, pbft.ws.View, digest) {
+		pbft.logger.Warnf("主节点提议的区块和新视图中的prepared证书不一致 等待超时")
+		return
+	}
+	// 对blk签名
+	if blk != nil && blk.BlockId == digest {
+		signed := false
+		// 检查区块是否已经由本节点签名
+		for i := range blk.SignPairs {
+			if bytes.Compare(blk.SignPairs[i].SignerId, pbft.ws.CurVerfier.PublickKey) == 0 {
+				signed = true
+				break
+			}
+		}
+		// if !signed && bytes.Compare(blk.SignerId, pbft.ws.CurVerfier.PublickKey) == 0 {
+		// 	signed = true
+		// }
+
+		switch {
+		// 虽然本节点已经签名 但是签名数量还不够 再次广播自己签名签名的区块
+		case signed == true && !pbft.blockHasQuorum(blk):
+			broadcastBlk = blk
+		case signed == false:
+			// 本节点没有签名 那么签名此区块
+			b, err := pbft.signBlock(blk)
 			if err != nil {
-				pbft.logger.Warnf("当前状态为 %s, 发起prepare消息时 在签名过程中发生错误 err: %v ",
-					model.States_name[int32(curState)], err)
+				pbft.logger.Warnf("当前节点处于PrePreparing 对区块进行签名是发生错误 err: %v",
+					err)
 				return
 			}
-			pbft.Msgs.InsertMsg(signedMsg)
-			return
+			pbft.logger.Debugf("本节点还未签名本区块 签名并广播本区块")
+			broadcastBlk = b
+		case signed == true && pbft.blockHasQuorum(blk):
+			pbft.sm.receivedBlock = blk
 		}
+	}
 
-		// 此状态需要接收足够多的prepare消息 方能迁移成功 在这个状态 等待接收足够多的prepare消息
-		msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Prepare)
-		if len(msgBysigners) == 0 {
-			pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
-				model.States_name[int32(curState)], model.MessageType_name[int32(model.MessageType_Prepare)])
+	// 切换到prepare状态 同时添加广播 prepare消息
+	newMsg := model.PbftGenericMessage{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare,
+			View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+			Sign:     nil,
+			BlockId:  digest,
+		},
+		Block: broadcastBlk,
+	}
 
-			pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-			return
-		}
+	// 签名
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
+	if err != nil {
+		pbft.logger.Warnf("当前状态为 %s, 发起prepare消息时 在签名过程中发生错误 err: %v ",
+			model.States_name[int32(model.States_PrePreparing)], err)
+		return
+	}
 
-		if pbft.sm.receivedBlock == nil {
-			blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
-			if blk != nil && len(blk.SignPairs)+1 >= pbft.minNodeNum() {
-				pbft.sm.receivedBlock = blk
-			}
-		}
-		if len(msgBysigners) >= pbft.minNodeNum() {
-			// 收到了足够多的prepare 切换到下一个状态
-			// 满足节点数量  进入checking
-			pbft.ChangeState(model.States_Checking)
-			//  加快进入下一个状态处理
-			pbft.statepollingTimer.AdjustmentPolling(fastDuration)
-		} else {
-			pbft.logger.Debugf("当前状态为%s 暂未收到足够多的%s类型消息",
-				model.States_name[int32(curState)], model.MessageType_name[int32(model.MessageType_Prepare)])
-			pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-			return
-		}
+	// 广播消息
+	// pbft.AddBroadcastTask(signedMsg)
+	pbft.ChangeState(model.States_Preparing)
+	pbft.Msgs.InsertMsg(signedMsg)
+}
 
-	case model.States_Checking:
-		defer pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
-		// 在这个状态 等待收到足够签名的区块 如果收到 则直接进入下一个状态 否则 等待
-		if pbft.sm.receivedBlock == nil {
-			pbft.logger.Warnf("当前状态在States_Checking, 但是依旧没有收到签名足够的区块...")
-			blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
-			if blk != nil && len(blk.SignPairs)+1 >= pbft.minNodeNum() {
-				pbft.sm.receivedBlock = blk
-			}
+// migratePreparing 等待足够多的prepare消息
+func (pbft *PBFT) migratePreparing() {
+	digest := pbft.proposalDigest(pbft.ws.BlockNum+1, pbft.ws.View)
+	if digest == "" {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_Preparing)], model.MessageType_name[int32(model.MessageType_PrePrepare)])
+		return
+	}
+	//检查自己是否已经发起prepare消息 如果没有 则发起
+	prepareMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Prepare, pbft.ws.CurVerfier.PublickKey)
+	if prepareMsg != nil {
+		// 如果未广播则广播
+		if !prepareMsg.Broadcast {
+			pbft.AddBroadcastTask(prepareMsg)
 		}
-
-		if pbft.sm.receivedBlock != nil {
-			// 说明已经收到提交的区块 并且验证通过
-			newMsg := &model.PbftGenericMessage{
-				Info: &model.PbftMessageInfo{MsgType: model.MessageType_Commit,
-					View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
-					SignerId: pbft.ws.CurVerfier.PublickKey,
-					Sign:     nil,
-				},
-			}
-			signedMsg, err := pbft.SignMsg(model.NewPbftMessage(newMsg))
-			if err != nil {
-				pbft.logger.Debugf("当前状态为 %s, 发起commit消息时 在签名过程中发生错误 err: %v ",
-					model.States_name[int32(curState)], err)
-				return
-			}
-			// pbft.AddBroadcastTask(signedMsg)
-			pbft.ChangeState(model.States_Committing)
-			pbft.Msgs.InsertMsg(signedMsg)
+	} else {
+		// 说明自己还未发起prepare消息
+		newMsg := model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare,
+				View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
+				SignerId: pbft.ws.CurVerfier.PublickKey,
+				Sign:     nil,
+				BlockId:  digest,
+			},
 		}
 
-	case model.States_Committing:
-		// 检查自己是否已经广播 如果未广播 则广播
-		commitMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Commit, pbft.ws.CurVerfier.PublickKey)
-		if commitMsg != nil {
-			if !commitMsg.Broadcast {
-				pbft.AddBroadcastTask(commitMsg)
-			}
-		}
-		msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Commit)
-		if len(msgBysigners) == 0 {
-			pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
-				model.States_name[int32(curState)], model.MessageType_name[int32(model.MessageType_Commit)])
-			pbft.statepollingTimer.AdjustmentPolling(normalDuraton)
+		// 签名
+		signedMsg, err := pbft.SignMsg(model.NewPbftMessage(&newMsg))
+		if err != nil {
+			pbft.logger.Warnf("当前状态为 %s, 发起prepare消息时 在签名过程中发生错误 err: %v ",
+				model.States_name[int32(model.States_Preparing)], err)
 			return
 		}
+		pbft.Msgs.InsertMsg(signedMsg)
+		return
+	}
 
-		if len(msgBysigners) >= pbft.minNodeNum() {
-			// 说明已经收到了足够多的commit消息 迁移到finish状态 进行commit区块
-			pbft.ChangeState(model.States_Finished)
-			pbft.statepollingTimer.AdjustmentPolling(fastDuration)
+	// 此状态需要接收足够多的prepare消息 方能迁移成功 在这个状态 等待接收足够多的prepare消息
+	msgBysigners := pbft.FindStateMsgByDigest(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Prepare, digest)
+	if len(msgBysigners) == 0 {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_Preparing)], model.MessageType_name[int32(model.MessageType_Prepare)])
+		return
+	}
+
+	if pbft.sm.receivedBlock == nil {
+		blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
+		if blk != nil && blk.BlockId == digest && pbft.blockHasQuorum(blk) {
+			pbft.sm.receivedBlock = blk
 		}
-		// 广播消息
-		// pbft.AddBroadcastTask(signedMsg)
-		// pbft.Msgs.InsertMsg(signedMsg)
-
-	case model.States_Finished:
-		// 停止超时定时器
-		// 重放区块
-		// 切换到not start
-		// todo:: 需要判断提交是否成功 如果不成功 则转换到viewchang
-		if err := pbft.CommitBlock(pbft.sm.receivedBlock); err != nil {
-			pbft.ChangeState(model.States_ViewChanging)
-			return
+	}
+	if pbft.hasQuorum(msgSigners(msgBysigners)) {
+		// 收到了足够多的prepare 切换到下一个状态
+		// 满足节点数量  进入checking
+		pbft.emitQuorum(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Prepare, digest, len(msgBysigners))
+		pbft.ChangeState(model.States_Checking)
+	} else {
+		pbft.logger.Debugf("当前状态为%s 暂未收到足够多的%s类型消息",
+			model.States_name[int32(model.States_Preparing)], model.MessageType_name[int32(model.MessageType_Prepare)])
+		return
+	}
+}
+
+// migrateChecking 等待签名足够的区块 收到后发起commit
+func (pbft *PBFT) migrateChecking() {
+	// 在这个状态 等待收到足够签名的区块 如果收到 则直接进入下一个状态 否则 等待
+	if pbft.sm.receivedBlock == nil {
+		pbft.logger.Warnf("当前状态在States_Checking, 但是依旧没有收到签名足够的区块...")
+		blk := pbft.FindBlock(pbft.ws.BlockNum+1, pbft.ws.View)
+		if blk != nil && blk.BlockId == pbft.proposalDigest(pbft.ws.BlockNum+1, pbft.ws.View) &&
+			pbft.blockHasQuorum(blk) {
+			pbft.sm.receivedBlock = blk
 		}
-		pbft.ChangeState(model.States_NotStartd)
+	}
 
-	case model.States_ViewChanging:
-		viewChangeMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_ViewChange, pbft.ws.CurVerfier.PublickKey)
-		if viewChangeMsg != nil {
-			if !viewChangeMsg.Broadcast {
-				pbft.AddBroadcastTask(viewChangeMsg)
-			}
+	if pbft.sm.receivedBlock != nil {
+		// 说明已经收到提交的区块 并且验证通过
+		newMsg := &model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Commit,
+				View: pbft.ws.View, SeqNum: pbft.ws.BlockNum + 1,
+				SignerId: pbft.ws.CurVerfier.PublickKey,
+				Sign:     nil,
+				BlockId:  pbft.sm.receivedBlock.BlockId,
+			},
 		}
-		msgBysigners := pbft.FindStateMsg(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_ViewChange)
-		if len(msgBysigners) == 0 {
-			pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
-				model.States_name[int32(curState)], model.States_name[int32(model.States_ViewChanging)])
+		signedMsg, err := pbft.SignMsg(model.NewPbftMessage(newMsg))
+		if err != nil {
+			pbft.logger.Debugf("当前状态为 %s, 发起commit消息时 在签名过程中发生错误 err: %v ",
+				model.States_name[int32(model.States_Checking)], err)
 			return
 		}
-		if len(msgBysigners) >= pbft.minNodeNum() {
-			// 满足节点数量   进入not start view +1
-			pbft.ws.IncreaseView()
-			pbft.ChangeState(model.States_NotStartd)
+		// pbft.AddBroadcastTask(signedMsg)
+		pbft.ChangeState(model.States_Committing)
+		pbft.Msgs.InsertMsg(signedMsg)
+	}
+}
+
+// migrateCommitting 等待足够多的commit消息
+func (pbft *PBFT) migrateCommitting() {
+	// 检查自己是否已经广播 如果未广播 则广播
+	commitMsg := pbft.FindStateMsgBySinger(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Commit, pbft.ws.CurVerfier.PublickKey)
+	if commitMsg != nil {
+		if !commitMsg.Broadcast {
+			pbft.AddBroadcastTask(commitMsg)
 		}
 	}
+	if pbft.sm.receivedBlock == nil {
+		pbft.logger.Warnf("当前状态为%s 但是没有已确认的区块", model.States_name[int32(model.States_Committing)])
+		pbft.ChangeState(model.States_Checking)
+		return
+	}
+	msgBysigners := pbft.FindStateMsgByDigest(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Commit,
+		pbft.sm.receivedBlock.BlockId)
+	if len(msgBysigners) == 0 {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_Committing)], model.MessageType_name[int32(model.MessageType_Commit)])
+		return
+	}
+
+	if pbft.hasQuorum(msgSigners(msgBysigners)) {
+		// 说明已经收到了足够多的commit消息 迁移到finish状态 进行commit区块
+		pbft.emitQuorum(pbft.ws.BlockNum+1, pbft.ws.View, model.MessageType_Commit,
+			pbft.sm.receivedBlock.BlockId, len(msgBysigners))
+		pbft.ChangeState(model.States_Finished)
+	}
+	// 广播消息
+	// pbft.AddBroadcastTask(signedMsg)
+	// pbft.Msgs.InsertMsg(signedMsg)
 }
 
-func (pbft *PBFT) minNodeNum() int {
-	f := len(pbft.ws.Verifiers) / 3
-	var minNodes int
-	if f == 0 {
-		minNodes = len(pbft.ws.Verifiers)
-	} else {
-		minNodes = 2*f + 1
+// migrateFinished 提交区块
+func (pbft *PBFT) migrateFinished() {
+	// 停止超时定时器
+	// 重放区块
+	// 切换到not start
+	// todo:: 需要判断提交是否成功 如果不成功 则转换到viewchang
+	if err := pbft.CommitBlock(pbft.sm.receivedBlock); err != nil {
+		pbft.ChangeState(model.States_ViewChanging)
+		return
 	}
-	return minNodes
+	pbft.ChangeState(model.States_NotStartd)
 }
@@ -0,0 +1,58 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/world_state"
+)
+
+func TestTransitionTable(t *testing.T) {
+	cases := []struct {
+		from model.States
+		ev   smEvent
+		to   model.States
+		ok   bool
+	}{
+		{model.States_NotStartd, evMessage, model.States_PrePreparing, true},
+		{model.States_PrePreparing, evEntered, model.States_Preparing, true},
+		{model.States_Preparing, evMessage, model.States_Checking, true},
+		{model.States_Preparing, evMessage, model.States_Finished, false},
+		{model.States_Committing, evMessage, model.States_Checking, true},
+		{model.States_Finished, evEntered, model.States_NotStartd, true},
+		{model.States_Checking, evTimeout, model.States_ViewChanging, true},
+		{model.States_ViewChanging, evMessage, model.States_Preparing, false},
+		{model.States_ViewChanging, evNewView, model.States_PrePreparing, true},
+		{model.States_ViewChanging, evTimeout, model.States_ViewChanging, true},
+		{model.States_Committing, evStop, model.States_NotStartd, true},
+	}
+	for _, c := range cases {
+		if got := canTransit(c.from, c.ev, c.to); got != c.ok {
+			t.Fatalf("事件%s 从%s 到%s 期望%v 实际%v", c.ev, c.from, c.to, c.ok, got)
+		}
+	}
+}
+
+func TestIllegalTransitionRejected(t *testing.T) {
+	pbft := &PBFT{sm: NewStateMachine(), clock: realClock{}, ws: &world_state.WroldState{},
+		events: newEventBus(), logger: log.NewEntry(log.New())}
+	pbft.stateTimeout = pbft.clock.NewTimer(time.Hour)
+
+	pbft.sm.state = model.States_Preparing
+	pbft.sm.event = evMessage
+	pbft.ChangeState(model.States_Finished)
+	if pbft.CurrentState() != model.States_Preparing {
+		t.Fatalf("非法迁移应被拒绝 当前状态: %s", pbft.CurrentState())
+	}
+	pbft.ChangeState(model.States_Checking)
+	if pbft.CurrentState() != model.States_Checking {
+		t.Fatalf("合法迁移应成功 当前状态: %s", pbft.CurrentState())
+	}
+	pbft.sm.event = evTimeout
+	pbft.ChangeState(model.States_ViewChanging)
+	if pbft.CurrentState() != model.States_ViewChanging {
+		t.Fatalf("超时应进入viewchange 当前状态: %s", pbft.CurrentState())
+	}
+}
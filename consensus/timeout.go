@@ -0,0 +1,55 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+// 默认的超时和定时器间隔 配置中没有设置时使用
+const (
+	defaultStateTimeout    = 10 * time.Second
+	defaultMaxStateTimeout = 5 * time.Minute
+	defaultTryProposal     = 5 * time.Second
+	defaultRebroadcast     = 4 * time.Second
+)
+
+// timeouts 共识使用的所有定时器间隔
+type timeouts struct {
+	state       time.Duration // 状态转换超时 连续viewchange时按指数退避
+	maxState    time.Duration // 退避后的最大超时
+	tryProposal time.Duration // 定时尝试提议区块的间隔
+	rebroadcast time.Duration // viewchange时定时重新广播的间隔
+}
+
+func orDefault(v int, unit, def time.Duration) time.Duration {
+	if v <= 0 {
+		return def
+	}
+	return time.Duration(v) * unit
+}
+
+func newTimeouts(cfg *config.ConsensusCfg) timeouts {
+	t := timeouts{
+		state:       orDefault(cfg.Timeout, time.Second, defaultStateTimeout),
+		maxState:    orDefault(cfg.MaxTimeout, time.Second, defaultMaxStateTimeout),
+		tryProposal: orDefault(cfg.ProposalInterval, time.Millisecond, defaultTryProposal),
+		rebroadcast: orDefault(cfg.RebroadcastInterval, time.Millisecond, defaultRebroadcast),
+	}
+	if t.maxState < t.state {
+		t.maxState = t.state
+	}
+	return t
+}
+
+// stateTimeoutDuration 当前的状态转换超时 每连续失败一个视图超时时间翻倍 提交区块后恢复
+func (pbft *PBFT) stateTimeoutDuration() time.Duration {
+	d := pbft.timeouts.state
+	for i := 0; i < pbft.sm.failedViews && d < pbft.timeouts.maxState; i++ {
+		d *= 2
+	}
+	if d > pbft.timeouts.maxState {
+		d = pbft.timeouts.maxState
+	}
+	return d
+}
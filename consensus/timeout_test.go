@@ -0,0 +1,22 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+func TestStateTimeoutBackoff(t *testing.T) {
+	pbft := &PBFT{sm: NewStateMachine(), timeouts: newTimeouts(&config.ConsensusCfg{Timeout: 2, MaxTimeout: 10})}
+	expect := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range expect {
+		pbft.sm.failedViews = i
+		if got := pbft.stateTimeoutDuration(); got != d {
+			t.Fatalf("连续失败%d个视图 超时时间应为%v 实际为%v", i, d, got)
+		}
+	}
+	if d := newTimeouts(&config.ConsensusCfg{}); d.state != defaultStateTimeout || d.tryProposal != defaultTryProposal {
+		t.Fatalf("未配置时应使用默认值 %+v", d)
+	}
+}
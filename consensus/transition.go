@@ -0,0 +1,142 @@
+package consensus
+
+import (
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	状态机由事件驱动 不再定时轮询:
+	evMessage  收到新消息 追加到消息日志之后触发
+	evEntered  进入新状态后立即处理一次 替代之前的加速轮询
+	evTimeout  状态超时 进入viewchange
+	evNewView  收到或生成NewView消息 进入新视图
+	evStop     停止共识
+	每个状态在transitions中声明接受的事件以及每个事件允许迁移到的状态 不在表中的迁移会被拒绝
+*/
+
+type smEvent int
+
+const (
+	evMessage smEvent = iota
+	evEntered
+	evTimeout
+	evNewView
+	evStop
+)
+
+var smEventName = map[smEvent]string{
+	evMessage: "message",
+	evEntered: "entered",
+	evTimeout: "timeout",
+	evNewView: "new_view",
+	evStop:    "stop",
+}
+
+func (ev smEvent) String() string {
+	return smEventName[ev]
+}
+
+// maxChainedTransitions 一次事件最多连续处理的状态数量 防止表中出现环时死循环
+const maxChainedTransitions = 16
+
+// transitions 状态 --> 接受的事件 --> 允许迁移到的状态
+var transitions = map[model.States]map[smEvent][]model.States{
+	model.States_NotStartd: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_PrePreparing, model.States_Preparing},
+		evEntered: {model.States_PrePreparing, model.States_Preparing},
+	}),
+	model.States_PrePreparing: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_Preparing},
+		evEntered: {model.States_Preparing},
+	}),
+	model.States_Preparing: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_Checking},
+		evEntered: {model.States_Checking},
+	}),
+	model.States_Checking: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_Committing},
+		evEntered: {model.States_Committing},
+	}),
+	model.States_Committing: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_Finished, model.States_Checking},
+		evEntered: {model.States_Finished, model.States_Checking},
+	}),
+	model.States_Finished: withCommon(map[smEvent][]model.States{
+		evMessage: {model.States_NotStartd, model.States_ViewChanging},
+		evEntered: {model.States_NotStartd, model.States_ViewChanging},
+	}),
+	// viewchange状态只能通过NewView离开
+	model.States_ViewChanging: withCommon(map[smEvent][]model.States{
+		evMessage: {},
+		evEntered: {},
+	}),
+}
+
+// withCommon 所有状态都接受超时 新视图和停止事件
+func withCommon(m map[smEvent][]model.States) map[smEvent][]model.States {
+	m[evTimeout] = []model.States{model.States_ViewChanging}
+	m[evNewView] = []model.States{model.States_NotStartd, model.States_PrePreparing}
+	m[evStop] = []model.States{model.States_NotStartd}
+	return m
+}
+
+// accepts 状态是否接受此事件
+func accepts(s model.States, ev smEvent) bool {
+	_, ok := transitions[s][ev]
+	return ok
+}
+
+// canTransit 在事件ev下 是否允许从from迁移到to 停留在当前状态总是允许的
+func canTransit(from model.States, ev smEvent, to model.States) bool {
+	if from == to {
+		return accepts(from, ev)
+	}
+	for _, s := range transitions[from][ev] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// migrate 当前状态的处理函数
+func (pbft *PBFT) migrate(s model.States) {
+	switch s {
+	case model.States_NotStartd:
+		pbft.migrateNotStartd()
+	case model.States_PrePreparing:
+		pbft.migratePrePreparing()
+	case model.States_Preparing:
+		pbft.migratePreparing()
+	case model.States_Checking:
+		pbft.migrateChecking()
+	case model.States_Committing:
+		pbft.migrateCommitting()
+	case model.States_Finished:
+		pbft.migrateFinished()
+	case model.States_ViewChanging:
+		pbft.migrateViewChanging()
+	}
+}
+
+// fire 用事件驱动状态机 状态发生变化后立即以evEntered处理新的状态
+func (pbft *PBFT) fire(ev smEvent) {
+	for i := 0; i < maxChainedTransitions; i++ {
+		if pbft.StopFlag || pbft.observer {
+			return
+		}
+		from := pbft.CurrentState()
+		if !accepts(from, ev) {
+			pbft.logger.Debugf("状态%s 不处理事件%s", model.States_name[int32(from)], ev)
+			return
+		}
+		pbft.sm.event = ev
+		pbft.migrate(from)
+		if pbft.CurrentState() == from {
+			return
+		}
+		ev = evEntered
+	}
+	pbft.logger.Warnf("连续状态迁移超过%d次 停止处理 当前状态: %s",
+		maxChainedTransitions, model.States_name[int32(pbft.CurrentState())])
+}
@@ -0,0 +1,50 @@
+package consensus
+
+import (
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	validator: 链上变更验证者集合
+	1. 管理员账户发出验证者变更交易 交易所在的区块提交后 变更记录到BlockMeta中等待生效
+	2. 提交生效高度的前一个区块时 切换验证者集合 从生效高度开始使用新的集合
+	生效高度至少要在交易所在区块之后ValidatorChangeDelay个区块 所有节点都在同一个区块提交后切换
+*/
+
+// 验证者变更最早在交易所在区块之后多少个区块生效
+const ValidatorChangeDelay = 2
+
+// scheduleValidatorChanges 记录区块中执行成功的验证者变更交易
+func (pbft *PBFT) scheduleValidatorChanges(block *model.PbftBlock) {
+	receipts := block.TransactionReceipts.GetTansactionReceipts()
+	for i, tx := range block.Tansactions.GetTansactions() {
+		if !tx.IsValidatorChange() || i >= len(receipts) || receipts[i].Status != 0 {
+			continue
+		}
+		c, err := tx.DecodeValidatorChange()
+		if err != nil {
+			continue
+		}
+		if c.EffectiveHeight < block.BlockNum+ValidatorChangeDelay {
+			pbft.logger.Warnf("忽略验证者变更 生效高度%d距离当前区块%d太近", c.EffectiveHeight, block.BlockNum)
+			continue
+		}
+		pbft.logger.Infof("验证者变更已提交 类型: %s, 公钥: %x, 生效高度: %d",
+			c.Op, c.PublickKey, c.EffectiveHeight)
+		pbft.ws.AddValidatorChange(c)
+	}
+}
+
+// switchValidators 提交区块后 切换到下一个高度使用的验证者集合
+func (pbft *PBFT) switchValidators() {
+	switched, errs := pbft.ws.ApplyValidatorChanges(pbft.ws.BlockNum + 1)
+	for _, err := range errs {
+		pbft.logger.Warnf("验证者变更无法执行 已忽略 err: %v", err)
+	}
+	if !switched {
+		return
+	}
+	pbft.LoadVerfierPeerIDs()
+	pbft.logger.Infof("验证者集合已切换 从高度%d开始生效 验证者数量: %d, 本节点编号: %d",
+		pbft.ws.BlockNum+1, len(pbft.ws.Verifiers), pbft.ws.VerifierNo)
+}
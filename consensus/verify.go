@@ -27,11 +27,19 @@ func (pbft *PBFT) VerfifyMsg(msg *model.PbftMessage) bool {
 				return false
 			}
 		}
+		if isVoteMsg(gm.Info.MsgType) && gm.Info.BlockId == "" {
+			pbft.logger.Debugf("投票消息没有指定区块ID")
+			return false
+		}
 		if gm.Block != nil {
 			if !pbft.verfifyBlock(gm.Block) {
 				pbft.logger.Debugf("消息内的区块验证失败")
 				return false
 			}
+			if isVoteMsg(gm.Info.MsgType) && gm.Info.BlockId != gm.Block.BlockId {
+				pbft.logger.Debugf("消息签名的区块ID和消息内的区块不一致")
+				return false
+			}
 		}
 		return true
 	}
@@ -41,6 +49,22 @@ func (pbft *PBFT) VerfifyMsg(msg *model.PbftMessage) bool {
 			pbft.logger.Debugf("视图消息验证失败")
 			return false
 		}
+		if !pbft.verfifyViewChange(vc) {
+			pbft.logger.Debugf("视图消息附带的证书验证失败")
+			return false
+		}
+		return true
+	}
+
+	if nv := msg.GetNewView(); nv != nil {
+		if !pbft.verfifyMsgInfo(nv.Info) {
+			pbft.logger.Debugf("NewView消息验证失败")
+			return false
+		}
+		if !pbft.verfifyNewView(nv) {
+			pbft.logger.Debugf("NewView消息内容验证失败")
+			return false
+		}
 		return true
 	}
 	return false
@@ -57,6 +81,10 @@ func (pbft *PBFT) GetMsgSigner(msg *model.PbftMessage) []byte {
 	if vc := msg.GetViewChange(); vc != nil {
 		return vc.Info.SignerId
 	}
+
+	if nv := msg.GetNewView(); nv != nil {
+		return nv.Info.SignerId
+	}
 	return nil
 }
 
@@ -68,7 +96,11 @@ func (pbft *PBFT) verfifyMsgInfo(msgInfo *model.PbftMessageInfo) bool {
 	if !pbft.IsVaildVerifier(msgInfo.SignerId) {
 		return false
 	}
+	return pbft.verifyInfoSign(msgInfo)
+}
 
+// verifyInfoSign 只校验消息的签名 不检查签名者是否是验证者
+func (pbft *PBFT) verifyInfoSign(msgInfo *model.PbftMessageInfo) bool {
 	pubKey, err := cryptogo.LoadPublicKey(fmt.Sprintf("0x%x", msgInfo.SignerId))
 	if err != nil {
 		return false
@@ -78,6 +110,7 @@ func (pbft *PBFT) verfifyMsgInfo(msgInfo *model.PbftMessageInfo) bool {
 		MsgType: msgInfo.MsgType,
 		View:    msgInfo.View,
 		SeqNum:  msgInfo.SeqNum,
+		BlockId: msgInfo.BlockId,
 	}
 	content, _ := proto.Marshal(&info)
 	sh := sha256.New()
@@ -126,20 +159,7 @@ func (pbft *PBFT) verfifyBlock(blk *model.PbftBlock) bool {
 		return false
 	}
 
-	b := model.PbftBlock{
-		PrevBlock:      blk.PrevBlock,
-		BlockNum:       blk.BlockNum,
-		TxRoot:         blk.TxRoot,
-		TxReceiptsRoot: blk.TxReceiptsRoot,
-		TimeStamp:      blk.TimeStamp,
-		BlockId:        "",
-		View:           blk.View,
-	}
-
-	content, _ := proto.Marshal(&b)
-	sh := sha256.New()
-	sh.Write(content)
-	hash := sh.Sum(nil)
+	hash := blk.HeaderHash()
 	if blk.BlockId != hex.EncodeToString(hash) {
 		pbft.logger.Debugf("block hash 校验不一致")
 		return false
@@ -147,7 +167,7 @@ func (pbft *PBFT) verfifyBlock(blk *model.PbftBlock) bool {
 	return cryptogo.VerifySign(pubKey, fmt.Sprintf("0x%x", blk.Sign), fmt.Sprintf("0x%x", hash))
 }
 
-// VerfifyMostBlock 验证有超过2/3的节点已对区块进行了签名
+// VerfifyMostBlock 验证签名的投票权重超过总权重的2/3
 func (pbft *PBFT) VerfifyMostBlock(blk *model.PbftBlock) bool {
 	if blk.BlockNum == 0 {
 		return pbft.VerfifyGenesisBlock(blk)
@@ -162,20 +182,7 @@ func (pbft *PBFT) VerfifyMostBlock(blk *model.PbftBlock) bool {
 		return false
 	}
 
-	b := model.PbftBlock{
-		PrevBlock:      blk.PrevBlock,
-		BlockNum:       blk.BlockNum,
-		TxRoot:         blk.TxRoot,
-		TxReceiptsRoot: blk.TxReceiptsRoot,
-		TimeStamp:      blk.TimeStamp,
-		BlockId:        "",
-		View:           blk.View,
-	}
-
-	content, _ := proto.Marshal(&b)
-	sh := sha256.New()
-	sh.Write(content)
-	hash := sh.Sum(nil)
+	hash := blk.HeaderHash()
 	if blk.BlockId != hex.EncodeToString(hash) {
 		return false
 	}
@@ -187,35 +194,14 @@ func (pbft *PBFT) VerfifyMostBlock(blk *model.PbftBlock) bool {
 		return false
 	}
 
-	f := len(pbft.ws.Verifiers) / 3
-	var minNodes int
-	if f == 0 {
-		minNodes = len(pbft.ws.Verifiers)
-	} else {
-		minNodes = 2*f + 1
-	}
-
-	cnt := 0
-	for _, pair := range blk.SignPairs {
-		if !pbft.IsVaildVerifier(pair.SignerId) {
-			continue
-		}
-
-		pubKey, err := cryptogo.LoadPublicKey(fmt.Sprintf("0x%x", pair.SignerId))
-		if err != nil {
-			return false
-		}
-		if cryptogo.VerifySign(pubKey, fmt.Sprintf("0x%x", pair.Sign), fmt.Sprintf("0x%x", hash)) {
-			cnt++
-		}
-	}
-	if cnt+1 >= minNodes {
-		return true
+	if err := blk.VerifyQuorum(pbft.ws.Verifiers, hash); err != nil {
+		pbft.logger.Debugf("区块签名校验失败 err: %v", err)
+		return false
 	}
-	return false
+	return true
 }
 
-// VerfifyBlockHeader 验证区块头　需要超过2/3f才能成功
+// VerfifyBlockHeader 验证区块头　签名的投票权重需要超过总权重的2/3才能成功
 func (pbft *PBFT) VerfifyBlockHeader(blk *model.PbftBlock) bool {
 	if blk.BlockNum == 0 {
 		return pbft.VerfifyGenesisBlock(blk)
@@ -237,32 +223,11 @@ func (pbft *PBFT) VerfifyBlockHeader(blk *model.PbftBlock) bool {
 		return false
 	}
 
-	f := len(pbft.ws.Verifiers) / 3
-	var minNodes int
-	if f == 0 {
-		minNodes = len(pbft.ws.Verifiers)
-	} else {
-		minNodes = 2*f + 1
-	}
-
-	cnt := 0
-	for _, pair := range blk.SignPairs {
-		if !pbft.IsVaildVerifier(pair.SignerId) {
-			continue
-		}
-
-		pubKey, err := cryptogo.LoadPublicKey(fmt.Sprintf("0x%x", pair.SignerId))
-		if err != nil {
-			return false
-		}
-		if cryptogo.VerifySign(pubKey, fmt.Sprintf("0x%x", pair.Sign), fmt.Sprintf("0x%x", hash)) {
-			cnt++
-		}
-	}
-	if cnt+1 >= minNodes {
-		return true
+	if err := blk.VerifyQuorum(pbft.ws.Verifiers, hash); err != nil {
+		pbft.logger.Debugf("区块签名校验失败 err: %v", err)
+		return false
 	}
-	return false
+	return true
 }
 
 func (pbft *PBFT) SignMsg(msg *model.PbftMessage) (*model.PbftMessage, error) {
@@ -270,6 +235,18 @@ func (pbft *PBFT) SignMsg(msg *model.PbftMessage) (*model.PbftMessage, error) {
 		return nil, fmt.Errorf("msg is nil")
 	}
 	if gm := msg.GetGeneric(); gm != nil {
+		// 先对区块签名 得到区块ID之后 投票消息对区块ID签名
+		if gm.Block != nil {
+			blk, err := pbft.signBlock(gm.Block)
+			if err != nil {
+				return nil, err
+			}
+			gm.Block = blk
+			if gm.Info.BlockId == "" && isVoteMsg(gm.Info.MsgType) {
+				gm.Info.BlockId = blk.BlockId
+			}
+		}
+
 		info, err := pbft.signMsgInfo(gm.Info)
 		if err != nil {
 			return nil, err
@@ -283,14 +260,6 @@ func (pbft *PBFT) SignMsg(msg *model.PbftMessage) (*model.PbftMessage, error) {
 			}
 			gm.OtherInfos[i] = other
 		}
-
-		if gm.Block != nil {
-			blk, err := pbft.signBlock(gm.Block)
-			if err != nil {
-				return nil, err
-			}
-			gm.Block = blk
-		}
 		return model.NewPbftMessage(gm), nil
 	}
 
@@ -302,10 +271,35 @@ func (pbft *PBFT) SignMsg(msg *model.PbftMessage) (*model.PbftMessage, error) {
 		vc.Info = info
 		return model.NewPbftMessage(vc), nil
 	}
+
+	// NewView中重新提议的区块已经带有原主节点的签名 只对消息本身签名
+	if nv := msg.GetNewView(); nv != nil {
+		info, err := pbft.signMsgInfo(nv.Info)
+		if err != nil {
+			return nil, err
+		}
+		nv.Info = info
+		if nv.PrePrepare != nil {
+			ppInfo, err := pbft.signMsgInfo(nv.PrePrepare.Info)
+			if err != nil {
+				return nil, err
+			}
+			nv.PrePrepare.Info = ppInfo
+		}
+		return model.NewPbftMessage(nv), nil
+	}
 	return nil, fmt.Errorf("未支持的消息类型")
 }
 
 func (pbft *PBFT) signMsgInfo(msgInfo *model.PbftMessageInfo) (*model.PbftMessageInfo, error) {
+	if err := pbft.checkDoubleSign(msgInfo); err != nil {
+		return nil, err
+	}
+	return pbft.rawSignMsgInfo(msgInfo)
+}
+
+// rawSignMsgInfo 直接签名 不检查是否双签
+func (pbft *PBFT) rawSignMsgInfo(msgInfo *model.PbftMessageInfo) (*model.PbftMessageInfo, error) {
 	privKey, err := cryptogo.LoadPrivateKey(fmt.Sprintf("0x%x", pbft.ws.CurVerfier.PrivateKey))
 	if err != nil {
 		return nil, err
@@ -314,6 +308,7 @@ func (pbft *PBFT) signMsgInfo(msgInfo *model.PbftMessageInfo) (*model.PbftMessag
 		MsgType: msgInfo.MsgType,
 		View:    msgInfo.View,
 		SeqNum:  msgInfo.SeqNum,
+		BlockId: msgInfo.BlockId,
 	}
 	content, _ := proto.Marshal(&info)
 	sh := sha256.New()
@@ -338,19 +333,7 @@ func (pbft *PBFT) signBlock(blk *model.PbftBlock) (*model.PbftBlock, error) {
 	if err != nil {
 		return nil, err
 	}
-	b := model.PbftBlock{
-		PrevBlock:      blk.PrevBlock,
-		BlockNum:       blk.BlockNum,
-		TxRoot:         blk.TxRoot,
-		TxReceiptsRoot: blk.TxReceiptsRoot,
-		TimeStamp:      blk.TimeStamp,
-		BlockId:        "",
-		View:           blk.View,
-	}
-	content, _ := proto.Marshal(&b)
-	sh := sha256.New()
-	sh.Write(content)
-	hash := sh.Sum(nil)
+	hash := blk.HeaderHash()
 	sign, err := cryptogo.Sign(privKey, hash)
 	if err != nil {
 		return nil, err
@@ -361,7 +344,9 @@ func (pbft *PBFT) signBlock(blk *model.PbftBlock) (*model.PbftBlock, error) {
 	}
 	blk.BlockId = hex.EncodeToString(hash)
 
-	if pbft.IsPrimaryVerfier() {
+	// 重新提议的区块保留原主节点的签名 流水线中提前提议的区块按区块自身的高度和视图判断主节点
+	if bytes.Compare(pbft.primarySigner(blk.BlockNum, blk.View), pbft.ws.CurVerfier.PublickKey) == 0 &&
+		(len(blk.SignerId) == 0 || bytes.Compare(blk.SignerId, pbft.ws.CurVerfier.PublickKey) == 0) {
 		blk.SignerId = pbft.ws.CurVerfier.PublickKey
 		blk.Sign = s
 	} else {
@@ -383,6 +368,13 @@ func (pbft *PBFT) signBlock(blk *model.PbftBlock) (*model.PbftBlock, error) {
 	return blk, nil
 }
 
+// isVoteMsg 需要绑定区块ID的投票消息
+func isVoteMsg(msgType model.MessageType) bool {
+	return msgType == model.MessageType_PrePrepare ||
+		msgType == model.MessageType_Prepare ||
+		msgType == model.MessageType_Commit
+}
+
 func (pbft *PBFT) IsVaildVerifier(singerID []byte) bool {
 	return pbft.ws.IsVerfier(singerID)
 }
@@ -406,15 +398,19 @@ func (pbft *PBFT) isValidMsg(msg *model.PbftMessage) bool {
 		}
 		return true
 	}
+
+	nv := msg.GetNewView()
+	if nv != nil {
+		if nv.Info == nil {
+			return false
+		}
+		return true
+	}
 	return false
 }
 
 func (pbft *PBFT) IsPrimaryVerfier() bool {
-	primary := (pbft.ws.BlockNum + 1 + pbft.ws.View) % uint64(len(pbft.ws.Verifiers))
-	if len(pbft.ws.Verifiers) == 1 {
-		primary = 0
-	}
-	return bytes.Compare(pbft.ws.Verifiers[primary].PublickKey, pbft.ws.CurVerfier.PublickKey) == 0
+	return bytes.Compare(pbft.primarySigner(pbft.ws.BlockNum+1, pbft.ws.View), pbft.ws.CurVerfier.PublickKey) == 0
 }
 
 func (pbft *PBFT) VerfifyGenesisBlock(blk *model.PbftBlock) bool {
@@ -0,0 +1,351 @@
+package consensus
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	viewchange:
+	1. 超时后 验证者广播viewchange消息 附带自己在流水线窗口内每个高度的prepared证书和稳定checkpoint的证明
+	2. 新视图的主节点收集到2f+1个viewchange消息后 广播签名的NewView消息
+	   如果viewchange消息中存在当前高度的prepared证书 则在NewView中重新提议视图最高的那个区块
+	3. 副本节点校验NewView消息之后 才进入新的视图
+	4. 之后的高度中 和前一个高度的区块相连的prepared证书 在新视图中由各自的主节点重新提议
+*/
+
+// 最多接收比当前视图高多少的viewchange和NewView消息
+const maxViewAhead = 16
+
+// acceptableView 是否接收此视图的viewchange和NewView消息 视图太高的消息暂不接收
+func (pbft *PBFT) acceptableView(view uint64) bool {
+	_, cur := pbft.ws.Progress()
+	return view <= cur+maxViewAhead
+}
+
+// primarySigner 计算指定高度和视图下主验证节点的公钥
+func (pbft *PBFT) primarySigner(seq, view uint64) []byte {
+	if len(pbft.ws.Verifiers) == 0 {
+		return nil
+	}
+	if len(pbft.ws.Verifiers) == 1 {
+		return pbft.ws.Verifiers[0].PublickKey
+	}
+	return pbft.ws.Verifiers[pbft.elector.Leader(seq, view, pbft.ws.Verifiers)].PublickKey
+}
+
+// newViewChangeMsg 生成当前视图的viewchange消息
+func (pbft *PBFT) newViewChangeMsg() *model.PbftViewChange {
+	seq := pbft.ws.BlockNum + 1
+	vc := &model.PbftViewChange{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_ViewChange,
+			View: pbft.ws.View, SeqNum: seq,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+			Sign:     nil,
+		},
+		CheckpointMessages: pbft.mm.stableCheckpointProof(),
+	}
+	_, high := pbft.watermarks()
+	for s := seq; s <= high; s++ {
+		if cert := pbft.preparedCert(s); cert != nil {
+			vc.PreparedCerts = append(vc.PreparedCerts, cert)
+		}
+	}
+	return vc
+}
+
+// preparedCert 查找本节点在seq高度下 视图最高的prepared证书
+func (pbft *PBFT) preparedCert(seq uint64) *model.PbftPreparedCert {
+	pbft.mm.BlockViewLock.RLock()
+	views := make([]uint64, 0, len(pbft.mm.BlockView[seq]))
+	for v := range pbft.mm.BlockView[seq] {
+		views = append(views, v)
+	}
+	pbft.mm.BlockViewLock.RUnlock()
+	sort.Slice(views, func(i, j int) bool { return views[i] > views[j] })
+
+	for _, v := range views {
+		blk := pbft.FindBlock(seq, v)
+		if blk == nil || !pbft.blockHasQuorum(blk) {
+			continue
+		}
+		prepares := pbft.FindStateMsgByDigest(seq, v, model.MessageType_Prepare, blk.BlockId)
+		if !pbft.hasQuorum(msgSigners(prepares)) {
+			continue
+		}
+		cert := &model.PbftPreparedCert{
+			Block:    proto.Clone(blk).(*model.PbftBlock),
+			Prepares: make([]*model.PbftMessageInfo, 0, len(prepares)),
+		}
+		for _, p := range prepares {
+			cert.Prepares = append(cert.Prepares, p.GenericMsg.Info)
+		}
+		return cert
+	}
+	return nil
+}
+
+// certView prepared证书所在的视图 以prepare消息的视图为准
+func certView(cert *model.PbftPreparedCert) uint64 {
+	if len(cert.Prepares) == 0 {
+		return 0
+	}
+	return cert.Prepares[0].View
+}
+
+// verifyPreparedCert 校验prepared证书 区块需要有足够的签名 同时需要同一视图下2f+1个prepare消息
+func (pbft *PBFT) verifyPreparedCert(seq uint64, cert *model.PbftPreparedCert) bool {
+	if cert.Block == nil || cert.Block.BlockNum != seq || len(cert.Prepares) == 0 {
+		return false
+	}
+	view := certView(cert)
+	signers := make(map[string]struct{})
+	for _, info := range cert.Prepares {
+		if info.MsgType != model.MessageType_Prepare || info.SeqNum != seq || info.View != view ||
+			info.BlockId != cert.Block.BlockId {
+			return false
+		}
+		if !pbft.verfifyMsgInfo(info) {
+			return false
+		}
+		signers[string(info.SignerId)] = struct{}{}
+	}
+	if !pbft.hasQuorum(keySigners(signers)) {
+		return false
+	}
+	// 流水线中的区块依赖还未提交的祖先区块 无法在本地模拟执行 只校验区块头和签名
+	if seq > pbft.ws.BlockNum+1 {
+		return cert.Block.BlockId == hex.EncodeToString(cert.Block.HeaderHash()) && pbft.VerfifyBlockHeader(cert.Block)
+	}
+	return pbft.VerfifyMostBlock(cert.Block)
+}
+
+// verifyCheckpointProof 校验viewchange消息中附带的稳定checkpoint证明
+func (pbft *PBFT) verifyCheckpointProof(proof []*model.PbftGenericMessage) bool {
+	if len(proof) == 0 {
+		return true
+	}
+	seq, blockID := proof[0].GetInfo().GetSeqNum(), proof[0].GetInfo().GetBlockId()
+	signers := make(map[string]struct{})
+	for _, m := range proof {
+		if m.Info == nil || m.Info.MsgType != model.MessageType_Checkpoint ||
+			m.Info.SeqNum != seq || m.Info.BlockId != blockID {
+			return false
+		}
+		if !pbft.verfifyMsgInfo(m.Info) {
+			return false
+		}
+		signers[string(m.Info.SignerId)] = struct{}{}
+	}
+	return pbft.hasQuorum(keySigners(signers))
+}
+
+// verfifyViewChange 校验viewchange消息中附带的证书
+func (pbft *PBFT) verfifyViewChange(vc *model.PbftViewChange) bool {
+	if vc.Info.MsgType != model.MessageType_ViewChange {
+		return false
+	}
+	if !pbft.verifyCheckpointProof(vc.CheckpointMessages) {
+		pbft.logger.Debugf("viewchange消息中的checkpoint证明校验失败")
+		return false
+	}
+	// 每个高度最多一个证书 高度不能低于viewchange的高度 也不能超出可以接收的范围
+	seqs := make(map[uint64]struct{})
+	for _, cert := range vc.PreparedCerts {
+		seq := cert.GetBlock().GetBlockNum()
+		if _, ok := seqs[seq]; ok || seq < vc.Info.SeqNum || !pbft.acceptableSeq(seq) {
+			pbft.logger.Debugf("viewchange消息中的prepared证书高度错误")
+			return false
+		}
+		seqs[seq] = struct{}{}
+		if !pbft.verifyPreparedCert(seq, cert) {
+			pbft.logger.Debugf("viewchange消息中的prepared证书校验失败")
+			return false
+		}
+	}
+	return true
+}
+
+// highestCert 找出所有viewchange消息中seq高度视图最高的prepared证书
+func highestCert(vcs []*model.PbftViewChange, seq uint64) *model.PbftPreparedCert {
+	var best *model.PbftPreparedCert
+	for _, vc := range vcs {
+		for _, cert := range vc.PreparedCerts {
+			if cert.GetBlock().GetBlockNum() != seq {
+				continue
+			}
+			if best == nil || certView(cert) > certView(best) {
+				best = cert
+			}
+		}
+	}
+	return best
+}
+
+// certChain 从seq高度开始 各高度视图最高并且和前一个高度相连的prepared证书中的区块
+// 遇到没有证书或者不相连的高度时停止 所有节点根据NewView中的viewchange消息计算出相同的结果
+func certChain(vcs []*model.PbftViewChange, seq uint64) []*model.PbftBlock {
+	chain := make([]*model.PbftBlock, 0)
+	for s := seq; ; s++ {
+		best := highestCert(vcs, s)
+		if best == nil || (len(chain) > 0 && best.Block.PrevBlock != chain[len(chain)-1].BlockId) {
+			return chain
+		}
+		chain = append(chain, best.Block)
+	}
+}
+
+// verfifyNewView 校验NewView消息
+func (pbft *PBFT) verfifyNewView(nv *model.PbftNewView) bool {
+	seq, view := nv.Info.SeqNum, nv.Info.View
+	if nv.Info.MsgType != model.MessageType_NewView || view == 0 {
+		return false
+	}
+	if bytes.Compare(nv.Info.SignerId, pbft.primarySigner(seq, view)) != 0 {
+		pbft.logger.Debugf("NewView消息不是由新视图的主节点发出")
+		return false
+	}
+	signers := make(map[string]struct{})
+	for _, vc := range nv.ViewChanges {
+		if vc.Info == nil || vc.Info.SeqNum != seq || vc.Info.View != view-1 {
+			return false
+		}
+		if !pbft.verfifyMsgInfo(vc.Info) || !pbft.verfifyViewChange(vc) {
+			return false
+		}
+		signers[string(vc.Info.SignerId)] = struct{}{}
+	}
+	if !pbft.hasQuorum(keySigners(signers)) {
+		pbft.logger.Debugf("NewView消息中的viewchange数量不足")
+		return false
+	}
+
+	// 重新提议的区块必须是视图最高的prepared证书中的区块
+	best := highestCert(nv.ViewChanges, seq)
+	if best == nil {
+		return nv.PrePrepare == nil
+	}
+	pp := nv.PrePrepare
+	if pp == nil || pp.Info == nil || pp.Block == nil {
+		return false
+	}
+	if pp.Info.MsgType != model.MessageType_PrePrepare || pp.Info.SeqNum != seq || pp.Info.View != view ||
+		bytes.Compare(pp.Info.SignerId, nv.Info.SignerId) != 0 {
+		return false
+	}
+	if pp.Block.BlockId != best.Block.BlockId || pp.Info.BlockId != best.Block.BlockId {
+		pbft.logger.Debugf("NewView消息重新提议的区块和prepared证书不一致")
+		return false
+	}
+	return pbft.verfifyMsgInfo(pp.Info)
+}
+
+// newViewMsg 新视图的主节点根据收集到的viewchange消息生成NewView消息
+func (pbft *PBFT) newViewMsg(vcMsgs []*StateMsg) *model.PbftNewView {
+	seq, view := pbft.ws.BlockNum+1, pbft.ws.View+1
+	nv := &model.PbftNewView{
+		Info: &model.PbftMessageInfo{MsgType: model.MessageType_NewView,
+			View: view, SeqNum: seq,
+			SignerId: pbft.ws.CurVerfier.PublickKey,
+		},
+		ViewChanges: make([]*model.PbftViewChange, 0, len(vcMsgs)),
+	}
+	for _, m := range vcMsgs {
+		nv.ViewChanges = append(nv.ViewChanges, m.ViewChangeMsg)
+	}
+	if best := highestCert(nv.ViewChanges, seq); best != nil {
+		nv.PrePrepare = &model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_PrePrepare,
+				View: view, SeqNum: seq,
+				SignerId: pbft.ws.CurVerfier.PublickKey,
+				BlockId:  best.Block.BlockId,
+			},
+			Block: proto.Clone(best.Block).(*model.PbftBlock),
+		}
+	}
+	return nv
+}
+
+// enterNewView 校验通过的NewView消息 进入新的视图
+func (pbft *PBFT) enterNewView(nv *model.PbftNewView) {
+	seq, view := nv.Info.SeqNum, nv.Info.View
+	pbft.logger.Infof("进入新视图, 区块高度: %d, 视图编号: %d", seq, view)
+	pbft.ws.SetView(view)
+	pbft.emit(&Event{Type: EventViewChange, SeqNum: seq, View: view, State: "new_view"})
+	newViewCount.Inc()
+	pbft.sm.waitingNewView = false
+	pbft.sm.event = evNewView
+	// 当前高度之后已经prepared的区块 由各自的主节点在新视图中重新提议
+	pbft.sm.reproposals = make(map[uint64]*model.PbftBlock)
+	pbft.sm.reproposalView = view
+	for _, blk := range certChain(nv.ViewChanges, seq) {
+		if blk.BlockNum > seq {
+			pbft.sm.reproposals[blk.BlockNum] = blk
+		}
+	}
+
+	if nv.PrePrepare == nil {
+		pbft.ChangeState(model.States_NotStartd)
+		return
+	}
+	// 把重新提议的区块作为新视图下主节点的pre-prepare消息
+	pp := nv.PrePrepare
+	ppMsg := model.NewPbftMessage(pp)
+	pbft.mm.addMsg(seq, view, model.MessageType_PrePrepare, pp.Info.SignerId, ppMsg, pp, nil, nil)
+	pbft.mm.addBlock(seq, view, proto.Clone(pp.Block).(*model.PbftBlock))
+	pbft.walAppend(seq, view, model.MessageType_PrePrepare, pp.Info.SignerId, ppMsg)
+	pbft.ChangeState(model.States_PrePreparing)
+}
+
+// migrateViewChanging 处于ViewChanging状态时的状态迁移
+func (pbft *PBFT) migrateViewChanging() {
+	seq, view := pbft.ws.BlockNum+1, pbft.ws.View
+	viewChangeMsg := pbft.FindStateMsgBySinger(seq, view, model.MessageType_ViewChange, pbft.ws.CurVerfier.PublickKey)
+	if viewChangeMsg != nil {
+		if !viewChangeMsg.Broadcast {
+			pbft.AddBroadcastTask(viewChangeMsg)
+		}
+	}
+
+	// 已经收到新视图的NewView消息
+	nvMsg := pbft.FindStateMsgBySinger(seq, view+1, model.MessageType_NewView, pbft.primarySigner(seq, view+1))
+	if nvMsg != nil {
+		pbft.enterNewView(nvMsg.NewViewMsg)
+		return
+	}
+
+	msgBysigners := pbft.FindStateMsg(seq, view, model.MessageType_ViewChange)
+	if len(msgBysigners) == 0 {
+		pbft.logger.Debugf("当前状态为%s 暂未收到%s类型消息",
+			model.States_name[int32(model.States_ViewChanging)], model.MessageType_name[int32(model.MessageType_ViewChange)])
+		return
+	}
+	if !pbft.hasQuorum(msgSigners(msgBysigners)) {
+		return
+	}
+
+	if bytes.Compare(pbft.primarySigner(seq, view+1), pbft.ws.CurVerfier.PublickKey) != 0 {
+		// 等待新视图的主节点发送NewView 如果超时 则放弃这个新视图
+		if !pbft.sm.waitingNewView {
+			pbft.emitQuorum(seq, view, model.MessageType_ViewChange, "", len(msgBysigners))
+			pbft.sm.waitingNewView = true
+			resetTimer(pbft.stateTimeout, pbft.stateTimeoutDuration())
+		}
+		return
+	}
+
+	// 本节点是新视图的主节点
+	pbft.emitQuorum(seq, view, model.MessageType_ViewChange, "", len(msgBysigners))
+	signedMsg, err := pbft.SignMsg(model.NewPbftMessage(pbft.newViewMsg(msgBysigners)))
+	if err != nil {
+		pbft.logger.Warnf("生成NewView消息时 签名发生错误 err: %v", err)
+		return
+	}
+	pbft.AppendMsg(signedMsg)
+	pbft.broadcastStateMsg(signedMsg)
+	pbft.enterNewView(signedMsg.GetNewView())
+}
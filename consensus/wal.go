@@ -0,0 +1,289 @@
+package consensus
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/database"
+)
+
+/*
+	wal: 共识预写日志
+	sign-{seq}-{view}-{type}          本节点签名过的区块ID 签名之前先写入 重启后拒绝对同一个位置签名不同的区块
+	msg-{seq}-{view}-{type}-{signer}  已经追加到消息日志中的消息 包括本节点发出的和收到的投票
+	state                             状态机最后所处的高度 视图和状态
+	evidence-{hash}                   发现或收到的双签证据 不随checkpoint清除
+	高度和视图补零 保证按key遍历时有序 稳定checkpoint及以下的记录会被清除
+*/
+
+const defaultWALPath = "./.counch/pbft/consensus_wal.db"
+
+// MemoryWAL 预写日志只保存在内存中 用于测试和模拟
+const MemoryWAL = ":memory:"
+
+const (
+	walSignPrefix     = "sign-"
+	walMsgPrefix      = "msg-"
+	walStateKey       = "state"
+	walEvidencePrefix = "evidence-"
+)
+
+type WAL struct {
+	db database.DB
+}
+
+type walEvidence struct {
+	Height   uint64 `json:"height"`
+	Evidence []byte `json:"evidence"`
+}
+
+type walState struct {
+	SeqNum uint64       `json:"seq_num"`
+	View   uint64       `json:"view"`
+	State  model.States `json:"state"`
+}
+
+func NewWAL(db database.DB) *WAL {
+	return &WAL{db: db}
+}
+
+func walPos(seq, view uint64, msgType model.MessageType) string {
+	return fmt.Sprintf("%020d-%020d-%02d", seq, view, msgType)
+}
+
+// signedBlockID 本节点在此位置已经签名过的区块ID
+func (w *WAL) signedBlockID(seq, view uint64, msgType model.MessageType) (string, error) {
+	return w.db.Get(walSignPrefix + walPos(seq, view, msgType))
+}
+
+// writeSign 签名记录同步写入 崩溃后不能丢失已经发出的签名
+func (w *WAL) writeSign(seq, view uint64, msgType model.MessageType, blockID string) error {
+	return w.db.SetSync(walSignPrefix+walPos(seq, view, msgType), blockID)
+}
+
+func (w *WAL) writeMsg(seq, view uint64, msgType model.MessageType, signer []byte, msg *model.PbftMessage) error {
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return w.db.Set(fmt.Sprintf("%s%s-%x", walMsgPrefix, walPos(seq, view, msgType), signer), string(body))
+}
+
+func (w *WAL) writeState(seq, view uint64, state model.States) error {
+	body, _ := json.Marshal(walState{SeqNum: seq, View: view, State: state})
+	return w.db.Set(walStateKey, string(body))
+}
+
+func (w *WAL) readState() (*walState, error) {
+	v, err := w.db.Get(walStateKey)
+	if err != nil || v == "" {
+		return nil, err
+	}
+	var st walState
+	if err := json.Unmarshal([]byte(v), &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (w *WAL) writeEvidence(e *Equivocation) error {
+	body, err := proto.Marshal(e.Evidence)
+	if err != nil {
+		return err
+	}
+	value, _ := json.Marshal(walEvidence{Height: e.Height, Evidence: body})
+	return w.db.Set(fmt.Sprintf("%s%x", walEvidencePrefix, e.Hash), string(value))
+}
+
+func (w *WAL) deleteEvidence(hash []byte) error {
+	return w.db.Delete(fmt.Sprintf("%s%x", walEvidencePrefix, hash))
+}
+
+// evidences 读取所有双签证据
+func (w *WAL) evidences(fn func(e *Equivocation)) error {
+	var decodeErr error
+	err := w.db.Scan(walEvidencePrefix, func(key, value string) bool {
+		var we walEvidence
+		var ev model.EquivocationEvidence
+		if err := json.Unmarshal([]byte(value), &we); err != nil {
+			decodeErr = fmt.Errorf("wal记录%s解析失败 err: %v", key, err)
+			return false
+		}
+		if err := proto.Unmarshal(we.Evidence, &ev); err != nil {
+			decodeErr = fmt.Errorf("wal记录%s解析失败 err: %v", key, err)
+			return false
+		}
+		fn(&Equivocation{Evidence: &ev, Hash: ev.Hash(), Height: we.Height})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// messages 按高度 视图顺序读取所有消息
+func (w *WAL) messages(fn func(msg *model.PbftMessage)) error {
+	var decodeErr error
+	err := w.db.Scan(walMsgPrefix, func(key, value string) bool {
+		var msg model.PbftMessage
+		if err := proto.Unmarshal([]byte(value), &msg); err != nil {
+			decodeErr = fmt.Errorf("wal记录%s解析失败 err: %v", key, err)
+			return false
+		}
+		fn(&msg)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// truncate 清除稳定checkpoint及以下的记录
+func (w *WAL) truncate(stable uint64) error {
+	for _, prefix := range []string{walSignPrefix, walMsgPrefix} {
+		keys := make([]string, 0)
+		err := w.db.Scan(prefix, func(key, value string) bool {
+			seq, err := strconv.ParseUint(strings.SplitN(strings.TrimPrefix(key, prefix), "-", 2)[0], 10, 64)
+			if err != nil || seq > stable {
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := w.db.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walPath 共识预写日志的存储路径
+func (pbft *PBFT) walPath() string {
+	if pbft.cfg.ConsensusCfg.WALPath == "" {
+		return defaultWALPath
+	}
+	return pbft.cfg.ConsensusCfg.WALPath
+}
+
+// checkDoubleSign 签名之前检查是否已经对同一位置的其他区块签过名 没有则先写入日志
+func (pbft *PBFT) checkDoubleSign(msgInfo *model.PbftMessageInfo) error {
+	if pbft.wal == nil || msgInfo.BlockId == "" {
+		return nil
+	}
+	signed, err := pbft.wal.signedBlockID(msgInfo.SeqNum, msgInfo.View, msgInfo.MsgType)
+	if err != nil {
+		return err
+	}
+	if signed != "" {
+		if signed != msgInfo.BlockId {
+			return fmt.Errorf("拒绝双签 高度: %d, 视图: %d, 消息类型: %s, 已签名区块: %s, 当前区块: %s",
+				msgInfo.SeqNum, msgInfo.View, msgInfo.MsgType, signed, msgInfo.BlockId)
+		}
+		return nil
+	}
+	return pbft.wal.writeSign(msgInfo.SeqNum, msgInfo.View, msgInfo.MsgType, msgInfo.BlockId)
+}
+
+// walWriteEvidence 把双签证据写入预写日志
+func (pbft *PBFT) walWriteEvidence(e *Equivocation) {
+	if pbft.wal == nil {
+		return
+	}
+	if err := pbft.wal.writeEvidence(e); err != nil {
+		pbft.logger.Warnf("写入双签证据失败 err: %v", err)
+	}
+}
+
+// walAppend 把追加到消息日志中的消息写入预写日志
+func (pbft *PBFT) walAppend(seq, view uint64, msgType model.MessageType, signer []byte, msg *model.PbftMessage) {
+	if pbft.wal == nil || msgType == model.MessageType_NewBlockProposal {
+		return
+	}
+	if err := pbft.wal.writeMsg(seq, view, msgType, signer, msg); err != nil {
+		pbft.logger.Warnf("写入共识预写日志失败 err: %v", err)
+	}
+}
+
+// walSaveState 记录状态机当前的状态
+func (pbft *PBFT) walSaveState(s model.States) {
+	if pbft.wal == nil || pbft.StopFlag {
+		return
+	}
+	if err := pbft.wal.writeState(pbft.ws.BlockNum+1, pbft.ws.View, s); err != nil {
+		pbft.logger.Warnf("写入共识状态失败 err: %v", err)
+	}
+}
+
+// replayWAL 启动时重放预写日志 恢复消息日志和状态机
+func (pbft *PBFT) replayWAL() error {
+	err := pbft.wal.evidences(func(e *Equivocation) {
+		pbft.mm.addEquivocation(e)
+	})
+	if err != nil {
+		return err
+	}
+	cnt := 0
+	err = pbft.wal.messages(func(msg *model.PbftMessage) {
+		info := msgInfoOf(msg)
+		if info == nil {
+			return
+		}
+		if info.MsgType != model.MessageType_Checkpoint && info.SeqNum <= pbft.ws.BlockNum {
+			return
+		}
+		if pbft.AppendMsg(msg) {
+			cnt++
+		}
+		if gm := msg.GetGeneric(); gm != nil && gm.Info.MsgType == model.MessageType_Checkpoint {
+			pbft.processCheckpoint(gm.Info.SeqNum, gm.Info.BlockId)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	st, err := pbft.wal.readState()
+	if err != nil {
+		return err
+	}
+	// 只有还未提交的高度才需要恢复状态
+	if st != nil && st.SeqNum == pbft.ws.BlockNum+1 && st.View >= pbft.ws.View {
+		pbft.ws.SetView(st.View)
+		state := st.State
+		if state == model.States_Finished {
+			// 区块还未提交 重新检查commit消息
+			state = model.States_Committing
+		}
+		pbft.sm.state = state
+		if blk := pbft.FindBlock(st.SeqNum, st.View); blk != nil &&
+			blk.BlockId == pbft.proposalDigest(st.SeqNum, st.View) && pbft.blockHasQuorum(blk) {
+			pbft.sm.receivedBlock = blk
+		}
+	}
+	pbft.logger.Infof("共识预写日志重放完成 恢复消息数量: %d, 状态: %s, 视图: %d",
+		cnt, model.States_name[int32(pbft.sm.state)], pbft.ws.View)
+	return nil
+}
+
+func msgInfoOf(msg *model.PbftMessage) *model.PbftMessageInfo {
+	switch m := getPbftMsg(msg).(type) {
+	case *model.PbftGenericMessage:
+		return m.Info
+	case *model.PbftViewChange:
+		return m.Info
+	case *model.PbftNewView:
+		return m.Info
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package consensus
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/storage/database"
+)
+
+func TestWAL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.NewLevelDB(path.Join(dir, "wal.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWAL(db)
+
+	for seq := uint64(1); seq <= 12; seq++ {
+		w.writeSign(seq, 0, model.MessageType_Prepare, "blk")
+		msg := model.NewPbftMessage(&model.PbftGenericMessage{
+			Info: &model.PbftMessageInfo{MsgType: model.MessageType_Prepare, SeqNum: seq, BlockId: "blk"},
+		})
+		w.writeMsg(seq, 0, model.MessageType_Prepare, []byte{1}, msg)
+	}
+	if err := w.truncate(10); err != nil {
+		t.Fatal(err)
+	}
+
+	seqs := make([]uint64, 0)
+	if err := w.messages(func(msg *model.PbftMessage) {
+		seqs = append(seqs, msg.GetGeneric().Info.SeqNum)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) != 2 || seqs[0] != 11 || seqs[1] != 12 {
+		t.Fatalf("truncate之后的消息错误 seqs: %v", seqs)
+	}
+	if id, _ := w.signedBlockID(10, 0, model.MessageType_Prepare); id != "" {
+		t.Fatalf("签名记录没有被清除 id: %s", id)
+	}
+	if id, _ := w.signedBlockID(11, 0, model.MessageType_Prepare); id != "blk" {
+		t.Fatalf("签名记录错误 id: %s", id)
+	}
+}
@@ -81,11 +81,8 @@ func random(n int) ([]byte, error) {
 }
 
 func Sign(priv *ecdsa.PrivateKey, conetnt []byte) (string, error) {
-	rd, err := random(32)
-	if err != nil {
-		return "", err
-	}
-	r, s, err := ecdsa.Sign(bytes.NewBuffer(rd), priv, conetnt)
+	// 签名需要读取的随机数长度由标准库决定 不能使用固定长度的缓冲区
+	r, s, err := ecdsa.Sign(rand.Reader, priv, conetnt)
 	if err != nil {
 		return "", err
 	}
@@ -71,6 +71,14 @@ func (vm *VirtualMachine) Eval(tx *model.Tx, snap *Snapshot) (*model.TxReceipt,
 	if err != nil || !ok {
 		return txr, fmt.Errorf("交易签名不一致")
 	}
+	if tx.IsValidatorChange() {
+		if err := vm.checkValidatorChange(tx, account); err != nil {
+			return txr, err
+		}
+		txr.Status = 0
+		snap.UpdateTxByID(tx)
+		return txr, nil
+	}
 
 	// 获取receipt的账户
 	var recv *model.Account
@@ -145,6 +153,16 @@ func (vm *VirtualMachine) Exec(tx *model.Tx) (*model.TxReceipt, error) {
 	if err != nil || !ok {
 		return txr, fmt.Errorf("交易签名不一致")
 	}
+	if tx.IsValidatorChange() {
+		if err := vm.checkValidatorChange(tx, account); err != nil {
+			return txr, err
+		}
+		txr.Status = 0
+		if err := vm.db.Insert(tx); err != nil {
+			return txr, err
+		}
+		return txr, vm.db.Insert(txr)
+	}
 
 	// 获取receipt的账户
 	recv, err := vm.db.GetAccountByID(tx.Recipient.Address)
@@ -187,6 +205,18 @@ func (vm *VirtualMachine) Exec(tx *model.Tx) (*model.TxReceipt, error) {
 	return txr, nil
 }
 
+// checkValidatorChange 验证者变更交易只能由管理员账户发出 并且不能转账
+func (vm *VirtualMachine) checkValidatorChange(tx *model.Tx, account *model.Account) error {
+	if account.AccountType&int32(model.AccountType_Admin) == 0 {
+		return fmt.Errorf("只有管理员账户才能变更验证者")
+	}
+	if tx.Amount != nil && tx.Amount.Amount != "" && model.Compare(tx.Amount.Amount, "0") != 0 {
+		return fmt.Errorf("验证者变更交易不能转账")
+	}
+	_, err := tx.DecodeValidatorChange()
+	return err
+}
+
 func (vm *VirtualMachine) CopyAccount(account *model.Account) *model.Account {
 	code := make([]byte, 0, len(account.Code))
 	copy(code, account.Code)
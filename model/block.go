@@ -0,0 +1,100 @@
+package model
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+)
+
+// HeaderHash 区块哈希 只包含区块头字段 不包含签名 区块ID为其十六进制编码
+func (blk *PbftBlock) HeaderHash() []byte {
+	b := PbftBlock{
+		PrevBlock:      blk.PrevBlock,
+		BlockNum:       blk.BlockNum,
+		TxRoot:         blk.TxRoot,
+		TxReceiptsRoot: blk.TxReceiptsRoot,
+		EvidenceRoot:   blk.EvidenceRoot,
+		TimeStamp:      blk.TimeStamp,
+		BlockId:        "",
+		View:           blk.View,
+	}
+	content, _ := proto.Marshal(&b)
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
+
+// Hash 创世区块哈希 不同链的节点握手时以此区分 不包含验证者私钥
+func (g *Genesis) Hash() []byte {
+	c := Genesis{Verifiers: make([]*Verifier, 0, len(g.Verifiers))}
+	for _, v := range g.Verifiers {
+		pub := proto.Clone(v).(*Verifier)
+		pub.PrivateKey = nil
+		c.Verifiers = append(c.Verifiers, pub)
+	}
+	content, _ := proto.Marshal(&c)
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
+
+// blockSigns 区块上所有的签名 包括主节点签名 同一个签名者只保留第一个
+func (blk *PbftBlock) blockSigns() map[string][]byte {
+	signs := make(map[string][]byte, len(blk.SignPairs)+1)
+	if len(blk.SignerId) != 0 {
+		signs[string(blk.SignerId)] = blk.Sign
+	}
+	for _, pair := range blk.SignPairs {
+		if _, ok := signs[string(pair.SignerId)]; !ok {
+			signs[string(pair.SignerId)] = pair.Sign
+		}
+	}
+	return signs
+}
+
+// VerifiedSigners 返回区块上签名正确的验证者
+// 区块带有签名位图时只统计位图中的验证者 位图中的验证者没有正确的签名时返回错误
+func (blk *PbftBlock) VerifiedSigners(verifiers []*Verifier, hash []byte) ([][]byte, error) {
+	signs := blk.blockSigns()
+	if len(blk.SignerBitmap) != 0 {
+		signers := BitmapSigners(verifiers, blk.SignerBitmap)
+		if signers == nil {
+			return nil, fmt.Errorf("签名位图长度和验证者数量不一致")
+		}
+		for _, s := range signers {
+			sign, ok := signs[string(s)]
+			if !ok || !verifyHashSign(s, sign, hash) {
+				return nil, fmt.Errorf("签名位图中的验证者%x没有正确的签名", s)
+			}
+		}
+		return signers, nil
+	}
+	signers := make([][]byte, 0, len(signs))
+	for _, v := range verifiers {
+		sign, ok := signs[string(v.PublickKey)]
+		if ok && verifyHashSign(v.PublickKey, sign, hash) {
+			signers = append(signers, v.PublickKey)
+		}
+	}
+	return signers, nil
+}
+
+// VerifyQuorum 校验区块上签名正确的验证者的投票权重超过总权重的2/3
+func (blk *PbftBlock) VerifyQuorum(verifiers []*Verifier, hash []byte) error {
+	signers, err := blk.VerifiedSigners(verifiers, hash)
+	if err != nil {
+		return err
+	}
+	if !HasQuorum(verifiers, signers) {
+		return fmt.Errorf("签名的投票权重%d 少于%d", SignedPower(verifiers, signers), QuorumPower(verifiers))
+	}
+	return nil
+}
+
+func verifyHashSign(pub, sign, hash []byte) bool {
+	pubKey, err := cryptogo.LoadPublicKey(fmt.Sprintf("0x%x", pub))
+	if err != nil {
+		return false
+	}
+	return cryptogo.VerifySign(pubKey, fmt.Sprintf("0x%x", sign), fmt.Sprintf("0x%x", hash))
+}
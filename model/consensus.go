@@ -1,6 +1,12 @@
 package model
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common"
+)
 
 func (msg *PbftMessage) setValue(val interface{}) error {
 	switch x := val.(type) {
@@ -8,6 +14,10 @@ func (msg *PbftMessage) setValue(val interface{}) error {
 		msg.Msg = &PbftMessage_Generic{Generic: x}
 	case *PbftViewChange:
 		msg.Msg = &PbftMessage_ViewChange{ViewChange: x}
+	case *PbftNewView:
+		msg.Msg = &PbftMessage_NewView{NewView: x}
+	case *EquivocationEvidence:
+		msg.Msg = &PbftMessage_Evidence{Evidence: x}
 	default:
 		return fmt.Errorf("PbftMessage.Value has unexpected type %T", x)
 	}
@@ -19,3 +29,30 @@ func NewPbftMessage(val interface{}) *PbftMessage {
 	msg.setValue(val)
 	return msg
 }
+
+// NewEquivocationEvidence 由两条冲突的消息生成双签证据 按区块ID排序 保证同一对消息生成的证据相同
+func NewEquivocationEvidence(a, b *PbftMessageInfo) *EquivocationEvidence {
+	if a.BlockId > b.BlockId {
+		a, b = b, a
+	}
+	return &EquivocationEvidence{First: a, Second: b}
+}
+
+// Hash 双签证据的哈希 用于去重
+func (e *EquivocationEvidence) Hash() []byte {
+	content, _ := proto.Marshal(e)
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
+
+// EvidenceRoot 双签证据的默克尔根 没有证据时返回nil 保证不包含证据的区块哈希不变
+func EvidenceRoot(evs []*EquivocationEvidence) []byte {
+	if len(evs) == 0 {
+		return nil
+	}
+	hashes := make([][]byte, 0, len(evs))
+	for i := range evs {
+		hashes = append(hashes, evs[i].Hash())
+	}
+	return common.Merkel(hashes)
+}
@@ -30,6 +30,7 @@ const (
 	MessageType_Checkpoint       MessageType = 4
 	MessageType_ViewChange       MessageType = 5
 	MessageType_NewBlockProposal MessageType = 6
+	MessageType_NewView          MessageType = 7
 )
 
 // Enum value maps for MessageType.
@@ -42,6 +43,7 @@ var (
 		4: "Checkpoint",
 		5: "ViewChange",
 		6: "NewBlockProposal",
+		7: "NewView",
 	}
 	MessageType_value = map[string]int32{
 		"Default":          0,
@@ -51,6 +53,7 @@ var (
 		"Checkpoint":       4,
 		"ViewChange":       5,
 		"NewBlockProposal": 6,
+		"NewView":          7,
 	}
 )
 
@@ -227,6 +230,12 @@ type PbftBlock struct {
 	// 视图编号
 	View      uint64       `protobuf:"varint,10,opt,name=view,proto3" json:"view,omitempty"`
 	SignPairs []*SignPairs `protobuf:"bytes,8,rep,name=sign_pairs,json=signPairs,proto3" json:"sign_pairs,omitempty"`
+	// 区块中包含的双签证据
+	Evidences []*EquivocationEvidence `protobuf:"bytes,13,rep,name=evidences,proto3" json:"evidences,omitempty"`
+	// 双签证据的默克尔根 没有证据时为空
+	EvidenceRoot []byte `protobuf:"bytes,14,opt,name=evidence_root,json=evidenceRoot,proto3" json:"evidence_root,omitempty"`
+	// 签名的验证者 按验证者在当前集合中的编号记录的位图 提交时生成 不参与区块哈希
+	SignerBitmap []byte `protobuf:"bytes,15,opt,name=signer_bitmap,json=signerBitmap,proto3" json:"signer_bitmap,omitempty"`
 }
 
 func (x *PbftBlock) Reset() {
@@ -345,6 +354,27 @@ func (x *PbftBlock) GetSignPairs() []*SignPairs {
 	return nil
 }
 
+func (x *PbftBlock) GetEvidences() []*EquivocationEvidence {
+	if x != nil {
+		return x.Evidences
+	}
+	return nil
+}
+
+func (x *PbftBlock) GetEvidenceRoot() []byte {
+	if x != nil {
+		return x.EvidenceRoot
+	}
+	return nil
+}
+
+func (x *PbftBlock) GetSignerBitmap() []byte {
+	if x != nil {
+		return x.SignerBitmap
+	}
+	return nil
+}
+
 type PbftMessageInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -360,6 +390,8 @@ type PbftMessageInfo struct {
 	SignerId []byte `protobuf:"bytes,4,opt,name=signer_id,json=signerId,proto3" json:"signer_id,omitempty"`
 	// 签名内容
 	Sign []byte `protobuf:"bytes,5,opt,name=sign,proto3" json:"sign,omitempty"`
+	// 消息对应的区块ID checkpoint消息中为该高度已提交的区块ID
+	BlockId string `protobuf:"bytes,6,opt,name=block_id,json=blockId,proto3" json:"block_id,omitempty"`
 }
 
 func (x *PbftMessageInfo) Reset() {
@@ -429,6 +461,13 @@ func (x *PbftMessageInfo) GetSign() []byte {
 	return nil
 }
 
+func (x *PbftMessageInfo) GetBlockId() string {
+	if x != nil {
+		return x.BlockId
+	}
+	return ""
+}
+
 // PbftGenericMessage A generic PBFT message (PrePrepare, Prepare, Commit, Checkpoint)
 type PbftGenericMessage struct {
 	state         protoimpl.MessageState
@@ -507,6 +546,8 @@ type PbftViewChange struct {
 	// Set of `2f + 1` Checkpoint messages, proving correctness of stable
 	// Checkpoint mentioned in info's `seq_num`
 	CheckpointMessages []*PbftGenericMessage `protobuf:"bytes,2,rep,name=checkpoint_messages,json=checkpointMessages,proto3" json:"checkpoint_messages,omitempty"`
+	// 发送者持有的prepared证书
+	PreparedCerts []*PbftPreparedCert `protobuf:"bytes,3,rep,name=prepared_certs,json=preparedCerts,proto3" json:"prepared_certs,omitempty"`
 }
 
 func (x *PbftViewChange) Reset() {
@@ -555,6 +596,194 @@ func (x *PbftViewChange) GetCheckpointMessages() []*PbftGenericMessage {
 	return nil
 }
 
+func (x *PbftViewChange) GetPreparedCerts() []*PbftPreparedCert {
+	if x != nil {
+		return x.PreparedCerts
+	}
+	return nil
+}
+
+// prepared证书 证明区块在某个视图下已经prepared
+type PbftPreparedCert struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// 已收集到2f+1签名的区块
+	Block *PbftBlock `protobuf:"bytes,1,opt,name=block,proto3" json:"block,omitempty"`
+	// 同一视图下2f+1个prepare消息
+	Prepares []*PbftMessageInfo `protobuf:"bytes,2,rep,name=prepares,proto3" json:"prepares,omitempty"`
+}
+
+func (x *PbftPreparedCert) Reset() {
+	*x = PbftPreparedCert{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_consensus_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PbftPreparedCert) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PbftPreparedCert) ProtoMessage() {}
+
+func (x *PbftPreparedCert) ProtoReflect() protoreflect.Message {
+	mi := &file_consensus_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PbftPreparedCert.ProtoReflect.Descriptor instead.
+func (*PbftPreparedCert) Descriptor() ([]byte, []int) {
+	return file_consensus_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PbftPreparedCert) GetBlock() *PbftBlock {
+	if x != nil {
+		return x.Block
+	}
+	return nil
+}
+
+func (x *PbftPreparedCert) GetPrepares() []*PbftMessageInfo {
+	if x != nil {
+		return x.Prepares
+	}
+	return nil
+}
+
+// NewView 新视图的主节点在收集到2f+1个viewchange消息后广播
+type PbftNewView struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Info *PbftMessageInfo `protobuf:"bytes,1,opt,name=info,proto3" json:"info,omitempty"`
+	// 证明新视图合法的2f+1个viewchange消息
+	ViewChanges []*PbftViewChange `protobuf:"bytes,2,rep,name=view_changes,json=viewChanges,proto3" json:"view_changes,omitempty"`
+	// 重新提议的区块 viewchange消息中没有prepared证书时为空
+	PrePrepare *PbftGenericMessage `protobuf:"bytes,3,opt,name=pre_prepare,json=prePrepare,proto3" json:"pre_prepare,omitempty"`
+}
+
+func (x *PbftNewView) Reset() {
+	*x = PbftNewView{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_consensus_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PbftNewView) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PbftNewView) ProtoMessage() {}
+
+func (x *PbftNewView) ProtoReflect() protoreflect.Message {
+	mi := &file_consensus_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PbftNewView.ProtoReflect.Descriptor instead.
+func (*PbftNewView) Descriptor() ([]byte, []int) {
+	return file_consensus_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PbftNewView) GetInfo() *PbftMessageInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *PbftNewView) GetViewChanges() []*PbftViewChange {
+	if x != nil {
+		return x.ViewChanges
+	}
+	return nil
+}
+
+func (x *PbftNewView) GetPrePrepare() *PbftGenericMessage {
+	if x != nil {
+		return x.PrePrepare
+	}
+	return nil
+}
+
+// EquivocationEvidence 双签证据 同一个签名者在同一高度和视图下对不同区块签名的两条消息
+// 两条消息都带有签名 任何节点都可以独立验证
+type EquivocationEvidence struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	First  *PbftMessageInfo `protobuf:"bytes,1,opt,name=first,proto3" json:"first,omitempty"`
+	Second *PbftMessageInfo `protobuf:"bytes,2,opt,name=second,proto3" json:"second,omitempty"`
+}
+
+func (x *EquivocationEvidence) Reset() {
+	*x = EquivocationEvidence{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_consensus_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EquivocationEvidence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EquivocationEvidence) ProtoMessage() {}
+
+func (x *EquivocationEvidence) ProtoReflect() protoreflect.Message {
+	mi := &file_consensus_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EquivocationEvidence.ProtoReflect.Descriptor instead.
+func (*EquivocationEvidence) Descriptor() ([]byte, []int) {
+	return file_consensus_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *EquivocationEvidence) GetFirst() *PbftMessageInfo {
+	if x != nil {
+		return x.First
+	}
+	return nil
+}
+
+func (x *EquivocationEvidence) GetSecond() *PbftMessageInfo {
+	if x != nil {
+		return x.Second
+	}
+	return nil
+}
+
 type PbftMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -563,13 +792,15 @@ type PbftMessage struct {
 	// Types that are assignable to Msg:
 	//	*PbftMessage_Generic
 	//	*PbftMessage_ViewChange
+	//	*PbftMessage_NewView
+	//	*PbftMessage_Evidence
 	Msg isPbftMessage_Msg `protobuf_oneof:"msg"`
 }
 
 func (x *PbftMessage) Reset() {
 	*x = PbftMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_consensus_proto_msgTypes[5]
+		mi := &file_consensus_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -582,7 +813,7 @@ func (x *PbftMessage) String() string {
 func (*PbftMessage) ProtoMessage() {}
 
 func (x *PbftMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_consensus_proto_msgTypes[5]
+	mi := &file_consensus_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -595,7 +826,7 @@ func (x *PbftMessage) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PbftMessage.ProtoReflect.Descriptor instead.
 func (*PbftMessage) Descriptor() ([]byte, []int) {
-	return file_consensus_proto_rawDescGZIP(), []int{5}
+	return file_consensus_proto_rawDescGZIP(), []int{8}
 }
 
 func (m *PbftMessage) GetMsg() isPbftMessage_Msg {
@@ -619,6 +850,20 @@ func (x *PbftMessage) GetViewChange() *PbftViewChange {
 	return nil
 }
 
+func (x *PbftMessage) GetNewView() *PbftNewView {
+	if x, ok := x.GetMsg().(*PbftMessage_NewView); ok {
+		return x.NewView
+	}
+	return nil
+}
+
+func (x *PbftMessage) GetEvidence() *EquivocationEvidence {
+	if x, ok := x.GetMsg().(*PbftMessage_Evidence); ok {
+		return x.Evidence
+	}
+	return nil
+}
+
 type isPbftMessage_Msg interface {
 	isPbftMessage_Msg()
 }
@@ -631,10 +876,22 @@ type PbftMessage_ViewChange struct {
 	ViewChange *PbftViewChange `protobuf:"bytes,2,opt,name=view_change,json=viewChange,proto3,oneof"`
 }
 
+type PbftMessage_NewView struct {
+	NewView *PbftNewView `protobuf:"bytes,3,opt,name=new_view,json=newView,proto3,oneof"`
+}
+
+type PbftMessage_Evidence struct {
+	Evidence *EquivocationEvidence `protobuf:"bytes,4,opt,name=evidence,proto3,oneof"`
+}
+
 func (*PbftMessage_Generic) isPbftMessage_Msg() {}
 
 func (*PbftMessage_ViewChange) isPbftMessage_Msg() {}
 
+func (*PbftMessage_NewView) isPbftMessage_Msg() {}
+
+func (*PbftMessage_Evidence) isPbftMessage_Msg() {}
+
 type Verifier struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -643,12 +900,14 @@ type Verifier struct {
 	PublickKey []byte `protobuf:"bytes,1,opt,name=publick_key,json=publickKey,proto3" json:"publick_key,omitempty"`
 	PrivateKey []byte `protobuf:"bytes,2,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
 	SeqNum     int32  `protobuf:"varint,3,opt,name=seq_num,json=seqNum,proto3" json:"seq_num,omitempty"`
+	// 权重 为0时按1计算 签名的权重之和超过总权重的2/3才能达成共识 按权重选择主节点时也使用此权重
+	Weight uint64 `protobuf:"varint,4,opt,name=weight,proto3" json:"weight,omitempty"`
 }
 
 func (x *Verifier) Reset() {
 	*x = Verifier{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_consensus_proto_msgTypes[6]
+		mi := &file_consensus_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -661,7 +920,7 @@ func (x *Verifier) String() string {
 func (*Verifier) ProtoMessage() {}
 
 func (x *Verifier) ProtoReflect() protoreflect.Message {
-	mi := &file_consensus_proto_msgTypes[6]
+	mi := &file_consensus_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -674,7 +933,7 @@ func (x *Verifier) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Verifier.ProtoReflect.Descriptor instead.
 func (*Verifier) Descriptor() ([]byte, []int) {
-	return file_consensus_proto_rawDescGZIP(), []int{6}
+	return file_consensus_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *Verifier) GetPublickKey() []byte {
@@ -698,6 +957,13 @@ func (x *Verifier) GetSeqNum() int32 {
 	return 0
 }
 
+func (x *Verifier) GetWeight() uint64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
 type Genesis struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -709,7 +975,7 @@ type Genesis struct {
 func (x *Genesis) Reset() {
 	*x = Genesis{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_consensus_proto_msgTypes[7]
+		mi := &file_consensus_proto_msgTypes[10]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -722,7 +988,7 @@ func (x *Genesis) String() string {
 func (*Genesis) ProtoMessage() {}
 
 func (x *Genesis) ProtoReflect() protoreflect.Message {
-	mi := &file_consensus_proto_msgTypes[7]
+	mi := &file_consensus_proto_msgTypes[10]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -735,7 +1001,7 @@ func (x *Genesis) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Genesis.ProtoReflect.Descriptor instead.
 func (*Genesis) Descriptor() ([]byte, []int) {
-	return file_consensus_proto_rawDescGZIP(), []int{7}
+	return file_consensus_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *Genesis) GetVerifiers() []*Verifier {
@@ -754,7 +1020,7 @@ var file_consensus_proto_rawDesc = []byte{
 	0x73, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x12,
 	0x0a, 0x04, 0x73, 0x69, 0x67, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x73, 0x69,
-	0x67, 0x6e, 0x22, 0x9c, 0x03, 0x0a, 0x09, 0x50, 0x62, 0x66, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b,
+	0x67, 0x6e, 0x22, 0x9b, 0x04, 0x0a, 0x09, 0x50, 0x62, 0x66, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b,
 	0x12, 0x1d, 0x0a, 0x0a, 0x70, 0x72, 0x65, 0x76, 0x5f, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x70, 0x72, 0x65, 0x76, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12,
 	0x19, 0x0a, 0x08, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
@@ -780,69 +1046,113 @@ var file_consensus_proto_rawDesc = []byte{
 	0x52, 0x04, 0x76, 0x69, 0x65, 0x77, 0x12, 0x29, 0x0a, 0x0a, 0x73, 0x69, 0x67, 0x6e, 0x5f, 0x70,
 	0x61, 0x69, 0x72, 0x73, 0x18, 0x08, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x53, 0x69, 0x67,
 	0x6e, 0x50, 0x61, 0x69, 0x72, 0x73, 0x52, 0x09, 0x73, 0x69, 0x67, 0x6e, 0x50, 0x61, 0x69, 0x72,
-	0x73, 0x22, 0x98, 0x01, 0x0a, 0x0f, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x27, 0x0a, 0x08, 0x6d, 0x73, 0x67, 0x5f, 0x74, 0x79, 0x70,
-	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0c, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x54, 0x79, 0x70, 0x65, 0x52, 0x07, 0x6d, 0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12,
-	0x0a, 0x04, 0x76, 0x69, 0x65, 0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x76, 0x69,
-	0x65, 0x77, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x65, 0x71, 0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x04, 0x52, 0x06, 0x73, 0x65, 0x71, 0x4e, 0x75, 0x6d, 0x12, 0x1b, 0x0a, 0x09, 0x73,
-	0x69, 0x67, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08,
-	0x73, 0x69, 0x67, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x67, 0x6e,
-	0x18, 0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x73, 0x69, 0x67, 0x6e, 0x22, 0x8f, 0x01, 0x0a,
-	0x12, 0x50, 0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x12, 0x24, 0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49,
-	0x6e, 0x66, 0x6f, 0x52, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x20, 0x0a, 0x05, 0x62, 0x6c, 0x6f,
-	0x63, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x42,
-	0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x31, 0x0a, 0x0b, 0x6f,
-	0x74, 0x68, 0x65, 0x72, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b,
-	0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e,
-	0x66, 0x6f, 0x52, 0x0a, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x73, 0x22, 0x7c,
-	0x0a, 0x0e, 0x50, 0x62, 0x66, 0x74, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65,
-	0x12, 0x24, 0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10,
-	0x2e, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f,
-	0x52, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x44, 0x0a, 0x13, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x70,
-	0x6f, 0x69, 0x6e, 0x74, 0x5f, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20,
-	0x03, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x69,
-	0x63, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x12, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x70,
-	0x6f, 0x69, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x22, 0x79, 0x0a, 0x0b,
-	0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x2f, 0x0a, 0x07, 0x67,
-	0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x50,
-	0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x48, 0x00, 0x52, 0x07, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x12, 0x32, 0x0a, 0x0b,
-	0x76, 0x69, 0x65, 0x77, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x73, 0x12, 0x33, 0x0a, 0x09, 0x65, 0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x18, 0x0d,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x45, 0x71, 0x75, 0x69, 0x76, 0x6f, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x45, 0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x09, 0x65, 0x76, 0x69,
+	0x64, 0x65, 0x6e, 0x63, 0x65, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x65, 0x76, 0x69, 0x64, 0x65, 0x6e,
+	0x63, 0x65, 0x5f, 0x72, 0x6f, 0x6f, 0x74, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0c, 0x65,
+	0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x52, 0x6f, 0x6f, 0x74, 0x12, 0x23, 0x0a, 0x0d, 0x73,
+	0x69, 0x67, 0x6e, 0x65, 0x72, 0x5f, 0x62, 0x69, 0x74, 0x6d, 0x61, 0x70, 0x18, 0x0f, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x0c, 0x73, 0x69, 0x67, 0x6e, 0x65, 0x72, 0x42, 0x69, 0x74, 0x6d, 0x61, 0x70,
+	0x22, 0xb3, 0x01, 0x0a, 0x0f, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x27, 0x0a, 0x08, 0x6d, 0x73, 0x67, 0x5f, 0x74, 0x79, 0x70, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0c, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x54, 0x79, 0x70, 0x65, 0x52, 0x07, 0x6d, 0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x76, 0x69, 0x65, 0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x76, 0x69, 0x65,
+	0x77, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x65, 0x71, 0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x06, 0x73, 0x65, 0x71, 0x4e, 0x75, 0x6d, 0x12, 0x1b, 0x0a, 0x09, 0x73, 0x69,
+	0x67, 0x6e, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x73,
+	0x69, 0x67, 0x6e, 0x65, 0x72, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x67, 0x6e, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x73, 0x69, 0x67, 0x6e, 0x12, 0x19, 0x0a, 0x08, 0x62,
+	0x6c, 0x6f, 0x63, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x62,
+	0x6c, 0x6f, 0x63, 0x6b, 0x49, 0x64, 0x22, 0x8f, 0x01, 0x0a, 0x12, 0x50, 0x62, 0x66, 0x74, 0x47,
+	0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x24, 0x0a,
+	0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62,
+	0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x04, 0x69,
+	0x6e, 0x66, 0x6f, 0x12, 0x20, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x52, 0x05,
+	0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x31, 0x0a, 0x0b, 0x6f, 0x74, 0x68, 0x65, 0x72, 0x5f, 0x69,
+	0x6e, 0x66, 0x6f, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66,
+	0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x0a, 0x6f, 0x74,
+	0x68, 0x65, 0x72, 0x49, 0x6e, 0x66, 0x6f, 0x73, 0x22, 0xb6, 0x01, 0x0a, 0x0e, 0x50, 0x62, 0x66,
+	0x74, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x24, 0x0a, 0x04, 0x69,
+	0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x04, 0x69, 0x6e, 0x66,
+	0x6f, 0x12, 0x44, 0x0a, 0x13, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x5f,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x13,
+	0x2e, 0x50, 0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x52, 0x12, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x73, 0x12, 0x38, 0x0a, 0x0e, 0x70, 0x72, 0x65, 0x70, 0x61,
+	0x72, 0x65, 0x64, 0x5f, 0x63, 0x65, 0x72, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x11, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x64, 0x43, 0x65,
+	0x72, 0x74, 0x52, 0x0d, 0x70, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x64, 0x43, 0x65, 0x72, 0x74,
+	0x73, 0x22, 0x62, 0x0a, 0x10, 0x50, 0x62, 0x66, 0x74, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65,
+	0x64, 0x43, 0x65, 0x72, 0x74, 0x12, 0x20, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x42, 0x6c, 0x6f, 0x63, 0x6b,
+	0x52, 0x05, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x2c, 0x0a, 0x08, 0x70, 0x72, 0x65, 0x70, 0x61,
+	0x72, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x08, 0x70, 0x72, 0x65,
+	0x70, 0x61, 0x72, 0x65, 0x73, 0x22, 0x9d, 0x01, 0x0a, 0x0b, 0x50, 0x62, 0x66, 0x74, 0x4e, 0x65,
+	0x77, 0x56, 0x69, 0x65, 0x77, 0x12, 0x24, 0x0a, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x32, 0x0a, 0x0c, 0x76,
+	0x69, 0x65, 0x77, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28,
 	0x0b, 0x32, 0x0f, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e,
-	0x67, 0x65, 0x48, 0x00, 0x52, 0x0a, 0x76, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65,
-	0x42, 0x05, 0x0a, 0x03, 0x6d, 0x73, 0x67, 0x22, 0x65, 0x0a, 0x08, 0x76, 0x65, 0x72, 0x69, 0x66,
-	0x69, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x6b, 0x5f, 0x6b,
-	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63,
-	0x6b, 0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x5f,
-	0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70, 0x72, 0x69, 0x76, 0x61,
-	0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x65, 0x71, 0x5f, 0x6e, 0x75, 0x6d,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x65, 0x71, 0x4e, 0x75, 0x6d, 0x22, 0x32,
-	0x0a, 0x07, 0x67, 0x65, 0x6e, 0x65, 0x73, 0x69, 0x73, 0x12, 0x27, 0x0a, 0x09, 0x76, 0x65, 0x72,
-	0x69, 0x66, 0x69, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x76,
-	0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x72, 0x52, 0x09, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65,
-	0x72, 0x73, 0x2a, 0x79, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70,
-	0x65, 0x12, 0x0b, 0x0a, 0x07, 0x44, 0x65, 0x66, 0x61, 0x75, 0x6c, 0x74, 0x10, 0x00, 0x12, 0x0e,
-	0x0a, 0x0a, 0x50, 0x72, 0x65, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x10, 0x01, 0x12, 0x0b,
-	0x0a, 0x07, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x10, 0x02, 0x12, 0x0a, 0x0a, 0x06, 0x43,
-	0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x10, 0x03, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x68, 0x65, 0x63, 0x6b,
-	0x70, 0x6f, 0x69, 0x6e, 0x74, 0x10, 0x04, 0x12, 0x0e, 0x0a, 0x0a, 0x56, 0x69, 0x65, 0x77, 0x43,
-	0x68, 0x61, 0x6e, 0x67, 0x65, 0x10, 0x05, 0x12, 0x14, 0x0a, 0x10, 0x4e, 0x65, 0x77, 0x42, 0x6c,
-	0x6f, 0x63, 0x6b, 0x50, 0x72, 0x6f, 0x70, 0x6f, 0x73, 0x61, 0x6c, 0x10, 0x06, 0x2a, 0x89, 0x01,
-	0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x65, 0x73, 0x12, 0x0d, 0x0a, 0x09, 0x4e, 0x6f, 0x74, 0x53,
-	0x74, 0x61, 0x72, 0x74, 0x64, 0x10, 0x00, 0x12, 0x10, 0x0a, 0x0c, 0x50, 0x72, 0x65, 0x50, 0x72,
-	0x65, 0x70, 0x61, 0x72, 0x69, 0x6e, 0x67, 0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x72, 0x65,
-	0x70, 0x61, 0x72, 0x69, 0x6e, 0x67, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x43, 0x68, 0x65, 0x63,
-	0x6b, 0x69, 0x6e, 0x67, 0x10, 0x03, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74,
-	0x74, 0x69, 0x6e, 0x67, 0x10, 0x04, 0x12, 0x0c, 0x0a, 0x08, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68,
-	0x65, 0x64, 0x10, 0x05, 0x12, 0x10, 0x0a, 0x0c, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e,
-	0x67, 0x69, 0x6e, 0x67, 0x10, 0x06, 0x12, 0x11, 0x0a, 0x0d, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x70,
-	0x6f, 0x69, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x10, 0x07, 0x42, 0x13, 0x0a, 0x05, 0x6d, 0x6f, 0x64,
-	0x65, 0x6c, 0x50, 0x01, 0x5a, 0x08, 0x2e, 0x2f, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x67, 0x65, 0x52, 0x0b, 0x76, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x73, 0x12,
+	0x34, 0x0a, 0x0b, 0x70, 0x72, 0x65, 0x5f, 0x70, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72,
+	0x69, 0x63, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x52, 0x0a, 0x70, 0x72, 0x65, 0x50, 0x72,
+	0x65, 0x70, 0x61, 0x72, 0x65, 0x22, 0x68, 0x0a, 0x14, 0x45, 0x71, 0x75, 0x69, 0x76, 0x6f, 0x63,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x45, 0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x12, 0x26, 0x0a,
+	0x05, 0x66, 0x69, 0x72, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50,
+	0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05,
+	0x66, 0x69, 0x72, 0x73, 0x74, 0x12, 0x28, 0x0a, 0x06, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x73, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x22,
+	0xd9, 0x01, 0x0a, 0x0b, 0x50, 0x62, 0x66, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x2f, 0x0a, 0x07, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x13, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x47, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x48, 0x00, 0x52, 0x07, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x69, 0x63,
+	0x12, 0x32, 0x0a, 0x0b, 0x76, 0x69, 0x65, 0x77, 0x5f, 0x63, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x56, 0x69, 0x65, 0x77,
+	0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x48, 0x00, 0x52, 0x0a, 0x76, 0x69, 0x65, 0x77, 0x43, 0x68,
+	0x61, 0x6e, 0x67, 0x65, 0x12, 0x29, 0x0a, 0x08, 0x6e, 0x65, 0x77, 0x5f, 0x76, 0x69, 0x65, 0x77,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x50, 0x62, 0x66, 0x74, 0x4e, 0x65, 0x77,
+	0x56, 0x69, 0x65, 0x77, 0x48, 0x00, 0x52, 0x07, 0x6e, 0x65, 0x77, 0x56, 0x69, 0x65, 0x77, 0x12,
+	0x33, 0x0a, 0x08, 0x65, 0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x15, 0x2e, 0x45, 0x71, 0x75, 0x69, 0x76, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x45, 0x76, 0x69, 0x64, 0x65, 0x6e, 0x63, 0x65, 0x48, 0x00, 0x52, 0x08, 0x65, 0x76, 0x69, 0x64,
+	0x65, 0x6e, 0x63, 0x65, 0x42, 0x05, 0x0a, 0x03, 0x6d, 0x73, 0x67, 0x22, 0x7d, 0x0a, 0x08, 0x76,
+	0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x72, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x75, 0x62, 0x6c, 0x69,
+	0x63, 0x6b, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70, 0x75,
+	0x62, 0x6c, 0x69, 0x63, 0x6b, 0x4b, 0x65, 0x79, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x72, 0x69, 0x76,
+	0x61, 0x74, 0x65, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a, 0x70,
+	0x72, 0x69, 0x76, 0x61, 0x74, 0x65, 0x4b, 0x65, 0x79, 0x12, 0x17, 0x0a, 0x07, 0x73, 0x65, 0x71,
+	0x5f, 0x6e, 0x75, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x65, 0x71, 0x4e,
+	0x75, 0x6d, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x22, 0x32, 0x0a, 0x07, 0x67, 0x65,
+	0x6e, 0x65, 0x73, 0x69, 0x73, 0x12, 0x27, 0x0a, 0x09, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65,
+	0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x09, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66,
+	0x69, 0x65, 0x72, 0x52, 0x09, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x65, 0x72, 0x73, 0x2a, 0x86,
+	0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b,
+	0x0a, 0x07, 0x44, 0x65, 0x66, 0x61, 0x75, 0x6c, 0x74, 0x10, 0x00, 0x12, 0x0e, 0x0a, 0x0a, 0x50,
+	0x72, 0x65, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x50,
+	0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x10, 0x02, 0x12, 0x0a, 0x0a, 0x06, 0x43, 0x6f, 0x6d, 0x6d,
+	0x69, 0x74, 0x10, 0x03, 0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69,
+	0x6e, 0x74, 0x10, 0x04, 0x12, 0x0e, 0x0a, 0x0a, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x10, 0x05, 0x12, 0x14, 0x0a, 0x10, 0x4e, 0x65, 0x77, 0x42, 0x6c, 0x6f, 0x63, 0x6b,
+	0x50, 0x72, 0x6f, 0x70, 0x6f, 0x73, 0x61, 0x6c, 0x10, 0x06, 0x12, 0x0b, 0x0a, 0x07, 0x4e, 0x65,
+	0x77, 0x56, 0x69, 0x65, 0x77, 0x10, 0x07, 0x2a, 0x89, 0x01, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74,
+	0x65, 0x73, 0x12, 0x0d, 0x0a, 0x09, 0x4e, 0x6f, 0x74, 0x53, 0x74, 0x61, 0x72, 0x74, 0x64, 0x10,
+	0x00, 0x12, 0x10, 0x0a, 0x0c, 0x50, 0x72, 0x65, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x69, 0x6e,
+	0x67, 0x10, 0x01, 0x12, 0x0d, 0x0a, 0x09, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x69, 0x6e, 0x67,
+	0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x69, 0x6e, 0x67, 0x10, 0x03,
+	0x12, 0x0e, 0x0a, 0x0a, 0x43, 0x6f, 0x6d, 0x6d, 0x69, 0x74, 0x74, 0x69, 0x6e, 0x67, 0x10, 0x04,
+	0x12, 0x0c, 0x0a, 0x08, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64, 0x10, 0x05, 0x12, 0x10,
+	0x0a, 0x0c, 0x56, 0x69, 0x65, 0x77, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x69, 0x6e, 0x67, 0x10, 0x06,
+	0x12, 0x11, 0x0a, 0x0d, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x70, 0x6f, 0x69, 0x6e, 0x74, 0x69, 0x6e,
+	0x67, 0x10, 0x07, 0x42, 0x13, 0x0a, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x50, 0x01, 0x5a, 0x08,
+	0x2e, 0x2f, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -858,39 +1168,53 @@ func file_consensus_proto_rawDescGZIP() []byte {
 }
 
 var file_consensus_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
-var file_consensus_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_consensus_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_consensus_proto_goTypes = []interface{}{
-	(MessageType)(0),           // 0: MessageType
-	(States)(0),                // 1: States
-	(*SignPairs)(nil),          // 2: SignPairs
-	(*PbftBlock)(nil),          // 3: PbftBlock
-	(*PbftMessageInfo)(nil),    // 4: PbftMessageInfo
-	(*PbftGenericMessage)(nil), // 5: PbftGenericMessage
-	(*PbftViewChange)(nil),     // 6: PbftViewChange
-	(*PbftMessage)(nil),        // 7: PbftMessage
-	(*Verifier)(nil),           // 8: verifier
-	(*Genesis)(nil),            // 9: genesis
-	(*Txs)(nil),                // 10: txs
-	(*TxReceipts)(nil),         // 11: txReceipts
+	(MessageType)(0),             // 0: MessageType
+	(States)(0),                  // 1: States
+	(*SignPairs)(nil),            // 2: SignPairs
+	(*PbftBlock)(nil),            // 3: PbftBlock
+	(*PbftMessageInfo)(nil),      // 4: PbftMessageInfo
+	(*PbftGenericMessage)(nil),   // 5: PbftGenericMessage
+	(*PbftViewChange)(nil),       // 6: PbftViewChange
+	(*PbftPreparedCert)(nil),     // 7: PbftPreparedCert
+	(*PbftNewView)(nil),          // 8: PbftNewView
+	(*EquivocationEvidence)(nil), // 9: EquivocationEvidence
+	(*PbftMessage)(nil),          // 10: PbftMessage
+	(*Verifier)(nil),             // 11: verifier
+	(*Genesis)(nil),              // 12: genesis
+	(*Txs)(nil),                  // 13: txs
+	(*TxReceipts)(nil),           // 14: txReceipts
 }
 var file_consensus_proto_depIdxs = []int32{
-	10, // 0: PbftBlock.tansactions:type_name -> txs
-	11, // 1: PbftBlock.transaction_receipts:type_name -> txReceipts
+	13, // 0: PbftBlock.tansactions:type_name -> txs
+	14, // 1: PbftBlock.transaction_receipts:type_name -> txReceipts
 	2,  // 2: PbftBlock.sign_pairs:type_name -> SignPairs
-	0,  // 3: PbftMessageInfo.msg_type:type_name -> MessageType
-	4,  // 4: PbftGenericMessage.info:type_name -> PbftMessageInfo
-	3,  // 5: PbftGenericMessage.block:type_name -> PbftBlock
-	4,  // 6: PbftGenericMessage.other_infos:type_name -> PbftMessageInfo
-	4,  // 7: PbftViewChange.info:type_name -> PbftMessageInfo
-	5,  // 8: PbftViewChange.checkpoint_messages:type_name -> PbftGenericMessage
-	5,  // 9: PbftMessage.generic:type_name -> PbftGenericMessage
-	6,  // 10: PbftMessage.view_change:type_name -> PbftViewChange
-	8,  // 11: genesis.verifiers:type_name -> verifier
-	12, // [12:12] is the sub-list for method output_type
-	12, // [12:12] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	9,  // 3: PbftBlock.evidences:type_name -> EquivocationEvidence
+	0,  // 4: PbftMessageInfo.msg_type:type_name -> MessageType
+	4,  // 5: PbftGenericMessage.info:type_name -> PbftMessageInfo
+	3,  // 6: PbftGenericMessage.block:type_name -> PbftBlock
+	4,  // 7: PbftGenericMessage.other_infos:type_name -> PbftMessageInfo
+	4,  // 8: PbftViewChange.info:type_name -> PbftMessageInfo
+	5,  // 9: PbftViewChange.checkpoint_messages:type_name -> PbftGenericMessage
+	7,  // 10: PbftViewChange.prepared_certs:type_name -> PbftPreparedCert
+	3,  // 11: PbftPreparedCert.block:type_name -> PbftBlock
+	4,  // 12: PbftPreparedCert.prepares:type_name -> PbftMessageInfo
+	4,  // 13: PbftNewView.info:type_name -> PbftMessageInfo
+	6,  // 14: PbftNewView.view_changes:type_name -> PbftViewChange
+	5,  // 15: PbftNewView.pre_prepare:type_name -> PbftGenericMessage
+	4,  // 16: EquivocationEvidence.first:type_name -> PbftMessageInfo
+	4,  // 17: EquivocationEvidence.second:type_name -> PbftMessageInfo
+	5,  // 18: PbftMessage.generic:type_name -> PbftGenericMessage
+	6,  // 19: PbftMessage.view_change:type_name -> PbftViewChange
+	8,  // 20: PbftMessage.new_view:type_name -> PbftNewView
+	9,  // 21: PbftMessage.evidence:type_name -> EquivocationEvidence
+	11, // 22: genesis.verifiers:type_name -> verifier
+	23, // [23:23] is the sub-list for method output_type
+	23, // [23:23] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
 }
 
 func init() { file_consensus_proto_init() }
@@ -961,7 +1285,7 @@ func file_consensus_proto_init() {
 			}
 		}
 		file_consensus_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PbftMessage); i {
+			switch v := v.(*PbftPreparedCert); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -973,7 +1297,7 @@ func file_consensus_proto_init() {
 			}
 		}
 		file_consensus_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Verifier); i {
+			switch v := v.(*PbftNewView); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -985,6 +1309,42 @@ func file_consensus_proto_init() {
 			}
 		}
 		file_consensus_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EquivocationEvidence); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_consensus_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PbftMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_consensus_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Verifier); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_consensus_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Genesis); i {
 			case 0:
 				return &v.state
@@ -997,9 +1357,11 @@ func file_consensus_proto_init() {
 			}
 		}
 	}
-	file_consensus_proto_msgTypes[5].OneofWrappers = []interface{}{
+	file_consensus_proto_msgTypes[8].OneofWrappers = []interface{}{
 		(*PbftMessage_Generic)(nil),
 		(*PbftMessage_ViewChange)(nil),
+		(*PbftMessage_NewView)(nil),
+		(*PbftMessage_Evidence)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -1007,7 +1369,7 @@ func file_consensus_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_consensus_proto_rawDesc,
 			NumEnums:      2,
-			NumMessages:   8,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,82 @@
+package model
+
+/*
+	quorum: 按权重计算的法定数量
+	每个验证者有一个权重 签名者的权重之和超过总权重的2/3时达成共识
+	按权重选择主节点时也使用同一个权重 选为主节点的概率和投票的权重一致
+	所有权重相同时 4个验证者需要3个签名 3个及以下需要全部签名
+*/
+
+// Power 验证者的权重 为0时按1计算
+func (v *Verifier) Power() uint64 {
+	if v.Weight == 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// TotalPower 所有验证者的投票权重之和
+func TotalPower(verifiers []*Verifier) uint64 {
+	var total uint64
+	for _, v := range verifiers {
+		total += v.Power()
+	}
+	return total
+}
+
+// QuorumPower 达成共识需要的最小投票权重 超过总权重的2/3
+func QuorumPower(verifiers []*Verifier) uint64 {
+	return TotalPower(verifiers)*2/3 + 1
+}
+
+// SignedPower 签名者的投票权重之和 重复的签名者和不是验证者的签名者不计算
+func SignedPower(verifiers []*Verifier, signers [][]byte) uint64 {
+	seen := make(map[string]struct{}, len(signers))
+	for _, s := range signers {
+		seen[string(s)] = struct{}{}
+	}
+	var power uint64
+	for _, v := range verifiers {
+		if _, ok := seen[string(v.PublickKey)]; ok {
+			power += v.Power()
+		}
+	}
+	return power
+}
+
+// HasQuorum 签名者的投票权重之和是否超过总权重的2/3
+func HasQuorum(verifiers []*Verifier, signers [][]byte) bool {
+	if len(verifiers) == 0 {
+		return false
+	}
+	return SignedPower(verifiers, signers) >= QuorumPower(verifiers)
+}
+
+// SignerBitmap 签名者的位图 第i位表示验证者列表中编号为i的验证者已经签名
+func SignerBitmap(verifiers []*Verifier, signers [][]byte) []byte {
+	seen := make(map[string]struct{}, len(signers))
+	for _, s := range signers {
+		seen[string(s)] = struct{}{}
+	}
+	bitmap := make([]byte, (len(verifiers)+7)/8)
+	for i, v := range verifiers {
+		if _, ok := seen[string(v.PublickKey)]; ok {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return bitmap
+}
+
+// BitmapSigners 位图中记录的签名者 位图长度和验证者数量不一致时返回nil
+func BitmapSigners(verifiers []*Verifier, bitmap []byte) [][]byte {
+	if len(bitmap) != (len(verifiers)+7)/8 {
+		return nil
+	}
+	signers := make([][]byte, 0, len(verifiers))
+	for i, v := range verifiers {
+		if bitmap[i/8]&(1<<uint(i%8)) != 0 {
+			signers = append(signers, v.PublickKey)
+		}
+	}
+	return signers
+}
@@ -20,6 +20,59 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// 验证者变更的类型
+type ValidatorOp int32
+
+const (
+	ValidatorOp_ValidatorNone    ValidatorOp = 0
+	ValidatorOp_ValidatorAdd     ValidatorOp = 1 // 新增验证者
+	ValidatorOp_ValidatorRemove  ValidatorOp = 2 // 移除验证者
+	ValidatorOp_ValidatorReplace ValidatorOp = 3 // 替换验证者的公钥
+)
+
+// Enum value maps for ValidatorOp.
+var (
+	ValidatorOp_name = map[int32]string{
+		0: "ValidatorNone",
+		1: "ValidatorAdd",
+		2: "ValidatorRemove",
+		3: "ValidatorReplace",
+	}
+	ValidatorOp_value = map[string]int32{
+		"ValidatorNone":    0,
+		"ValidatorAdd":     1,
+		"ValidatorRemove":  2,
+		"ValidatorReplace": 3,
+	}
+)
+
+func (x ValidatorOp) Enum() *ValidatorOp {
+	p := new(ValidatorOp)
+	*p = x
+	return p
+}
+
+func (x ValidatorOp) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ValidatorOp) Descriptor() protoreflect.EnumDescriptor {
+	return file_transaction_proto_enumTypes[0].Descriptor()
+}
+
+func (ValidatorOp) Type() protoreflect.EnumType {
+	return &file_transaction_proto_enumTypes[0]
+}
+
+func (x ValidatorOp) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ValidatorOp.Descriptor instead.
+func (ValidatorOp) EnumDescriptor() ([]byte, []int) {
+	return file_transaction_proto_rawDescGZIP(), []int{0}
+}
+
 type Address struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -374,6 +427,89 @@ func (x *TxReceipts) GetTansactionReceipts() []*TxReceipt {
 	return nil
 }
 
+// 验证者变更 由管理员账户发往ValidatorSetAddress的交易 放在交易的input中
+type ValidatorChange struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Op         ValidatorOp `protobuf:"varint,1,opt,name=op,proto3,enum=ValidatorOp" json:"op,omitempty"`
+	PublickKey []byte      `protobuf:"bytes,2,opt,name=publick_key,json=publickKey,proto3" json:"publick_key,omitempty"`
+	// 只在替换时使用
+	NewPublickKey []byte `protobuf:"bytes,3,opt,name=new_publick_key,json=newPublickKey,proto3" json:"new_publick_key,omitempty"`
+	// 从此高度开始使用新的验证者集合
+	EffectiveHeight uint64 `protobuf:"varint,4,opt,name=effective_height,json=effectiveHeight,proto3" json:"effective_height,omitempty"`
+	// 新增验证者的权重
+	Weight uint64 `protobuf:"varint,5,opt,name=weight,proto3" json:"weight,omitempty"`
+}
+
+func (x *ValidatorChange) Reset() {
+	*x = ValidatorChange{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_transaction_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ValidatorChange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidatorChange) ProtoMessage() {}
+
+func (x *ValidatorChange) ProtoReflect() protoreflect.Message {
+	mi := &file_transaction_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidatorChange.ProtoReflect.Descriptor instead.
+func (*ValidatorChange) Descriptor() ([]byte, []int) {
+	return file_transaction_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ValidatorChange) GetOp() ValidatorOp {
+	if x != nil {
+		return x.Op
+	}
+	return ValidatorOp_ValidatorNone
+}
+
+func (x *ValidatorChange) GetPublickKey() []byte {
+	if x != nil {
+		return x.PublickKey
+	}
+	return nil
+}
+
+func (x *ValidatorChange) GetNewPublickKey() []byte {
+	if x != nil {
+		return x.NewPublickKey
+	}
+	return nil
+}
+
+func (x *ValidatorChange) GetEffectiveHeight() uint64 {
+	if x != nil {
+		return x.EffectiveHeight
+	}
+	return 0
+}
+
+func (x *ValidatorChange) GetWeight() uint64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
 var File_transaction_proto protoreflect.FileDescriptor
 
 var file_transaction_proto_rawDesc = []byte{
@@ -410,9 +546,27 @@ var file_transaction_proto_rawDesc = []byte{
 	0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x72, 0x65, 0x63, 0x65, 0x69, 0x70, 0x74,
 	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x74, 0x78, 0x52, 0x65, 0x63, 0x65,
 	0x69, 0x70, 0x74, 0x52, 0x12, 0x74, 0x61, 0x6e, 0x73, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52,
-	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x73, 0x42, 0x13, 0x0a, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c,
-	0x50, 0x01, 0x5a, 0x08, 0x2e, 0x2f, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x65, 0x63, 0x65, 0x69, 0x70, 0x74, 0x73, 0x22, 0xbb, 0x01, 0x0a, 0x0f, 0x76, 0x61, 0x6c, 0x69,
+	0x64, 0x61, 0x74, 0x6f, 0x72, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x12, 0x1c, 0x0a, 0x02, 0x6f,
+	0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0c, 0x2e, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61,
+	0x74, 0x6f, 0x72, 0x4f, 0x70, 0x52, 0x02, 0x6f, 0x70, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x75, 0x62,
+	0x6c, 0x69, 0x63, 0x6b, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a,
+	0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x6b, 0x4b, 0x65, 0x79, 0x12, 0x26, 0x0a, 0x0f, 0x6e, 0x65,
+	0x77, 0x5f, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x6b, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x0d, 0x6e, 0x65, 0x77, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x63, 0x6b, 0x4b,
+	0x65, 0x79, 0x12, 0x29, 0x0a, 0x10, 0x65, 0x66, 0x66, 0x65, 0x63, 0x74, 0x69, 0x76, 0x65, 0x5f,
+	0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0f, 0x65, 0x66,
+	0x66, 0x65, 0x63, 0x74, 0x69, 0x76, 0x65, 0x48, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x77,
+	0x65, 0x69, 0x67, 0x68, 0x74, 0x2a, 0x5d, 0x0a, 0x0b, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74,
+	0x6f, 0x72, 0x4f, 0x70, 0x12, 0x11, 0x0a, 0x0d, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x6f,
+	0x72, 0x4e, 0x6f, 0x6e, 0x65, 0x10, 0x00, 0x12, 0x10, 0x0a, 0x0c, 0x56, 0x61, 0x6c, 0x69, 0x64,
+	0x61, 0x74, 0x6f, 0x72, 0x41, 0x64, 0x64, 0x10, 0x01, 0x12, 0x13, 0x0a, 0x0f, 0x56, 0x61, 0x6c,
+	0x69, 0x64, 0x61, 0x74, 0x6f, 0x72, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x10, 0x02, 0x12, 0x14,
+	0x0a, 0x10, 0x56, 0x61, 0x6c, 0x69, 0x64, 0x61, 0x74, 0x6f, 0x72, 0x52, 0x65, 0x70, 0x6c, 0x61,
+	0x63, 0x65, 0x10, 0x03, 0x42, 0x13, 0x0a, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x50, 0x01, 0x5a,
+	0x08, 0x2e, 0x2f, 0x3b, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
 }
 
 var (
@@ -427,26 +581,30 @@ func file_transaction_proto_rawDescGZIP() []byte {
 	return file_transaction_proto_rawDescData
 }
 
-var file_transaction_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_transaction_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_transaction_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_transaction_proto_goTypes = []interface{}{
-	(*Address)(nil),    // 0: address
-	(*Amount)(nil),     // 1: amount
-	(*Tx)(nil),         // 2: tx
-	(*Txs)(nil),        // 3: txs
-	(*TxReceipt)(nil),  // 4: txReceipt
-	(*TxReceipts)(nil), // 5: txReceipts
+	(ValidatorOp)(0),        // 0: ValidatorOp
+	(*Address)(nil),         // 1: address
+	(*Amount)(nil),          // 2: amount
+	(*Tx)(nil),              // 3: tx
+	(*Txs)(nil),             // 4: txs
+	(*TxReceipt)(nil),       // 5: txReceipt
+	(*TxReceipts)(nil),      // 6: txReceipts
+	(*ValidatorChange)(nil), // 7: validatorChange
 }
 var file_transaction_proto_depIdxs = []int32{
-	0, // 0: tx.sender:type_name -> address
-	0, // 1: tx.recipient:type_name -> address
-	1, // 2: tx.amount:type_name -> amount
-	2, // 3: txs.tansactions:type_name -> tx
-	4, // 4: txReceipts.tansaction_receipts:type_name -> txReceipt
-	5, // [5:5] is the sub-list for method output_type
-	5, // [5:5] is the sub-list for method input_type
-	5, // [5:5] is the sub-list for extension type_name
-	5, // [5:5] is the sub-list for extension extendee
-	0, // [0:5] is the sub-list for field type_name
+	1, // 0: tx.sender:type_name -> address
+	1, // 1: tx.recipient:type_name -> address
+	2, // 2: tx.amount:type_name -> amount
+	3, // 3: txs.tansactions:type_name -> tx
+	5, // 4: txReceipts.tansaction_receipts:type_name -> txReceipt
+	0, // 5: validatorChange.op:type_name -> ValidatorOp
+	6, // [6:6] is the sub-list for method output_type
+	6, // [6:6] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_transaction_proto_init() }
@@ -527,19 +685,32 @@ func file_transaction_proto_init() {
 				return nil
 			}
 		}
+		file_transaction_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ValidatorChange); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_transaction_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   6,
+			NumEnums:      1,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_transaction_proto_goTypes,
 		DependencyIndexes: file_transaction_proto_depIdxs,
+		EnumInfos:         file_transaction_proto_enumTypes,
 		MessageInfos:      file_transaction_proto_msgTypes,
 	}.Build()
 	File_transaction_proto = out.File
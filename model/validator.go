@@ -0,0 +1,102 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ValidatorSetAddress 验证者变更交易的接收地址 发往此地址的交易不转账 input中是ValidatorChange
+const ValidatorSetAddress = "0x0000000000000000000000000000000000000000000000000000000000000001"
+
+// IsValidatorChange 是否是验证者变更交易
+func (tx *Tx) IsValidatorChange() bool {
+	return tx.Recipient != nil && tx.Recipient.Address == ValidatorSetAddress
+}
+
+// DecodeValidatorChange 解析交易中的验证者变更
+func (tx *Tx) DecodeValidatorChange() (*ValidatorChange, error) {
+	var c ValidatorChange
+	if err := proto.Unmarshal(tx.Input, &c); err != nil {
+		return nil, err
+	}
+	switch c.Op {
+	case ValidatorOp_ValidatorAdd, ValidatorOp_ValidatorRemove:
+		if len(c.PublickKey) == 0 {
+			return nil, fmt.Errorf("验证者公钥为空")
+		}
+	case ValidatorOp_ValidatorReplace:
+		if len(c.PublickKey) == 0 || len(c.NewPublickKey) == 0 {
+			return nil, fmt.Errorf("验证者公钥为空")
+		}
+	default:
+		return nil, fmt.Errorf("未知的验证者变更类型: %d", c.Op)
+	}
+	if c.EffectiveHeight == 0 {
+		return nil, fmt.Errorf("验证者变更的生效高度为空")
+	}
+	return &c, nil
+}
+
+// NewValidatorChangeTx 生成一个未签名的验证者变更交易 由管理员账户签名后发送
+func NewValidatorChangeTx(admin *Address, c *ValidatorChange, sequeue string, timestamp uint64) (*Tx, error) {
+	input, err := proto.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("验证者变更编码失败 err: %v", err)
+	}
+	return &Tx{
+		Sender:    admin,
+		Recipient: &Address{Address: ValidatorSetAddress},
+		Amount:    &Amount{Amount: "0"},
+		Sequeue:   sequeue,
+		Input:     input,
+		TimeStamp: timestamp,
+	}, nil
+}
+
+// ApplyValidatorChange 返回变更后的验证者列表 不修改原列表 编号按新列表重新排列
+func ApplyValidatorChange(verifiers []*Verifier, c *ValidatorChange) ([]*Verifier, error) {
+	idx := -1
+	for i, v := range verifiers {
+		if bytes.Equal(v.PublickKey, c.PublickKey) {
+			idx = i
+			break
+		}
+	}
+	result := make([]*Verifier, 0, len(verifiers)+1)
+	switch c.Op {
+	case ValidatorOp_ValidatorAdd:
+		if idx >= 0 {
+			return nil, fmt.Errorf("验证者已经存在")
+		}
+		result = append(result, verifiers...)
+		result = append(result, &Verifier{PublickKey: c.PublickKey, Weight: c.Weight})
+	case ValidatorOp_ValidatorRemove:
+		if idx < 0 {
+			return nil, fmt.Errorf("验证者不存在")
+		}
+		if len(verifiers) == 1 {
+			return nil, fmt.Errorf("不能移除最后一个验证者")
+		}
+		result = append(result, verifiers[:idx]...)
+		result = append(result, verifiers[idx+1:]...)
+	case ValidatorOp_ValidatorReplace:
+		if idx < 0 {
+			return nil, fmt.Errorf("验证者不存在")
+		}
+		for _, v := range verifiers {
+			if bytes.Equal(v.PublickKey, c.NewPublickKey) {
+				return nil, fmt.Errorf("新的验证者公钥已经存在")
+			}
+		}
+		result = append(result, verifiers...)
+		result[idx] = &Verifier{PublickKey: c.NewPublickKey, Weight: verifiers[idx].Weight}
+	default:
+		return nil, fmt.Errorf("未知的验证者变更类型: %d", c.Op)
+	}
+	for i := range result {
+		result[i] = &Verifier{PublickKey: result[i].PublickKey, SeqNum: int32(i), Weight: result[i].Weight}
+	}
+	return result, nil
+}
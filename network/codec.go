@@ -0,0 +1,74 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	网络消息的编码
+	WireProto  protobuf编码的model.Envelope 载荷不需要base64 接收方只解码一次
+	WireJSON   旧版本的JSON编码的BroadcastMsg 只用于和旧版本的节点通信
+	两种传输都先尝试WireProto 对方不支持时回退到WireJSON
+*/
+
+type WireFormat int
+
+const (
+	WireProto WireFormat = iota
+	WireJSON
+)
+
+func (w WireFormat) String() string {
+	if w == WireJSON {
+		return "json"
+	}
+	return "proto"
+}
+
+// WireVersion 当前的信封版本
+const WireVersion = 1
+
+// EncodeMsg 按指定格式编码消息 sender为本节点ID
+func EncodeMsg(format WireFormat, msg *BroadcastMsg, sender string) ([]byte, error) {
+	if format == WireJSON {
+		return json.Marshal(msg)
+	}
+	return proto.Marshal(&model.Envelope{
+		Version:   WireVersion,
+		ModelId:   msg.ModelID,
+		MsgType:   msg.MsgType,
+		Payload:   msg.Msg,
+		Sender:    sender,
+		RequestId: msg.RequestID,
+		Ttl:       msg.TTL,
+	})
+}
+
+// DecodeMsg 按指定格式解码消息 返回消息和信封中的发送方 JSON格式没有发送方
+func DecodeMsg(format WireFormat, data []byte) (*BroadcastMsg, string, error) {
+	if format == WireJSON {
+		var msg BroadcastMsg
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, "", err
+		}
+		return &msg, "", nil
+	}
+	var env model.Envelope
+	if err := proto.Unmarshal(data, &env); err != nil {
+		return nil, "", err
+	}
+	if env.Version == 0 || env.Version > WireVersion {
+		return nil, "", fmt.Errorf("不支持的信封版本: %d", env.Version)
+	}
+	return &BroadcastMsg{
+		ModelID:   env.ModelId,
+		MsgType:   env.MsgType,
+		Msg:       env.Payload,
+		RequestID: env.RequestId,
+		TTL:       env.Ttl,
+	}, env.Sender, nil
+}
@@ -0,0 +1,56 @@
+package network
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	msg := &BroadcastMsg{
+		ModelID:   "blockchain",
+		MsgType:   model.BroadcastMsgType_send_specific_block,
+		Msg:       bytes.Repeat([]byte{0xff}, 300),
+		RequestID: 42,
+	}
+	for _, format := range []WireFormat{WireProto, WireJSON} {
+		data, err := EncodeMsg(format, msg, "node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, sender, err := DecodeMsg(format, data)
+		if err != nil {
+			t.Fatalf("%s 解码失败: %v", format, err)
+		}
+		if got.ModelID != msg.ModelID || got.MsgType != msg.MsgType ||
+			!bytes.Equal(got.Msg, msg.Msg) || got.RequestID != msg.RequestID {
+			t.Fatalf("%s 解码后的消息不一致: %+v", format, got)
+		}
+		if format == WireProto && sender != "node1" {
+			t.Fatalf("信封中的发送方不正确: %s", sender)
+		}
+	}
+
+	// protobuf信封不需要base64 应该比JSON小
+	protoData, _ := EncodeMsg(WireProto, msg, "")
+	jsonData, _ := EncodeMsg(WireJSON, msg, "")
+	if len(protoData) >= len(jsonData) {
+		t.Fatalf("protobuf编码%d字节 JSON编码%d字节", len(protoData), len(jsonData))
+	}
+}
+
+func TestCodecRejectVersion(t *testing.T) {
+	for _, v := range []uint32{0, WireVersion + 1} {
+		data, _ := proto.Marshal(&model.Envelope{Version: v, ModelId: "consensus"})
+		if _, _, err := DecodeMsg(WireProto, data); err == nil {
+			t.Fatalf("版本%d的信封应该被拒绝", v)
+		}
+	}
+	// 旧版本的JSON消息不能当作信封解码
+	data, _ := EncodeMsg(WireJSON, &BroadcastMsg{ModelID: "consensus", Msg: []byte("x")}, "")
+	if _, _, err := DecodeMsg(WireProto, data); err == nil {
+		t.Fatalf("JSON消息不应该被当作信封解码")
+	}
+}
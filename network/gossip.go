@@ -0,0 +1,163 @@
+package network
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/metrics"
+)
+
+/*
+	gossip
+	需要全网传播的消息(例如交易)通过Gossip发送 接收方处理后再调用Gossip转发
+	消息ID由模块 类型和内容计算 同一条消息从不同peer收到时ID相同
+	1. 收到过的gossip消息不再交给模块处理 避免消息在环路中无限传递
+	2. 转发过的消息不再转发 转发时不发回给发送方
+	3. 每转发一次TTL减一 减到0时不再转发
+	TTL为0的消息是点对点的请求和响应 或者来自旧版本的节点 不做去重
+*/
+
+const (
+	// DefaultGossipTTL 新消息最多被转发的跳数
+	DefaultGossipTTL = 6
+	// 已见消息缓存的容量和有效期 超过容量时淘汰最早的
+	defaultSeenSize = 20000
+	defaultSeenTTL  = 2 * time.Minute
+)
+
+var gossipDropped = metrics.NewCounterVec("pbft_network_gossip_suppressed_total",
+	"被去重的gossip消息数量", "reason")
+
+// MsgID gossip消息的ID 和发送方 TTL无关
+func MsgID(msg *BroadcastMsg) string {
+	h := sha256.New()
+	h.Write([]byte(msg.ModelID))
+	var typ [4]byte
+	binary.BigEndian.PutUint32(typ[:], uint32(msg.MsgType))
+	h.Write(typ[:])
+	h.Write(msg.Msg)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// seenCache 有界的消息ID缓存 超过有效期的ID视为没有见过
+type seenCache struct {
+	sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	order *list.List // 按加入时间排序 最早的在前面
+	now   func() time.Time
+}
+
+type seenItem struct {
+	id   string
+	seen time.Time
+}
+
+func newSeenCache(size int, ttl time.Duration) *seenCache {
+	return &seenCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+		now:   time.Now,
+	}
+}
+
+// add 记录id 之前没有见过时返回true
+func (c *seenCache) add(id string) bool {
+	c.Lock()
+	defer c.Unlock()
+	now := c.now()
+	// 淘汰过期的ID
+	for e := c.order.Front(); e != nil && now.Sub(e.Value.(*seenItem).seen) > c.ttl; e = c.order.Front() {
+		c.remove(e)
+	}
+	if _, ok := c.items[id]; ok {
+		return false
+	}
+	for c.order.Len() >= c.size {
+		c.remove(c.order.Front())
+	}
+	c.items[id] = c.order.PushBack(&seenItem{id: id, seen: now})
+	return true
+}
+
+func (c *seenCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.items, e.Value.(*seenItem).id)
+}
+
+func (c *seenCache) len() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.order.Len()
+}
+
+// Gossiper 在switcher之上实现去重的转发 同时实现SwitcherI 可以直接替换switcher交给各个模块
+type Gossiper struct {
+	SwitcherI
+	seen    *seenCache // 收到或者发出过的消息
+	relayed *seenCache // 转发过的消息
+}
+
+// NewGossiper s已经是Gossiper时直接返回 保证所有模块共用同一个缓存
+func NewGossiper(s SwitcherI) *Gossiper {
+	if g, ok := s.(*Gossiper); ok {
+		return g
+	}
+	return &Gossiper{
+		SwitcherI: s,
+		seen:      newSeenCache(defaultSeenSize, defaultSeenTTL),
+		relayed:   newSeenCache(defaultSeenSize, defaultSeenTTL),
+	}
+}
+
+// Gossip 向全网传播消息 from为空时表示本节点产生的新消息 否则为转发从from收到的消息
+// 转发时msg.TTL应该是收到时的TTL
+func (g *Gossiper) Gossip(modelID string, msg *BroadcastMsg, from *Peer) error {
+	id := MsgID(msg)
+	out := *msg
+	if from == nil {
+		out.TTL = DefaultGossipTTL
+		g.seen.add(id)
+	} else {
+		// 旧版本节点的消息没有TTL 按新消息处理 已见缓存仍然可以防止环路
+		if out.TTL == 0 {
+			out.TTL = DefaultGossipTTL
+		}
+		out.TTL--
+		if out.TTL == 0 {
+			gossipDropped.With("ttl").Inc()
+			return nil
+		}
+	}
+	if !g.relayed.add(id) {
+		gossipDropped.With("relayed").Inc()
+		return nil
+	}
+	if from == nil {
+		return g.SwitcherI.Broadcast(modelID, &out)
+	}
+	return g.SwitcherI.BroadcastExceptPeer(modelID, &out, from)
+}
+
+// RegisterOnReceive 收到过的gossip消息不再交给模块
+func (g *Gossiper) RegisterOnReceive(modelID string, callBack OnReceive) error {
+	return g.SwitcherI.RegisterOnReceive(modelID, func(modelID string, msg *BroadcastMsg, p *Peer) {
+		if msg.TTL > 0 && !g.seen.add(MsgID(msg)) {
+			gossipDropped.With("seen").Inc()
+			return
+		}
+		callBack(modelID, msg, p)
+	})
+}
+
+// Report 转发给底层的switcher 实现Reporter
+func (g *Gossiper) Report(p *Peer, ev PeerEvent) {
+	ReportPeer(g.SwitcherI, p, ev)
+}
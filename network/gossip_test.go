@@ -0,0 +1,98 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+// recordSwitcher 记录发出的消息
+type recordSwitcher struct {
+	sent []*BroadcastMsg
+	cb   OnReceive
+}
+
+func (s *recordSwitcher) Broadcast(modelID string, msg *BroadcastMsg) error {
+	s.sent = append(s.sent, msg)
+	return nil
+}
+func (s *recordSwitcher) BroadcastToPeer(modelID string, msg *BroadcastMsg, p *Peer) error {
+	return s.Broadcast(modelID, msg)
+}
+func (s *recordSwitcher) BroadcastExceptPeer(modelID string, msg *BroadcastMsg, p *Peer) error {
+	return s.Broadcast(modelID, msg)
+}
+func (s *recordSwitcher) RemovePeer(p *Peer) error { return nil }
+func (s *recordSwitcher) RegisterOnReceive(modelID string, cb OnReceive) error {
+	s.cb = cb
+	return nil
+}
+func (s *recordSwitcher) Start() error            { return nil }
+func (s *recordSwitcher) Peers() ([]*Peer, error) { return nil, nil }
+
+func TestGossipDedup(t *testing.T) {
+	sw := &recordSwitcher{}
+	g := NewGossiper(sw)
+	if NewGossiper(g) != g {
+		t.Fatalf("重复包装应该返回同一个Gossiper")
+	}
+	received := 0
+	g.RegisterOnReceive("transaction", func(modelID string, msg *BroadcastMsg, p *Peer) {
+		received++
+		g.Gossip(modelID, msg, p)
+	})
+
+	peer := &Peer{ID: "p1"}
+	msg := &BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx, Msg: []byte("txs"), TTL: 3}
+	sw.cb("transaction", msg, peer)
+	sw.cb("transaction", &BroadcastMsg{ModelID: msg.ModelID, MsgType: msg.MsgType, Msg: msg.Msg, TTL: 2}, &Peer{ID: "p2"})
+	if received != 1 || len(sw.sent) != 1 || sw.sent[0].TTL != 2 {
+		t.Fatalf("重复的gossip消息只应该处理和转发一次 处理: %d 转发: %d", received, len(sw.sent))
+	}
+
+	// TTL耗尽时不再转发
+	last := &BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx, Msg: []byte("last"), TTL: 1}
+	sw.cb("transaction", last, peer)
+	if received != 2 || len(sw.sent) != 1 {
+		t.Fatalf("TTL为1的消息不应该被转发")
+	}
+
+	// 点对点的消息不去重
+	direct := &BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx, Msg: []byte("direct")}
+	sw.cb("transaction", direct, peer)
+	sw.cb("transaction", direct, peer)
+	if received != 4 {
+		t.Fatalf("TTL为0的消息不应该被去重 处理: %d", received)
+	}
+
+	// 本节点发出的消息被其他节点转发回来时不再处理
+	origin := &BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx, Msg: []byte("origin")}
+	g.Gossip("transaction", origin, nil)
+	if n := len(sw.sent); sw.sent[n-1].TTL != DefaultGossipTTL {
+		t.Fatalf("新消息的TTL应该是%d", DefaultGossipTTL)
+	}
+	sw.cb("transaction", &BroadcastMsg{ModelID: origin.ModelID, MsgType: origin.MsgType, Msg: origin.Msg, TTL: 5}, peer)
+	if received != 4 {
+		t.Fatalf("转发回来的消息不应该被处理")
+	}
+}
+
+func TestSeenCache(t *testing.T) {
+	c := newSeenCache(3, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	for i := 0; i < 5; i++ {
+		if !c.add(fmt.Sprint(i)) {
+			t.Fatalf("第一次加入的ID应该返回true")
+		}
+	}
+	if c.len() != 3 || c.add("4") || !c.add("0") {
+		t.Fatalf("超过容量时应该淘汰最早的ID")
+	}
+	now = now.Add(2 * time.Minute)
+	if !c.add("4") || c.len() != 1 {
+		t.Fatalf("过期的ID应该被淘汰 当前数量: %d", c.len())
+	}
+}
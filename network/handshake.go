@@ -0,0 +1,206 @@
+package network
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+/*
+	握手
+	每个新建立的连接(libp2p的stream 或者http的peer)在交换其他消息前 双方先交换签名的握手信息
+	链ID 创世区块哈希不同 或者协议版本低于MinProtocolVersion的节点被拒绝
+	握手成功后协商的信息记录在Peer中
+	http没有连接 握手时双方交换随机数 用ECDH和随机数协商会话密钥 之后的每个请求用会话密钥认证
+*/
+
+const (
+	// ProtocolVersion 本节点的协议版本 没有握手的旧版本节点视为版本1
+	ProtocolVersion = 2
+	// MinProtocolVersion 能够通信的最低协议版本
+	MinProtocolVersion = 2
+	// DefaultChainID 配置中没有指定链ID时使用
+	DefaultChainID = "counch"
+	// 握手时间和本地时间最多相差多少
+	handshakeMaxSkew = 5 * time.Minute
+)
+
+// NodeStatus 返回本节点当前的高度和角色 握手时调用
+type NodeStatus func() (uint64, model.NodeRole)
+
+// Handshaker 生成和校验握手信息
+type Handshaker struct {
+	ChainID     string
+	GenesisHash []byte
+	status      NodeStatus
+	priv        *ecdsa.PrivateKey
+	pub         []byte
+	// 最近见过的握手随机数 用于拒绝重放的握手
+	nonces    map[string]time.Time
+	nonceLock sync.Mutex
+}
+
+// NewHandshaker privKey为节点私钥 和网络层使用的私钥相同
+func NewHandshaker(chainID string, genesisHash []byte, privKey string, status NodeStatus) (*Handshaker, error) {
+	priv, err := cryptogo.LoadPrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	if chainID == "" {
+		chainID = DefaultChainID
+	}
+	pub := make([]byte, 64)
+	priv.PublicKey.X.FillBytes(pub[:32])
+	priv.PublicKey.Y.FillBytes(pub[32:])
+	return &Handshaker{
+		ChainID:     chainID,
+		GenesisHash: genesisHash,
+		status:      status,
+		priv:        priv,
+		pub:         pub,
+		nonces:      make(map[string]time.Time),
+	}, nil
+}
+
+// PublicKey 本节点的公钥
+func (h *Handshaker) PublicKey() []byte {
+	return h.pub
+}
+
+// Hello 生成本节点签名的握手信息 nonce和peerNonce只在http握手时使用 libp2p中为nil
+func (h *Handshaker) Hello(nonce, peerNonce []byte) (*model.Handshake, error) {
+	hs := &model.Handshake{
+		ChainId:         h.ChainID,
+		GenesisHash:     h.GenesisHash,
+		ProtocolVersion: ProtocolVersion,
+		PublicKey:       h.pub,
+		Timestamp:       time.Now().Unix(),
+		Nonce:           nonce,
+		PeerNonce:       peerNonce,
+	}
+	if h.status != nil {
+		hs.Height, hs.Role = h.status()
+	}
+	sign, err := cryptogo.Sign(h.priv, handshakeHash(hs))
+	if err != nil {
+		return nil, err
+	}
+	hs.Sign, err = cryptogo.Hex2Bytes(sign)
+	return hs, err
+}
+
+// Check 校验对方的握手信息 不兼容时返回原因
+func (h *Handshaker) Check(hs *model.Handshake) error {
+	if hs == nil {
+		return fmt.Errorf("握手信息为空")
+	}
+	pub, err := cryptogo.LoadPublicKeyFromBytes(hs.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !cryptogo.VerifySign(pub, fmt.Sprintf("0x%x", hs.Sign), fmt.Sprintf("0x%x", handshakeHash(hs))) {
+		return fmt.Errorf("握手签名错误")
+	}
+	if hs.ChainId != h.ChainID {
+		return fmt.Errorf("链ID不一致 本节点: %s 对方: %s", h.ChainID, hs.ChainId)
+	}
+	if !bytes.Equal(hs.GenesisHash, h.GenesisHash) {
+		return fmt.Errorf("创世区块不一致 本节点: %x 对方: %x", h.GenesisHash, hs.GenesisHash)
+	}
+	if hs.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("协议版本%d过低 最低版本: %d", hs.ProtocolVersion, MinProtocolVersion)
+	}
+	skew := time.Since(time.Unix(hs.Timestamp, 0))
+	if skew > handshakeMaxSkew || skew < -handshakeMaxSkew {
+		return fmt.Errorf("握手时间相差过大: %v", skew)
+	}
+	return nil
+}
+
+// Fresh 同一个握手随机数只能使用一次 在允许的时间偏差内重放的握手返回false
+func (h *Handshaker) Fresh(hs *model.Handshake) bool {
+	h.nonceLock.Lock()
+	defer h.nonceLock.Unlock()
+	now := time.Now()
+	for k, t := range h.nonces {
+		// 超过时间偏差的握手在Check中已经被拒绝
+		if now.Sub(t) > 2*handshakeMaxSkew {
+			delete(h.nonces, k)
+		}
+	}
+	key := string(hs.PublicKey) + string(hs.Nonce)
+	if _, ok := h.nonces[key]; ok {
+		return false
+	}
+	h.nonces[key] = now
+	return true
+}
+
+// SessionKey 本节点私钥和对方公钥的ECDH共享密钥 和双方的随机数一起计算会话密钥
+// 双方计算的结果相同 只知道握手信息而没有任何一方私钥的节点无法计算
+func (h *Handshaker) SessionKey(peerPub, initNonce, respNonce []byte) ([]byte, error) {
+	pub, err := cryptogo.LoadPublicKeyFromBytes(peerPub)
+	if err != nil {
+		return nil, err
+	}
+	ecdhPub, err := pub.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	ecdhPriv, err := h.priv.ECDH()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ecdhPriv.ECDH(ecdhPub)
+	if err != nil {
+		return nil, err
+	}
+	sh := sha256.New()
+	sh.Write(secret)
+	sh.Write(initNonce)
+	sh.Write(respNonce)
+	return sh.Sum(nil), nil
+}
+
+// EncodeHandshake 生成握手消息
+func (h *Handshaker) EncodeHandshake(nonce, peerNonce []byte) (*BroadcastMsg, error) {
+	hs, err := h.Hello(nonce, peerNonce)
+	if err != nil {
+		return nil, err
+	}
+	body, err := proto.Marshal(hs)
+	if err != nil {
+		return nil, err
+	}
+	return &BroadcastMsg{ModelID: "network", MsgType: model.BroadcastMsgType_send_handshake, Msg: body}, nil
+}
+
+// DecodeHandshake 解析并校验对方的握手消息
+func (h *Handshaker) DecodeHandshake(msg *BroadcastMsg) (*model.Handshake, error) {
+	if msg == nil || msg.MsgType != model.BroadcastMsgType_send_handshake {
+		return nil, fmt.Errorf("对方没有发送握手消息")
+	}
+	var hs model.Handshake
+	if err := proto.Unmarshal(msg.Msg, &hs); err != nil {
+		return nil, err
+	}
+	if err := h.Check(&hs); err != nil {
+		return nil, err
+	}
+	return &hs, nil
+}
+
+func handshakeHash(hs *model.Handshake) []byte {
+	c := proto.Clone(hs).(*model.Handshake)
+	c.Sign = nil
+	content, _ := proto.Marshal(c)
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
@@ -0,0 +1,81 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+)
+
+func newTestHandshaker(t *testing.T, chainID string, genesis []byte) *Handshaker {
+	priv, _, err := cryptogo.GenerateKeyPairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func() (uint64, model.NodeRole) { return 7, model.NodeRole_observer }
+	h, err := NewHandshaker(chainID, genesis, priv, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHandshake(t *testing.T) {
+	genesis := []byte("genesis")
+	a := newTestHandshaker(t, "", genesis)
+	b := newTestHandshaker(t, DefaultChainID, genesis)
+
+	msg, err := a.EncodeHandshake(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs, err := b.DecodeHandshake(msg)
+	if err != nil {
+		t.Fatalf("同一条链的节点握手失败: %v", err)
+	}
+	var p Peer
+	p.SetHandshake(hs)
+	if p.Height != 7 || p.Role != model.NodeRole_observer || p.Version != ProtocolVersion || p.ChainID != DefaultChainID {
+		t.Fatalf("握手信息不正确: %+v", p)
+	}
+
+	if _, err := newTestHandshaker(t, "other", genesis).DecodeHandshake(msg); err == nil {
+		t.Fatalf("不同链ID的节点应该被拒绝")
+	}
+	if _, err := newTestHandshaker(t, "", []byte("other")).DecodeHandshake(msg); err == nil {
+		t.Fatalf("不同创世区块的节点应该被拒绝")
+	}
+}
+
+func TestHandshakeReject(t *testing.T) {
+	a := newTestHandshaker(t, "", nil)
+	b := newTestHandshaker(t, "", nil)
+	// 修改任何字段都会使签名失效 版本过低时重新签名也会被拒绝
+	tamper := func(f func(hs *model.Handshake), resign bool) error {
+		hs, err := a.Hello(nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f(hs)
+		if resign {
+			sign, _ := cryptogo.Sign(a.priv, handshakeHash(hs))
+			hs.Sign, _ = cryptogo.Hex2Bytes(sign)
+		}
+		body, _ := proto.Marshal(hs)
+		_, err = b.DecodeHandshake(&BroadcastMsg{MsgType: model.BroadcastMsgType_send_handshake, Msg: body})
+		return err
+	}
+	if tamper(func(hs *model.Handshake) { hs.Height++ }, false) == nil {
+		t.Fatalf("签名错误的握手应该被拒绝")
+	}
+	if tamper(func(hs *model.Handshake) { hs.ProtocolVersion = MinProtocolVersion - 1 }, true) == nil {
+		t.Fatalf("版本过低的节点应该被拒绝")
+	}
+	if tamper(func(hs *model.Handshake) { hs.Timestamp -= 3600 }, true) == nil {
+		t.Fatalf("过期的握手应该被拒绝")
+	}
+	if tamper(func(hs *model.Handshake) {}, true) != nil {
+		t.Fatalf("正常的握手不应该被拒绝")
+	}
+}
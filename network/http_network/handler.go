@@ -86,19 +86,42 @@ func (hn *HTTPNetWork) commonHander(w http.ResponseWriter, r *http.Request) {
 		logger.Debugf("读取请求内容出错 %s", err.Error())
 		return
 	}
-	var revMsg network.BroadcastMsg
-	if err := json.Unmarshal(content, &revMsg); err != nil {
+	// 旧版本节点发送的是JSON
+	format := network.WireJSON
+	if r.Header.Get("Content-Type") == contentTypeProto {
+		format = network.WireProto
+	}
+	revMsg, sender, err := network.DecodeMsg(format, content)
+	if err != nil {
 		logger.Debugf("解码请求内容出错 %s", err.Error())
 		return
 	}
-	peer := network.Peer{
-		ID:      r.Header.Get("peer_id"),
-		Address: r.Header.Get("peer_address"),
+	if sender == "" {
+		sender = r.Header.Get("peer_id")
+	}
+	// 对方的地址只使用配置中的地址 不相信请求中的地址
+	peer := network.Peer{ID: sender, Address: hn.peerAddr(sender)}
+	if hn.handshaker != nil {
+		// 握手过的节点只根据会话确定身份 消息中的sender不作为身份
+		// 旧版本节点不能认证 只在允许时接收 并且不能冒用已经握手的节点
+		if p := hn.authenticate(r, content); p != nil {
+			peer = *p
+		} else if format == network.WireJSON && hn.allowLegacy && r.Header.Get(headerSession) == "" &&
+			hn.peerBooks.FindPeer(peer.ID) == nil {
+			peer.Version = 1
+		} else {
+			http.Error(w, "handshake required", http.StatusForbidden)
+			return
+		}
+	}
+	if hn.reputation.Banned(peer.ID) {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
 	}
 
 	select {
 	case hn.msgQueue <- &HTTPMsg{
-		&revMsg,
+		revMsg,
 		&peer,
 	}:
 	default:
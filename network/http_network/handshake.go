@@ -0,0 +1,205 @@
+package http_network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+// ready 第一次向addr发送消息前先握手 握手成功后使用协商的会话 不再重复
+func (hn *HTTPNetWork) ready(addr string) bool {
+	if hn.handshaker == nil {
+		return true
+	}
+	hn.RLock()
+	done := hn.sessions[addr] != nil
+	hn.RUnlock()
+	if done {
+		return true
+	}
+	lock := hn.handshakeLock(addr)
+	lock.Lock()
+	defer lock.Unlock()
+	// 等待期间其他请求可能已经完成握手
+	hn.RLock()
+	done = hn.sessions[addr] != nil
+	hn.RUnlock()
+	if done {
+		return true
+	}
+	s, err := hn.handshake(addr)
+	if err != nil {
+		logger.Infof("与节点%s握手失败: %v", addr, err)
+		return false
+	}
+	peer := s.peer
+	hn.Lock()
+	hn.sessions[addr] = s
+	if peer.Version < network.MinProtocolVersion {
+		hn.legacy[addr] = true
+	}
+	hn.Unlock()
+	if peer.ID != "" {
+		hn.peerBooks.AddPeer(peer)
+	}
+	return true
+}
+
+// handshakeLock 向addr握手时使用的锁
+func (hn *HTTPNetWork) handshakeLock(addr string) *sync.Mutex {
+	hn.Lock()
+	defer hn.Unlock()
+	lock := hn.handshaking[addr]
+	if lock == nil {
+		lock = &sync.Mutex{}
+		hn.handshaking[addr] = lock
+	}
+	return lock
+}
+
+// handshake 向addr发送本节点的握手信息和随机数 对方在响应中返回它的握手信息 双方协商会话密钥
+func (hn *HTTPNetWork) handshake(addr string) (*session, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	hello, err := hn.handshaker.EncodeHandshake(nonce, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := network.EncodeMsg(network.WireProto, hello, hn.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	status, content, err := hn.request(addr+"/handshake", contentTypeProto, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	expect := hn.peerID(addr)
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+		// 旧版本节点没有握手接口
+		if !hn.allowLegacy {
+			return nil, fmt.Errorf("对方是不支持握手的旧版本节点")
+		}
+		return &session{peer: &network.Peer{ID: expect, Address: addr, Version: 1}}, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("对方拒绝握手: %s", strings.TrimSpace(string(content)))
+	}
+	msg, _, err := network.DecodeMsg(network.WireProto, content)
+	if err != nil {
+		return nil, err
+	}
+	hs, err := hn.handshaker.DecodeHandshake(msg)
+	if err != nil {
+		return nil, err
+	}
+	// 重放的旧响应中不是本次的随机数
+	if !bytes.Equal(hs.PeerNonce, nonce) || len(hs.Nonce) != nonceSize {
+		return nil, fmt.Errorf("握手响应不是对本次握手的回复")
+	}
+	id := cryptogo.Bytes2Hex(hs.PublicKey)
+	if expect == "" {
+		expect = id
+	} else if !strings.EqualFold(expect, id) {
+		return nil, fmt.Errorf("握手公钥和配置的节点ID不一致 配置: %s 公钥: %s", expect, id)
+	}
+	key, err := hn.handshaker.SessionKey(hs.PublicKey, nonce, hs.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	peer := &network.Peer{ID: expect, Address: addr}
+	peer.SetHandshake(hs)
+	return &session{id: hex.EncodeToString(hs.Nonce), key: key, peer: peer}, nil
+}
+
+// peerID 配置中地址对应的节点ID
+func (hn *HTTPNetWork) peerID(addr string) string {
+	for i := range hn.Addrs {
+		if hn.Addrs[i] == addr && i < len(hn.PeerIDs) {
+			return hn.PeerIDs[i]
+		}
+	}
+	return ""
+}
+
+// peerAddr 配置中节点ID对应的地址 不在配置中的节点没有地址
+func (hn *HTTPNetWork) peerAddr(id string) string {
+	for i := range hn.PeerIDs {
+		if strings.EqualFold(hn.PeerIDs[i], id) && i < len(hn.Addrs) {
+			return hn.Addrs[i]
+		}
+	}
+	return ""
+}
+
+// handshakeHandler 校验对方的握手信息 成功后记录会话 在响应中返回本节点的握手信息
+func (hn *HTTPNetWork) handshakeHandler(w http.ResponseWriter, r *http.Request) {
+	if hn.handshaker == nil {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	msg, _, err := network.DecodeMsg(network.WireProto, content)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hs, err := hn.handshaker.DecodeHandshake(msg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if len(hs.Nonce) != nonceSize || !hn.handshaker.Fresh(hs) {
+		http.Error(w, "重放的握手", http.StatusForbidden)
+		return
+	}
+	// peer_id是对方的公钥 之后的消息通过会话识别对方
+	peerID := r.Header.Get("peer_id")
+	if hn.reputation.Banned(peerID) {
+		http.Error(w, "banned", http.StatusForbidden)
+		return
+	}
+	if !strings.EqualFold(peerID, cryptogo.Bytes2Hex(hs.PublicKey)) {
+		http.Error(w, "握手公钥和peer_id不一致", http.StatusForbidden)
+		return
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key, err := hn.handshaker.SessionKey(hs.PublicKey, hs.Nonce, nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	hello, err := hn.handshaker.EncodeHandshake(nonce, hs.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// 对方的地址只使用配置中的地址 不相信请求中的地址
+	peer := &network.Peer{ID: peerID, Address: hn.peerAddr(peerID)}
+	peer.SetHandshake(hs)
+	hn.peerBooks.AddPeer(peer)
+	hn.addInbound(&session{id: hex.EncodeToString(nonce), key: key, peer: peer})
+
+	body, err := network.EncodeMsg(network.WireProto, hello, hn.NodeID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeProto)
+	w.Write(body)
+}
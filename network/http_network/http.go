@@ -1,14 +1,14 @@
 package http_network
 
 import (
-	"encoding/json"
+	"bytes"
+	"io/ioutil"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/parnurzeal/gorequest"
 	log "github.com/sirupsen/logrus"
 	"github.com/wupeaking/pbft_impl/common/config"
 	"github.com/wupeaking/pbft_impl/model"
@@ -36,15 +36,35 @@ type HTTPNetWork struct {
 	msgQueue     chan *HTTPMsg
 	peerBooks    *network.PeerBooks
 	recvCB       map[string]network.OnReceive
+	// 只支持JSON格式的旧版本节点地址
+	legacy map[string]bool
+	client *http.Client
+	// 为nil时不握手
+	handshaker  *network.Handshaker
+	allowLegacy bool
+	// 本节点发起的会话 按对方地址记录 有会话表示已经完成握手
+	sessions map[string]*session
+	// 同一个地址同时只进行一次握手 并发的请求等待握手完成后使用同一个会话
+	handshaking map[string]*sync.Mutex
+	// 对方发起的会话 按会话ID记录 以及每个peer最新的会话ID
+	inbound     map[string]*session
+	peerSession map[string]string
+	reputation  *network.Reputation
 	sync.RWMutex
 }
 
+const (
+	contentTypeProto = "application/x-protobuf"
+	contentTypeJSON  = "application/json"
+)
+
 type HTTPMsg struct {
 	*network.BroadcastMsg
 	*network.Peer
 }
 
-func New(nodeAddrs []config.NodeAddr, local string, nodeID string, cfg *config.Configure) network.SwitcherI {
+// New hs为nil时不握手
+func New(nodeAddrs []config.NodeAddr, local string, nodeID string, cfg *config.Configure, hs *network.Handshaker) network.SwitcherI {
 	switch strings.ToLower(cfg.NetworkCfg.LogLevel) {
 	case "debug":
 		logger.Logger.SetLevel(log.DebugLevel)
@@ -57,13 +77,17 @@ func New(nodeAddrs []config.NodeAddr, local string, nodeID string, cfg *config.C
 	default:
 		logger.Logger.SetLevel(log.InfoLevel)
 	}
+	reputation, err := network.NewReputation(&cfg.NetworkCfg)
+	if err != nil {
+		logger.Fatalf("加载禁止列表失败 err: %v", err)
+	}
 	addrs := make([]string, 0)
 	peers := make([]string, 0)
 	for i := range nodeAddrs {
 		addrs = append(addrs, nodeAddrs[i].Address)
 		peers = append(peers, nodeAddrs[i].PeerID)
 	}
-	return &HTTPNetWork{
+	hn := &HTTPNetWork{
 		Addrs:        addrs,
 		PeerIDs:      peers,
 		LocalAddress: local,
@@ -71,7 +95,19 @@ func New(nodeAddrs []config.NodeAddr, local string, nodeID string, cfg *config.C
 		msgQueue:     make(chan *HTTPMsg, 1000),
 		peerBooks:    network.NewPeerBooks(),
 		recvCB:       make(map[string]network.OnReceive),
+		legacy:       make(map[string]bool),
+		client:       &http.Client{Timeout: 15 * time.Second},
+		handshaker:   hs,
+		allowLegacy:  cfg.NetworkCfg.AllowLegacyPeers,
+		sessions:     make(map[string]*session),
+		handshaking:  make(map[string]*sync.Mutex),
+		inbound:      make(map[string]*session),
+		peerSession:  make(map[string]string),
+		reputation:   reputation,
 	}
+	// 信誉过低的peer立即断开
+	reputation.OnBan(func(p *network.Peer) { hn.RemovePeer(p) })
+	return hn
 }
 
 func (hn *HTTPNetWork) Start() error {
@@ -82,6 +118,7 @@ func (hn *HTTPNetWork) Start() error {
 	// r.HandleFunc("/block/{num}", hn.commonHander).Methods("GET")
 	// r.HandleFunc("/block", hn.commonHander).Methods("POST")
 	r.HandleFunc("/broadcast", hn.commonHander).Methods("POST")
+	r.HandleFunc("/handshake", hn.handshakeHandler).Methods("POST")
 
 	srv := &http.Server{
 		Handler:      r,
@@ -99,28 +136,11 @@ func (hn *HTTPNetWork) Start() error {
 }
 
 func (hn *HTTPNetWork) Broadcast(modelID string, msg *network.BroadcastMsg) error {
-	requestBody, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	// logger.Debugf("modeID: %s requestbody: %s", modelID, string(requestBody))
 	switch msg.MsgType {
 	case model.BroadcastMsgType_send_pbft_msg, model.BroadcastMsgType_send_block_meta,
 		model.BroadcastMsgType_send_tx, model.BroadcastMsgType_request_load_block:
 		for _, addr := range hn.Addrs {
-			go func(addr string) {
-				request := gorequest.New()
-				logger.Debugf("向%s发起请求", addr)
-				request.Post(addr + "/broadcast")
-				// 必须在Method之后 添加头 这个包坑太多
-				// Method之后 会清除SuperAgent
-				request.Set("peer_id", hn.NodeID)
-				request.Set("peer_address", "http://"+hn.LocalAddress)
-				_, _, err := request.Send(string(requestBody)).End()
-				if err != nil {
-					logger.Debugf("P2P 广播出错, err: %v", err)
-				}
-			}(addr)
+			go hn.send(addr, msg)
 		}
 	default:
 
@@ -129,28 +149,11 @@ func (hn *HTTPNetWork) Broadcast(modelID string, msg *network.BroadcastMsg) erro
 }
 
 func (hn *HTTPNetWork) BroadcastToPeer(modelID string, msg *network.BroadcastMsg, p *network.Peer) error {
-	requestBody, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
 	switch msg.MsgType {
 	case model.BroadcastMsgType_send_pbft_msg, model.BroadcastMsgType_send_block_meta,
 		model.BroadcastMsgType_send_tx, model.BroadcastMsgType_request_load_block,
 		model.BroadcastMsgType_send_specific_block:
-		go func() {
-			request := gorequest.New()
-			logger.Debugf("向%s发起请求", p.Address)
-			request.Post(p.Address + "/broadcast")
-			// 必须在Method之后 添加头 这个包坑太多
-			// Method之后 会清除SuperAgent
-			request.Set("peer_id", hn.NodeID)
-			request.Set("peer_address", "http://"+hn.LocalAddress)
-			_, _, err := request.Send(string(requestBody)).End()
-			if err != nil {
-				logger.Debugf("P2P 广播出错, err: %v", err)
-			}
-		}()
+		go hn.send(p.Address, msg)
 	default:
 
 	}
@@ -158,11 +161,6 @@ func (hn *HTTPNetWork) BroadcastToPeer(modelID string, msg *network.BroadcastMsg
 }
 
 func (hn *HTTPNetWork) BroadcastExceptPeer(modelID string, msg *network.BroadcastMsg, p *network.Peer) error {
-	requestBody, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
 	switch msg.MsgType {
 	case model.BroadcastMsgType_send_pbft_msg, model.BroadcastMsgType_send_block_meta,
 		model.BroadcastMsgType_send_tx, model.BroadcastMsgType_request_load_block,
@@ -171,29 +169,117 @@ func (hn *HTTPNetWork) BroadcastExceptPeer(modelID string, msg *network.Broadcas
 			if addr == p.Address {
 				continue
 			}
-			go func(addr string) {
-				request := gorequest.New()
-				logger.Debugf("向%s发起请求", addr)
-				request.Post(addr + "/broadcast")
-				// 必须在Method之后 添加头 这个包坑太多
-				// Method之后 会清除SuperAgent
-				request.Set("peer_id", hn.NodeID)
-				request.Set("peer_address", "http://"+hn.LocalAddress)
-				_, _, err := request.Send(string(requestBody)).End()
-				if err != nil {
-					logger.Debugf("P2P 广播出错, err: %v", err)
-				}
-			}(addr)
+			go hn.send(addr, msg)
 		}
 	default:
 	}
 	return nil
 }
 
+// send 先使用protobuf信封发送 旧版本节点无法解码时不会回复ok 之后对这个地址改用JSON
+func (hn *HTTPNetWork) send(addr string, msg *network.BroadcastMsg) {
+	if id := hn.peerID(addr); id != "" && hn.reputation.Banned(id) {
+		return
+	}
+	if !hn.ready(addr) {
+		return
+	}
+	hn.RLock()
+	format := network.WireProto
+	if hn.legacy[addr] {
+		format = network.WireJSON
+	}
+	used := hn.sessions[addr]
+	hn.RUnlock()
+
+	logger.Debugf("向%s发起请求", addr)
+	status, ok, err := hn.post(addr, format, msg)
+	if err == nil && status == http.StatusForbidden && hn.handshaker != nil {
+		// 对方重启后没有本节点的会话 重新握手后再发送一次
+		// 其他请求已经重新握手时 直接使用新的会话
+		hn.Lock()
+		if hn.sessions[addr] == used {
+			delete(hn.sessions, addr)
+		}
+		hn.Unlock()
+		if !hn.ready(addr) {
+			return
+		}
+		status, ok, err = hn.post(addr, format, msg)
+	}
+	if err != nil {
+		logger.Debugf("P2P 广播出错, err: %v", err)
+		return
+	}
+	if ok || format == network.WireJSON || status != http.StatusOK {
+		return
+	}
+	logger.Infof("节点%s不支持protobuf信封 使用JSON格式通信", addr)
+	hn.Lock()
+	hn.legacy[addr] = true
+	hn.Unlock()
+	if _, _, err := hn.post(addr, network.WireJSON, msg); err != nil {
+		logger.Debugf("P2P 广播出错, err: %v", err)
+	}
+}
+
+// post 发送一条消息 返回状态码和对方是否成功接收
+func (hn *HTTPNetWork) post(addr string, format network.WireFormat, msg *network.BroadcastMsg) (int, bool, error) {
+	body, err := network.EncodeMsg(format, msg, hn.NodeID)
+	if err != nil {
+		return 0, false, err
+	}
+	contentType := contentTypeProto
+	if format == network.WireJSON {
+		contentType = contentTypeJSON
+	}
+	hn.RLock()
+	s := hn.sessions[addr]
+	hn.RUnlock()
+	status, respBody, err := hn.request(addr+"/broadcast", contentType, body, s)
+	return status, string(respBody) == "ok", err
+}
+
+// request s不为nil时用会话密钥认证请求
+func (hn *HTTPNetWork) request(url string, contentType string, body []byte, s *session) (int, []byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("peer_id", hn.NodeID)
+	s.sign(req, body)
+	resp, err := hn.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, respBody, err
+}
+
+// RemovePeer http没有连接 删除握手信息和双方的会话 之后需要重新握手
 func (hn *HTTPNetWork) RemovePeer(p *network.Peer) error {
+	hn.peerBooks.RemovePeer(p.ID)
+	hn.Lock()
+	defer hn.Unlock()
+	for i := range hn.Addrs {
+		if hn.Addrs[i] == p.Address || (i < len(hn.PeerIDs) && hn.PeerIDs[i] == p.ID) {
+			delete(hn.sessions, hn.Addrs[i])
+		}
+	}
+	if id, ok := hn.peerSession[p.ID]; ok {
+		delete(hn.inbound, id)
+		delete(hn.peerSession, p.ID)
+	}
 	return nil
 }
 
+// Report 记录peer的行为 实现network.Reporter
+func (hn *HTTPNetWork) Report(p *network.Peer, ev network.PeerEvent) {
+	hn.reputation.Report(p, ev)
+}
+
 func (hn *HTTPNetWork) RegisterOnReceive(modelID string, callBack network.OnReceive) error {
 	hn.Lock()
 	hn.recvCB[modelID] = callBack
@@ -204,11 +290,16 @@ func (hn *HTTPNetWork) RegisterOnReceive(modelID string, callBack network.OnRece
 func (hn *HTTPNetWork) Peers() ([]*network.Peer, error) {
 	peers := make([]*network.Peer, 0)
 	for i := range hn.Addrs {
-		peers = append(peers, &network.Peer{
+		peer := &network.Peer{
 			ID:      hn.PeerIDs[i],
 			Address: hn.Addrs[i],
-		})
-
+		}
+		// 握手过的节点带上协商的信息
+		if known := hn.peerBooks.FindPeer(hn.PeerIDs[i]); known != nil {
+			*peer = *known
+			peer.Address = hn.Addrs[i]
+		}
+		peers = append(peers, peer)
 	}
 	return peers, nil
 }
@@ -218,14 +309,9 @@ func (hn *HTTPNetWork) Recv() {
 	for {
 		select {
 		case msg := <-hn.msgQueue:
-			broadMsg, err := json.Marshal(msg.BroadcastMsg)
-			if err != nil {
-				logger.Debugf("解码接收到的关播内容出错 err: %s", err.Error())
-				continue
-			}
 			onReceive := hn.recvCB[msg.ModelID]
 			if onReceive != nil {
-				go onReceive(msg.ModelID, broadMsg, msg.Peer)
+				go onReceive(msg.ModelID, msg.BroadcastMsg, msg.Peer)
 			} else {
 				logger.Debugf("当前消息ID没有相对应的处理模块 msgID: %s", msg.ModelID)
 			}
@@ -0,0 +1,249 @@
+package http_network
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+// 模拟只支持JSON的旧版本节点 和旧版本的commonHander一样 不能解码时不回复ok
+func TestLegacyFallback(t *testing.T) {
+	var lock sync.Mutex
+	var received []*network.BroadcastMsg
+	contentTypes := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		var msg network.BroadcastMsg
+		if json.Unmarshal(content, &msg) != nil {
+			return
+		}
+		received = append(received, &msg)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	hn := New(nil, "127.0.0.1:0", "node1", &config.Configure{}, nil).(*HTTPNetWork)
+	msg := &network.BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx, Msg: []byte{1, 2, 3}}
+	hn.send(srv.URL, msg)
+	hn.send(srv.URL, msg)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("旧版本节点应该收到2条消息 收到: %d", len(received))
+	}
+	// 第一次先尝试protobuf 失败后回退到JSON 之后直接使用JSON
+	want := []string{contentTypeProto, contentTypeJSON, contentTypeJSON}
+	if len(contentTypes) != len(want) {
+		t.Fatalf("请求次数不正确: %v", contentTypes)
+	}
+	for i := range want {
+		if contentTypes[i] != want[i] {
+			t.Fatalf("第%d次请求的格式不正确: %v", i, contentTypes)
+		}
+	}
+}
+
+func TestProtoHandler(t *testing.T) {
+	hn := New(nil, "127.0.0.1:0", "node1", &config.Configure{}, nil).(*HTTPNetWork)
+	srv := httptest.NewServer(http.HandlerFunc(hn.commonHander))
+	defer srv.Close()
+
+	msg := &network.BroadcastMsg{ModelID: "consensus", MsgType: model.BroadcastMsgType_send_pbft_msg, Msg: []byte{1}, RequestID: 7}
+	hn.send(srv.URL, msg)
+	if hn.legacy[srv.URL] {
+		t.Fatalf("支持protobuf的节点不应该被标记为旧版本")
+	}
+	got := <-hn.msgQueue
+	if got.RequestID != 7 || got.Peer.ID != "node1" {
+		t.Fatalf("接收的消息不正确: %+v %+v", got.BroadcastMsg, got.Peer)
+	}
+}
+
+func newHandshakeNode(t *testing.T, chainID string) (*HTTPNetWork, *httptest.Server) {
+	// 公钥的十六进制编码不足64字节时不能作为节点ID
+	var priv, pub string
+	for len(pub) != 130 {
+		var err error
+		if priv, pub, err = cryptogo.GenerateKeyPairs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := func() (uint64, model.NodeRole) { return 3, model.NodeRole_validator }
+	hs, err := network.NewHandshaker(chainID, []byte("genesis"), priv, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hn := New(nil, "127.0.0.1:0", pub, &config.Configure{}, hs).(*HTTPNetWork)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/broadcast", hn.commonHander)
+	mux.HandleFunc("/handshake", hn.handshakeHandler)
+	return hn, httptest.NewServer(mux)
+}
+
+func TestHandshakeBeforeBroadcast(t *testing.T) {
+	a, srvA := newHandshakeNode(t, "")
+	defer srvA.Close()
+	b, srvB := newHandshakeNode(t, "")
+	defer srvB.Close()
+
+	// 没有握手的消息被拒绝
+	msg := &network.BroadcastMsg{ModelID: "consensus", MsgType: model.BroadcastMsgType_send_pbft_msg, Msg: []byte{1}}
+	if status, ok, _ := a.post(srvB.URL, network.WireProto, msg); ok || status != http.StatusForbidden {
+		t.Fatalf("没有握手的消息应该被拒绝 status: %d", status)
+	}
+
+	a.send(srvB.URL, msg)
+	got := <-b.msgQueue
+	if got.Peer.ID != a.NodeID || got.Peer.Height != 3 || got.Peer.Role != model.NodeRole_validator {
+		t.Fatalf("接收方记录的握手信息不正确: %+v", got.Peer)
+	}
+	peer := a.peerBooks.FindPeer(cryptogo.Bytes2Hex(b.handshaker.PublicKey()))
+	if peer == nil || peer.Version != network.ProtocolVersion {
+		t.Fatalf("发送方没有记录对方的握手信息")
+	}
+
+	// 不同链的节点握手失败 不发送消息
+	c, srvC := newHandshakeNode(t, "other")
+	defer srvC.Close()
+	c.send(srvB.URL, msg)
+	if c.sessions[srvB.URL] != nil || len(b.msgQueue) != 0 {
+		t.Fatalf("不同链的节点不应该握手成功")
+	}
+}
+
+func TestBannedPeer(t *testing.T) {
+	a, srvA := newHandshakeNode(t, "")
+	defer srvA.Close()
+	b, srvB := newHandshakeNode(t, "")
+	defer srvB.Close()
+
+	msg := &network.BroadcastMsg{ModelID: "consensus", MsgType: model.BroadcastMsgType_send_pbft_msg, Msg: []byte{1}}
+	a.send(srvB.URL, msg)
+	<-b.msgQueue
+
+	// 多次发送无效的区块后被禁止 握手信息被删除 之后的消息和握手都被拒绝
+	peer := &network.Peer{ID: a.NodeID}
+	for !b.reputation.Banned(a.NodeID) {
+		b.Report(peer, network.EventInvalidBlock)
+	}
+	if b.peerBooks.FindPeer(a.NodeID) != nil {
+		t.Fatalf("被禁止的节点的握手信息应该被删除")
+	}
+	if status, ok, _ := a.post(srvB.URL, network.WireProto, msg); ok || status != http.StatusForbidden {
+		t.Fatalf("被禁止的节点的消息应该被拒绝 status: %d", status)
+	}
+	a.send(srvB.URL, msg)
+	if len(b.msgQueue) != 0 {
+		t.Fatalf("被禁止的节点不应该重新握手成功")
+	}
+}
+
+// 握手之后只根据会话确定发送方 冒用其他节点的sender 重放请求和握手都被拒绝
+func TestSessionAuth(t *testing.T) {
+	a, srvA := newHandshakeNode(t, "")
+	defer srvA.Close()
+	b, srvB := newHandshakeNode(t, "")
+	defer srvB.Close()
+	c, srvC := newHandshakeNode(t, "")
+	defer srvC.Close()
+
+	msg := &network.BroadcastMsg{ModelID: "consensus", MsgType: model.BroadcastMsgType_send_pbft_msg, Msg: []byte{1}}
+	a.send(srvB.URL, msg)
+	<-b.msgQueue
+	c.send(srvB.URL, msg)
+	<-b.msgQueue
+
+	// c在消息中冒用a的sender 接收方仍然认为是c发送的
+	body, _ := network.EncodeMsg(network.WireProto, msg, a.NodeID)
+	c.RLock()
+	s := c.sessions[srvB.URL]
+	c.RUnlock()
+	req, _ := http.NewRequest("POST", srvB.URL+"/broadcast", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentTypeProto)
+	req.Header.Set("peer_id", a.NodeID)
+	s.sign(req, body)
+	signed := req.Header.Clone()
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("带有会话的请求应该被接收 err: %v", err)
+	}
+	if got := <-b.msgQueue; got.Peer.ID != c.NodeID {
+		t.Fatalf("发送方应该是会话对应的节点 实际: %s", got.Peer.ID)
+	}
+
+	// 重放同一个请求 序号已经使用过
+	req, _ = http.NewRequest("POST", srvB.URL+"/broadcast", bytes.NewReader(body))
+	req.Header = signed
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("重放的请求应该被拒绝")
+	}
+
+	// 重放a的握手信息 不能建立新的会话
+	nonce, _ := newNonce()
+	hello, _ := a.handshaker.EncodeHandshake(nonce, nil)
+	hsBody, _ := network.EncodeMsg(network.WireProto, hello, a.NodeID)
+	for i, want := range []int{http.StatusOK, http.StatusForbidden} {
+		req, _ := http.NewRequest("POST", srvB.URL+"/handshake", bytes.NewReader(hsBody))
+		req.Header.Set("peer_id", a.NodeID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != want {
+			t.Fatalf("第%d次握手的状态不正确 err: %v", i, err)
+		}
+	}
+}
+
+// 第一次向同一个节点并发发送消息 只握手一次 所有请求使用同一个会话
+func TestConcurrentHandshake(t *testing.T) {
+	a, srvA := newHandshakeNode(t, "")
+	defer srvA.Close()
+	b, srvB := newHandshakeNode(t, "")
+	defer srvB.Close()
+	var handshakes, forbidden int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/handshake" {
+			atomic.AddInt32(&handshakes, 1)
+		}
+		rec := httptest.NewRecorder()
+		srvB.Config.Handler.ServeHTTP(rec, r)
+		if rec.Code == http.StatusForbidden {
+			atomic.AddInt32(&forbidden, 1)
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+
+	const n = 16
+	msg := &network.BroadcastMsg{ModelID: "consensus", MsgType: model.BroadcastMsgType_send_pbft_msg, Msg: []byte{1}}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.send(srv.URL, msg)
+		}()
+	}
+	wg.Wait()
+	if handshakes != 1 || forbidden != 0 {
+		t.Fatalf("并发发送时应该只握手一次 握手: %d, 拒绝: %d", handshakes, forbidden)
+	}
+	if len(b.msgQueue) != n {
+		t.Fatalf("应该收到%d条消息 收到: %d", n, len(b.msgQueue))
+	}
+}
@@ -0,0 +1,124 @@
+package http_network
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+/*
+	会话: 握手之后的每个请求都用会话密钥认证
+	发起方在握手中带上随机数 接收方回复自己的随机数 双方用ECDH和两个随机数计算相同的会话密钥
+	之后发起方的请求带上会话ID(接收方的随机数) 序号和HMAC 接收方只根据会话确定对方的身份
+	消息中的sender和请求头都不再作为身份 对方的地址只使用配置中的地址
+	序号在一个窗口内去重 截获的请求不能被重放
+*/
+
+const (
+	headerSession = "session_id"
+	headerSeq     = "session_seq"
+	headerMAC     = "session_mac"
+	nonceSize     = 32
+	// 接收方记录最近多少个序号 并发发送的请求可能乱序到达
+	replayWindow = 1024
+)
+
+type session struct {
+	id   string // 会话ID 接收方随机数的十六进制
+	key  []byte // 为nil时不认证 对方是不支持握手的旧版本节点
+	peer *network.Peer
+	sync.Mutex
+	// 发送方已经使用的最大序号
+	seq uint64
+	// 接收方收到的最大序号和窗口内已经收到的序号
+	highest uint64
+	seen    [replayWindow / 64]uint64
+}
+
+func newNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	_, err := rand.Read(nonce)
+	return nonce, err
+}
+
+func (s *session) mac(seq uint64, body []byte) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seq)
+	h := hmac.New(sha256.New, s.key)
+	h.Write(buf[:])
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// sign 在请求头中带上会话ID 序号和HMAC
+func (s *session) sign(req *http.Request, body []byte) {
+	if s == nil || s.key == nil {
+		return
+	}
+	s.Lock()
+	s.seq++
+	seq := s.seq
+	s.Unlock()
+	req.Header.Set(headerSession, s.id)
+	req.Header.Set(headerSeq, strconv.FormatUint(seq, 10))
+	req.Header.Set(headerMAC, hex.EncodeToString(s.mac(seq, body)))
+}
+
+// verify 校验请求的HMAC 并且序号没有使用过
+func (s *session) verify(r *http.Request, body []byte) bool {
+	seq, err := strconv.ParseUint(r.Header.Get(headerSeq), 10, 64)
+	if err != nil || seq == 0 {
+		return false
+	}
+	mac, err := hex.DecodeString(r.Header.Get(headerMAC))
+	if err != nil || !hmac.Equal(mac, s.mac(seq, body)) {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	if seq > s.highest {
+		// 窗口向前移动 移出窗口的序号清除
+		for n := s.highest + 1; n <= seq && n <= s.highest+replayWindow; n++ {
+			s.seen[(n/64)%uint64(len(s.seen))] &^= 1 << (n % 64)
+		}
+		s.highest = seq
+	} else if s.highest-seq >= replayWindow {
+		return false
+	}
+	word, bit := (seq/64)%uint64(len(s.seen)), uint64(1)<<(seq%64)
+	if s.seen[word]&bit != 0 {
+		return false
+	}
+	s.seen[word] |= bit
+	return true
+}
+
+// authenticate 根据会话确定请求的发送方 会话不存在或者认证失败时返回nil
+func (hn *HTTPNetWork) authenticate(r *http.Request, body []byte) *network.Peer {
+	hn.RLock()
+	s := hn.inbound[r.Header.Get(headerSession)]
+	hn.RUnlock()
+	if s == nil || !s.verify(r, body) {
+		return nil
+	}
+	peer := *s.peer
+	return &peer
+}
+
+// addInbound 记录对方发起的会话 同一个peer只保留最新的会话
+func (hn *HTTPNetWork) addInbound(s *session) {
+	hn.Lock()
+	defer hn.Unlock()
+	if old, ok := hn.peerSession[s.peer.ID]; ok {
+		delete(hn.inbound, old)
+	}
+	hn.inbound[s.id] = s
+	hn.peerSession[s.peer.ID] = s.id
+}
@@ -2,13 +2,11 @@ package libp2p
 
 import (
 	"bufio"
-	"encoding/json"
-
-	pbftnet "github.com/wupeaking/pbft_impl/network"
 )
 
 func (p2p *P2PNetWork) dataStreamRecv(stream *P2PStream) {
-	rw := bufio.NewReader(stream.stream)
+	// 握手时已经从reader中读取过 不能重新创建 否则会丢失缓冲的数据
+	rw := stream.reader
 
 outLoop:
 	for {
@@ -20,16 +18,15 @@ outLoop:
 			p2p.Unlock()
 			return
 		default:
-			msg, err := p2p.unpackageData(rw)
+			msg, err := p2p.unpackageData(stream.format, rw)
 			if err != nil {
 				logger.Infof("P2p Error reading from buffer err: %s", err.Error())
 				break outLoop
 			}
-			broadMsg, _ := json.Marshal(msg)
 			onReceive := p2p.recvCB[msg.ModelID]
 			//logger.Debugf("接收到消息 msg: %v", broadMsg)
 			if onReceive != nil {
-				go onReceive(msg.ModelID, broadMsg, &pbftnet.Peer{ID: stream.peerID})
+				go onReceive(msg.ModelID, msg, stream.peer)
 			} else {
 				logger.Debugf("当前消息ID没有相对应的处理模块 msgID: %s", msg.ModelID)
 			}
@@ -62,7 +59,7 @@ outLoop:
 			return
 		case msg := <-stream.broadcastMsgChan:
 			// logger.Debugf("接收广播消息 %v", msg)
-			msgBuf, err := p2p.packageData(msg)
+			msgBuf, err := p2p.packageData(stream.format, msg)
 			if err != nil {
 				logger.Infof("P2p 广播消息编码失败, err: %v", err)
 				break outLoop
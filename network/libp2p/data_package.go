@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -12,7 +11,7 @@ import (
 	nt "github.com/wupeaking/pbft_impl/network"
 )
 
-func (p2p *P2PNetWork) packageData(msg *nt.BroadcastMsg) ([]byte, error) {
+func (p2p *P2PNetWork) packageData(format nt.WireFormat, msg *nt.BroadcastMsg) ([]byte, error) {
 	dataBuf := bytes.NewBuffer(nil)
 	// 加入magic 头
 	dataBuf.WriteByte(0x89)
@@ -21,7 +20,7 @@ func (p2p *P2PNetWork) packageData(msg *nt.BroadcastMsg) ([]byte, error) {
 	dataBuf.WriteByte(0x20)
 	dataBuf.WriteByte(0x20)
 
-	msgBuf, err := json.Marshal(msg)
+	msgBuf, err := nt.EncodeMsg(format, msg, p2p.Host.ID().String())
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +42,7 @@ func (p2p *P2PNetWork) packageData(msg *nt.BroadcastMsg) ([]byte, error) {
 	return dataBuf.Bytes(), nil
 }
 
-func (p2p *P2PNetWork) unpackageData(rw *bufio.Reader) (*nt.BroadcastMsg, error) {
+func (p2p *P2PNetWork) unpackageData(format nt.WireFormat, rw *bufio.Reader) (*nt.BroadcastMsg, error) {
 	// 尝试读取magic 头
 	magicHeader := make([]byte, 5)
 	_, err := io.ReadFull(rw, magicHeader)
@@ -87,7 +86,7 @@ func (p2p *P2PNetWork) unpackageData(rw *bufio.Reader) (*nt.BroadcastMsg, error)
 		return nil, fmt.Errorf("crc校验错误 crc: %d, read crc: %d", ck, readCk)
 	}
 
-	var msg nt.BroadcastMsg
-	err = json.Unmarshal(msgBuf, &msg)
-	return &msg, err
+	// 发送方以libp2p连接的对端为准 不使用信封中的sender
+	msg, _, err := nt.DecodeMsg(format, msgBuf)
+	return msg, err
 }
@@ -0,0 +1,58 @@
+package libp2p
+
+import (
+	"fmt"
+	"time"
+
+	pbftnet "github.com/wupeaking/pbft_impl/network"
+)
+
+// 握手的超时时间
+const handshakeTimeout = 10 * time.Second
+
+// handshake 双方先发送自己的握手信息 再读取对方的 校验通过后记录到peer中
+func (p2p *P2PNetWork) handshake(stream *P2PStream) error {
+	if stream.format == pbftnet.WireJSON {
+		// 旧版本的协议没有握手
+		if !p2p.allowLegacy {
+			return fmt.Errorf("对方是不支持握手的旧版本节点")
+		}
+		stream.peer.Version = 1
+		return nil
+	}
+	if p2p.handshaker == nil {
+		return nil
+	}
+
+	hello, err := p2p.handshaker.EncodeHandshake(nil, nil)
+	if err != nil {
+		return err
+	}
+	buf, err := p2p.packageData(stream.format, hello)
+	if err != nil {
+		return err
+	}
+	stream.stream.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer stream.stream.SetDeadline(time.Time{})
+	if _, err := stream.stream.Write(buf); err != nil {
+		return err
+	}
+	msg, err := p2p.unpackageData(stream.format, stream.reader)
+	if err != nil {
+		return err
+	}
+	hs, err := p2p.handshaker.DecodeHandshake(msg)
+	if err != nil {
+		return err
+	}
+	// 握手中的公钥必须和libp2p连接的对端一致
+	id, err := PublicString2PeerID(fmt.Sprintf("0x%x", hs.PublicKey))
+	if err != nil {
+		return err
+	}
+	if id != stream.peerID {
+		return fmt.Errorf("握手公钥和连接的peer不一致 peer: %s 公钥对应: %s", stream.peerID, id)
+	}
+	stream.peer.SetHandshake(hs)
+	return nil
+}
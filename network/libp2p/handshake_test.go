@@ -0,0 +1,86 @@
+package libp2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/wupeaking/pbft_impl/common/config"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+	pbftnet "github.com/wupeaking/pbft_impl/network"
+)
+
+func newTestNode(t *testing.T, chainID string) *P2PNetWork {
+	priv, _, err := cryptogo.GenerateKeyPairs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Configure{}
+	cfg.NetworkCfg.LocalAddr = "127.0.0.1:0"
+	cfg.NetworkCfg.PriVateKey = priv
+	cfg.NetworkCfg.LogLevel = "error"
+	status := func() (uint64, model.NodeRole) { return 5, model.NodeRole_validator }
+	hs, err := pbftnet.NewHandshaker(chainID, []byte("genesis"), priv, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw, err := New(cfg, hs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2p := sw.(*P2PNetWork)
+	p2p.Host.SetStreamHandler(protocol.ID(p2p.protocol), p2p.streamHandler)
+	return p2p
+}
+
+func connect(t *testing.T, from, to *P2PNetWork) error {
+	info := peer.AddrInfo{ID: to.Host.ID(), Addrs: to.Host.Addrs()}
+	if err := from.Host.Connect(context.Background(), info); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := from.Host.NewStream(context.Background(), to.Host.ID(), protocol.ID(from.protocol))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return from.addStream(stream)
+}
+
+func TestStreamHandshake(t *testing.T) {
+	a := newTestNode(t, "")
+	defer a.Host.Close()
+	b := newTestNode(t, "")
+	defer b.Host.Close()
+
+	if err := connect(t, a, b); err != nil {
+		t.Fatalf("同一条链的节点握手失败: %v", err)
+	}
+	peers, _ := a.Peers()
+	if len(peers) != 1 || peers[0].ID != b.Host.ID().String() || peers[0].Height != 5 ||
+		peers[0].Role != model.NodeRole_validator || peers[0].Version != pbftnet.ProtocolVersion {
+		t.Fatalf("发起方记录的握手信息不正确: %+v", peers)
+	}
+	// 接收方在另一个goroutine中完成握手
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if peers, _ := b.Peers(); len(peers) == 1 {
+			return
+		}
+	}
+	t.Fatalf("接收方没有记录发起方")
+}
+
+func TestStreamHandshakeReject(t *testing.T) {
+	a := newTestNode(t, "")
+	defer a.Host.Close()
+	b := newTestNode(t, "other")
+	defer b.Host.Close()
+
+	if err := connect(t, a, b); err == nil {
+		t.Fatalf("不同链的节点应该握手失败")
+	}
+	if peers, _ := a.Peers(); len(peers) != 0 {
+		t.Fatalf("握手失败的节点不应该被记录")
+	}
+}
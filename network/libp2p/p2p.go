@@ -1,6 +1,7 @@
 package libp2p
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"strings"
@@ -41,8 +42,10 @@ func init() {
 }
 
 type P2PNetWork struct {
-	Host           host.Host
-	protocol       string
+	Host     host.Host
+	protocol string
+	// 旧版本节点使用的协议 消息是JSON编码的BroadcastMsg
+	legacyProtocol string
 	rendezvous     string
 	boostrapPeers  []ma.Multiaddr
 	bootstarp      bool
@@ -52,17 +55,27 @@ type P2PNetWork struct {
 	books        map[string]*P2PStream
 	recvCB       map[string]pbftnet.OnReceive
 	specifyNodes []string
+	// 为nil时不握手
+	handshaker *pbftnet.Handshaker
+	// 是否接受不支持握手的旧版本节点
+	allowLegacy bool
+	reputation  *pbftnet.Reputation
 }
 
 type P2PStream struct {
 	peerID           string
+	peer             *pbftnet.Peer
 	stream           network.Stream
+	reader           *bufio.Reader
 	broadcastMsgChan chan *pbftnet.BroadcastMsg
 	closeReadStrem   chan struct{}
 	closeWriteStrem  chan struct{}
+	// 根据协商的协议确定的消息编码
+	format pbftnet.WireFormat
 }
 
-func New(cfg *config.Configure) (pbftnet.SwitcherI, error) {
+// New hs为nil时不握手 用于不处理消息的引导节点
+func New(cfg *config.Configure, hs *pbftnet.Handshaker) (pbftnet.SwitcherI, error) {
 	switch strings.ToLower(cfg.NetworkCfg.LogLevel) {
 	case "debug":
 		logger.Logger.SetLevel(log.DebugLevel)
@@ -102,11 +115,20 @@ func New(cfg *config.Configure) (pbftnet.SwitcherI, error) {
 	}
 
 	p2p := &P2PNetWork{
-		Host:       host,
-		protocol:   "/counch/1.0.0",
-		rendezvous: "counch-p2p-discover",
+		Host:           host,
+		protocol:       "/counch/2.0.0",
+		legacyProtocol: "/counch/1.0.0",
+		rendezvous:     "counch-p2p-discover",
 	}
 	p2p.bootstarp = cfg.NetworkCfg.Bootstrap
+	p2p.handshaker = hs
+	p2p.allowLegacy = cfg.NetworkCfg.AllowLegacyPeers
+	p2p.reputation, err = pbftnet.NewReputation(&cfg.NetworkCfg)
+	if err != nil {
+		return nil, err
+	}
+	// 信誉过低的peer立即断开
+	p2p.reputation.OnBan(func(p *pbftnet.Peer) { p2p.RemovePeer(p) })
 	bootstraps := cfg.NetworkCfg.BootstrapPeers
 	if len(bootstraps) == 0 {
 		bootstraps = defaultBootstraps
@@ -145,6 +167,7 @@ func New(cfg *config.Configure) (pbftnet.SwitcherI, error) {
 func (p2p *P2PNetWork) Start() error {
 	logger.Infof("启动P2P模块, ID: %s, addr: %s", p2p.Host.ID(), p2p.Host.Addrs())
 	p2p.Host.SetStreamHandler(protocol.ID(p2p.protocol), p2p.streamHandler)
+	p2p.Host.SetStreamHandler(protocol.ID(p2p.legacyProtocol), p2p.streamHandler)
 
 	ctx := context.Background()
 	// 启动分布式hash表
@@ -193,23 +216,12 @@ func (p2p *P2PNetWork) NodeDiscovery() {
 			continue
 		}
 		logger.Debugf("发现新的节点, peer: %v", peer)
-		stream, err := p2p.Host.NewStream(context.Background(), peer.ID, protocol.ID(p2p.protocol))
+		stream, err := p2p.Host.NewStream(context.Background(), peer.ID, protocol.ID(p2p.protocol), protocol.ID(p2p.legacyProtocol))
 		if err != nil {
 			logger.Infof("p2p Connection failed: %v\n", err)
 			continue
-		} else {
-			p2pStaeam := &P2PStream{
-				peerID:           peer.ID.String(),
-				stream:           stream,
-				broadcastMsgChan: make(chan *pbftnet.BroadcastMsg, 0),
-				closeReadStrem:   make(chan struct{}, 1),
-				closeWriteStrem:  make(chan struct{}, 1),
-			}
-			p2p.Lock()
-			p2p.books[peer.ID.String()] = p2pStaeam
-			p2p.Unlock()
-			go p2p.dataStreamRecv(p2pStaeam)
-			go p2p.dataStreamSend(p2pStaeam)
+		} else if err := p2p.addStream(stream); err != nil {
+			logger.Infof("与节点%s握手失败: %v", peer.ID, err)
 		}
 	}
 }
@@ -236,24 +248,14 @@ func (p2p *P2PNetWork) SpecialNodeConnect() {
 				continue
 			}
 
-			stream, err := p2p.Host.NewStream(context.Background(), peer.ID, protocol.ID(p2p.protocol))
+			stream, err := p2p.Host.NewStream(context.Background(), peer.ID, protocol.ID(p2p.protocol), protocol.ID(p2p.legacyProtocol))
 			if err != nil {
 				logger.Infof("p2p Connection failed: %v\n", err)
 				continue
+			} else if err := p2p.addStream(stream); err != nil {
+				logger.Infof("与节点%s握手失败: %v", peer.ID, err)
 			} else {
-				p2pStaeam := &P2PStream{
-					peerID:           peer.ID.String(),
-					stream:           stream,
-					broadcastMsgChan: make(chan *pbftnet.BroadcastMsg, 0),
-					closeReadStrem:   make(chan struct{}, 1),
-					closeWriteStrem:  make(chan struct{}, 1),
-				}
-				p2p.Lock()
-				p2p.books[peer.ID.String()] = p2pStaeam
-				p2p.Unlock()
 				logger.Debugf("成功连接到节点: %v\n", peer)
-				go p2p.dataStreamRecv(p2pStaeam)
-				go p2p.dataStreamSend(p2pStaeam)
 			}
 
 		}
@@ -262,19 +264,47 @@ func (p2p *P2PNetWork) SpecialNodeConnect() {
 }
 
 func (p2p *P2PNetWork) streamHandler(stream network.Stream) {
+	if err := p2p.addStream(stream); err != nil {
+		logger.Infof("与节点%s握手失败: %v", stream.Conn().RemotePeer(), err)
+	}
+}
+
+// addStream 握手成功后开始在stream上收发消息 失败时关闭stream
+func (p2p *P2PNetWork) addStream(stream network.Stream) error {
+	peerID := stream.Conn().RemotePeer().String()
+	if p2p.reputation.Banned(peerID) {
+		stream.Reset()
+		return fmt.Errorf("节点%s在禁止期内", peerID)
+	}
 	p2pStaeam := &P2PStream{
-		peerID:           stream.Conn().RemotePeer().String(),
+		peerID:           peerID,
+		peer:             &pbftnet.Peer{ID: peerID},
 		stream:           stream,
+		reader:           bufio.NewReader(stream),
 		broadcastMsgChan: make(chan *pbftnet.BroadcastMsg, 0),
 		closeReadStrem:   make(chan struct{}, 1),
 		closeWriteStrem:  make(chan struct{}, 1),
+		format:           p2p.wireFormat(stream),
+	}
+	if err := p2p.handshake(p2pStaeam); err != nil {
+		stream.Reset()
+		return err
 	}
 	p2p.Lock()
-	p2p.books[p2pStaeam.peerID] = p2pStaeam
+	p2p.books[peerID] = p2pStaeam
 	p2p.Unlock()
 
 	go p2p.dataStreamRecv(p2pStaeam)
 	go p2p.dataStreamSend(p2pStaeam)
+	return nil
+}
+
+// wireFormat 对方只支持旧协议时使用JSON编码
+func (p2p *P2PNetWork) wireFormat(stream network.Stream) pbftnet.WireFormat {
+	if string(stream.Protocol()) == p2p.legacyProtocol {
+		return pbftnet.WireJSON
+	}
+	return pbftnet.WireProto
 }
 
 // 实现switcher接口
@@ -338,6 +368,11 @@ func (p2p *P2PNetWork) RemovePeer(p *pbftnet.Peer) error {
 	return nil
 }
 
+// Report 记录peer的行为 实现pbftnet.Reporter
+func (p2p *P2PNetWork) Report(p *pbftnet.Peer, ev pbftnet.PeerEvent) {
+	p2p.reputation.Report(p, ev)
+}
+
 func (p2p *P2PNetWork) RegisterOnReceive(modelID string, callBack pbftnet.OnReceive) error {
 	p2p.Lock()
 	p2p.recvCB[modelID] = callBack
@@ -349,8 +384,9 @@ func (p2p *P2PNetWork) Peers() ([]*pbftnet.Peer, error) {
 	peers := make([]*pbftnet.Peer, 0)
 	p2p.RLock()
 	for _, v := range p2p.books {
-		peers = append(peers, &pbftnet.Peer{ID: v.peerID})
+		peer := *v.peer
+		peers = append(peers, &peer)
 	}
-	p2p.Unlock()
+	p2p.RUnlock()
 	return peers, nil
 }
@@ -0,0 +1,392 @@
+package memnet
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+/*
+	memnet: 进程内的网络 实现network.SwitcherI
+	所有节点通过channel连接 不需要端口和引导节点 用于测试和单进程的开发网络
+	每条链路可以单独设置延迟 抖动 丢包率和重复率 延迟加上随机抖动后消息会乱序到达
+	Partition把节点分成互相不可达的分区 Heal恢复 SetDown让单个节点宕机
+
+	New创建的网络按真实时间投递 每个节点有一个接收goroutine
+	NewManual创建的网络不启动任何goroutine 消息进入队列 延迟按传入的时钟计算
+	由调用者通过Deliver逐条投递 投递顺序由种子决定 用于在虚拟时钟上确定性地运行
+*/
+
+// 每个节点接收队列的长度 队列满时消息被丢弃 相当于网络拥塞
+const inboxSize = 4096
+
+// LinkConfig 单向链路的参数
+type LinkConfig struct {
+	Latency  time.Duration // 固定延迟
+	Jitter   time.Duration // 在固定延迟之上随机增加0~Jitter的延迟 造成乱序
+	LossRate float64       // 丢包率
+	DupRate  float64       // 消息被重复投递的概率
+}
+
+type linkKey struct{ from, to string }
+
+// Network 连接所有Switcher的内存网络
+type Network struct {
+	sync.RWMutex
+	nodes map[string]*Switcher
+	order []string // 节点加入网络的顺序
+	// 没有单独设置的链路使用Default
+	Default LinkConfig
+	links   map[linkKey]LinkConfig
+	// 节点所在的分区 不同分区的节点互相不可达 为空时没有分区
+	partition map[string]int
+	randLock  sync.Mutex
+	rand      *rand.Rand
+	// 宕机的节点 收发的消息全部丢失
+	down      map[string]bool
+	closed    chan struct{}
+	closeOnce sync.Once
+	// 手动投递时使用的时钟和等待投递的消息 now为nil时按真实时间投递
+	now   func() time.Time
+	queue []*packet
+}
+
+type packet struct {
+	to  string
+	e   *envelope
+	due time.Time
+}
+
+func New(seed int64) *Network {
+	return &Network{
+		nodes:     make(map[string]*Switcher),
+		links:     make(map[linkKey]LinkConfig),
+		partition: make(map[string]int),
+		rand:      rand.New(rand.NewSource(seed)),
+		down:      make(map[string]bool),
+		closed:    make(chan struct{}),
+	}
+}
+
+// NewManual 创建手动投递的网络 链路延迟按now计算 消息由Deliver投递
+func NewManual(seed int64, now func() time.Time) *Network {
+	n := New(seed)
+	n.now = now
+	return n
+}
+
+// NewSwitcher 在网络中添加一个节点 id作为节点的peerID
+func (n *Network) NewSwitcher(id string) (*Switcher, error) {
+	n.Lock()
+	defer n.Unlock()
+	if _, ok := n.nodes[id]; ok {
+		return nil, fmt.Errorf("节点%s已经存在", id)
+	}
+	s := &Switcher{
+		net:       n,
+		id:        id,
+		inbox:     make(chan *envelope, inboxSize),
+		callbacks: make(map[string]network.OnReceive),
+		removed:   make(map[string]bool),
+	}
+	n.nodes[id] = s
+	n.order = append(n.order, id)
+	return s, nil
+}
+
+// SetLink 设置from到to方向的链路参数
+func (n *Network) SetLink(from, to string, cfg LinkConfig) {
+	n.Lock()
+	defer n.Unlock()
+	n.links[linkKey{from, to}] = cfg
+}
+
+// SetLinkBoth 同时设置两个方向的链路参数
+func (n *Network) SetLinkBoth(a, b string, cfg LinkConfig) {
+	n.SetLink(a, b, cfg)
+	n.SetLink(b, a, cfg)
+}
+
+// Partition 把节点分成互相不可达的分区 没有列出的节点在同一个分区
+func (n *Network) Partition(groups ...[]string) {
+	n.Lock()
+	defer n.Unlock()
+	n.partition = make(map[string]int)
+	for i, g := range groups {
+		for _, id := range g {
+			n.partition[id] = i + 1
+		}
+	}
+}
+
+// Heal 取消所有分区
+func (n *Network) Heal() {
+	n.Partition()
+}
+
+// SetDown 节点宕机或者恢复 宕机的节点仍然在其他节点的peer列表中 但收发的消息全部丢失
+func (n *Network) SetDown(id string, down bool) {
+	n.Lock()
+	defer n.Unlock()
+	n.down[id] = down
+}
+
+func (n *Network) IsDown(id string) bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.down[id]
+}
+
+// Close 停止所有节点的接收
+func (n *Network) Close() {
+	n.closeOnce.Do(func() { close(n.closed) })
+}
+
+// reachable 两个节点之间是否可以投递消息 调用前需要持有读锁
+func (n *Network) reachable(from, to string) bool {
+	return !n.down[from] && !n.down[to] && n.connected(from, to)
+}
+
+// connected 两个节点之间是否连接 没有被分区隔开也没有主动断开 调用前需要持有读锁
+func (n *Network) connected(from, to string) bool {
+	if n.partition[from] != n.partition[to] {
+		return false
+	}
+	a, b := n.nodes[from], n.nodes[to]
+	if a == nil || b == nil {
+		return false
+	}
+	return !a.Removed(to) && !b.Removed(from)
+}
+
+func (n *Network) link(from, to string) LinkConfig {
+	if cfg, ok := n.links[linkKey{from, to}]; ok {
+		return cfg
+	}
+	return n.Default
+}
+
+func (n *Network) float64() float64 {
+	n.randLock.Lock()
+	defer n.randLock.Unlock()
+	return n.rand.Float64()
+}
+
+func (n *Network) intn(max int) int {
+	n.randLock.Lock()
+	defer n.randLock.Unlock()
+	return n.rand.Intn(max)
+}
+
+func (n *Network) jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	n.randLock.Lock()
+	defer n.randLock.Unlock()
+	return time.Duration(n.rand.Int63n(int64(max)))
+}
+
+type envelope struct {
+	from    string
+	modelID string
+	body    []byte
+}
+
+// send 按链路参数投递一条消息 丢包和不可达时不返回错误 和真实网络一样由上层重传
+func (n *Network) send(from, to, modelID string, msg *network.BroadcastMsg) error {
+	body, err := network.EncodeMsg(network.WireProto, msg, from)
+	if err != nil {
+		return err
+	}
+	n.RLock()
+	ok := n.reachable(from, to)
+	dst := n.nodes[to]
+	cfg := n.link(from, to)
+	n.RUnlock()
+	if dst == nil {
+		return fmt.Errorf("节点%s不存在", to)
+	}
+	if !ok || (cfg.LossRate > 0 && n.float64() < cfg.LossRate) {
+		return nil
+	}
+	copies := 1
+	if cfg.DupRate > 0 && n.float64() < cfg.DupRate {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		e := &envelope{from: from, modelID: modelID, body: body}
+		delay := cfg.Latency + n.jitter(cfg.Jitter)
+		if n.now != nil {
+			n.Lock()
+			n.queue = append(n.queue, &packet{to: to, e: e, due: n.now().Add(delay)})
+			n.Unlock()
+			continue
+		}
+		if delay <= 0 {
+			dst.deliver(e)
+			continue
+		}
+		time.AfterFunc(delay, func() { dst.deliver(e) })
+	}
+	return nil
+}
+
+// Deliver 手动投递时 从到期的消息中随机取出一条投递 没有到期的消息时返回false
+// 投递时节点之间不可达的消息被丢弃
+func (n *Network) Deliver() bool {
+	n.Lock()
+	now := n.now()
+	ready := make([]int, 0, len(n.queue))
+	for i, p := range n.queue {
+		if !p.due.After(now) {
+			ready = append(ready, i)
+		}
+	}
+	if len(ready) == 0 {
+		n.Unlock()
+		return false
+	}
+	i := ready[n.intn(len(ready))]
+	p := n.queue[i]
+	n.queue = append(n.queue[:i], n.queue[i+1:]...)
+	ok := n.reachable(p.e.from, p.to)
+	dst := n.nodes[p.to]
+	n.Unlock()
+	if ok {
+		dst.receive(p.e)
+	}
+	return true
+}
+
+// Pending 手动投递时还未投递的消息数量
+func (n *Network) Pending() int {
+	n.RLock()
+	defer n.RUnlock()
+	return len(n.queue)
+}
+
+// Switcher 内存网络中的一个节点
+type Switcher struct {
+	net       *Network
+	id        string
+	inbox     chan *envelope
+	callbacks map[string]network.OnReceive
+	// 主动断开的peer 双方之间不再收发消息
+	removed   map[string]bool
+	startOnce sync.Once
+	sync.RWMutex
+}
+
+func (s *Switcher) ID() string {
+	return s.id
+}
+
+// deliver 消息进入接收队列 队列满时丢弃
+func (s *Switcher) deliver(e *envelope) {
+	select {
+	case s.inbox <- e:
+	default:
+	}
+}
+
+// Start 启动接收 收到的消息在同一个goroutine中按到达顺序交给注册的模块
+// 手动投递的网络中消息在Deliver中直接交给注册的模块 不需要启动
+func (s *Switcher) Start() error {
+	if s.net.now != nil {
+		return nil
+	}
+	s.startOnce.Do(func() { go s.recvRoutine() })
+	return nil
+}
+
+func (s *Switcher) recvRoutine() {
+	for {
+		select {
+		case e := <-s.inbox:
+			s.receive(e)
+		case <-s.net.closed:
+			return
+		}
+	}
+}
+
+// receive 把消息交给注册的模块 已经主动断开的peer发来的消息被丢弃
+func (s *Switcher) receive(e *envelope) {
+	s.RLock()
+	cb := s.callbacks[e.modelID]
+	removed := s.removed[e.from]
+	s.RUnlock()
+	if cb == nil || removed {
+		return
+	}
+	msg, _, err := network.DecodeMsg(network.WireProto, e.body)
+	if err != nil {
+		return
+	}
+	cb(e.modelID, msg, &network.Peer{ID: e.from, Address: e.from})
+}
+
+func (s *Switcher) Broadcast(modelID string, msg *network.BroadcastMsg) error {
+	return s.BroadcastExceptPeer(modelID, msg, nil)
+}
+
+func (s *Switcher) BroadcastToPeer(modelID string, msg *network.BroadcastMsg, p *network.Peer) error {
+	if p == nil {
+		return fmt.Errorf("peer is nil")
+	}
+	return s.net.send(s.id, p.ID, modelID, msg)
+}
+
+func (s *Switcher) BroadcastExceptPeer(modelID string, msg *network.BroadcastMsg, p *network.Peer) error {
+	peers, _ := s.Peers()
+	for _, peer := range peers {
+		if p != nil && peer.ID == p.ID {
+			continue
+		}
+		if err := s.net.send(s.id, peer.ID, modelID, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Switcher) RemovePeer(p *network.Peer) error {
+	if p == nil {
+		return fmt.Errorf("peer is nil")
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.removed[p.ID] = true
+	return nil
+}
+
+// Removed 是否已经主动断开了某个peer
+func (s *Switcher) Removed(id string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.removed[id]
+}
+
+func (s *Switcher) RegisterOnReceive(modelID string, callBack network.OnReceive) error {
+	s.Lock()
+	defer s.Unlock()
+	s.callbacks[modelID] = callBack
+	return nil
+}
+
+// Peers 当前连接的节点 被分区隔开和主动断开的节点不在其中 按加入网络的顺序排列
+func (s *Switcher) Peers() ([]*network.Peer, error) {
+	s.net.RLock()
+	defer s.net.RUnlock()
+	peers := make([]*network.Peer, 0, len(s.net.nodes))
+	for _, id := range s.net.order {
+		if id != s.id && s.net.connected(s.id, id) {
+			peers = append(peers, &network.Peer{ID: id, Address: id})
+		}
+	}
+	return peers, nil
+}
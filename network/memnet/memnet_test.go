@@ -0,0 +1,156 @@
+package memnet
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/network"
+)
+
+// counter 统计收到的消息
+type counter struct {
+	sync.Mutex
+	msgs []string
+}
+
+func (c *counter) onRecv(modelID string, msg *network.BroadcastMsg, p *network.Peer) {
+	c.Lock()
+	defer c.Unlock()
+	c.msgs = append(c.msgs, p.ID)
+}
+
+func (c *counter) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return len(c.msgs)
+}
+
+func newPair(t *testing.T, cfg LinkConfig) (*Network, *Switcher, *counter) {
+	n := New(1)
+	n.Default = cfg
+	a, err := n.NewSwitcher("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.NewSwitcher("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &counter{}
+	b.RegisterOnReceive("test", c.onRecv)
+	a.Start()
+	b.Start()
+	return n, a, c
+}
+
+func sendN(a *Switcher, n int) {
+	for i := 0; i < n; i++ {
+		a.Broadcast("test", &network.BroadcastMsg{ModelID: "test", Msg: []byte{byte(i)}})
+	}
+}
+
+func waitCount(c *counter, n int, d time.Duration) bool {
+	for end := time.Now().Add(d); time.Now().Before(end); time.Sleep(5 * time.Millisecond) {
+		if c.count() >= n {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLossAndDuplication(t *testing.T) {
+	n, a, c := newPair(t, LinkConfig{LossRate: 1})
+	defer n.Close()
+	sendN(a, 10)
+	time.Sleep(50 * time.Millisecond)
+	if c.count() != 0 {
+		t.Fatalf("丢包率为1时不应该收到消息 收到: %d", c.count())
+	}
+
+	n.SetLink("a", "b", LinkConfig{DupRate: 1, Jitter: 10 * time.Millisecond})
+	sendN(a, 10)
+	if !waitCount(c, 20, time.Second) {
+		t.Fatalf("重复率为1时每条消息应该收到两次 收到: %d", c.count())
+	}
+}
+
+func TestPartition(t *testing.T) {
+	now := time.Unix(0, 0)
+	n := NewManual(1, func() time.Time { return now })
+	n.Default = LinkConfig{Latency: time.Millisecond}
+	a, _ := n.NewSwitcher("a")
+	b, _ := n.NewSwitcher("b")
+	c := &counter{}
+	b.RegisterOnReceive("test", c.onRecv)
+
+	n.Partition([]string{"a"}, []string{"b"})
+	if peers, _ := a.Peers(); len(peers) != 0 {
+		t.Fatalf("分区后不应该有可达的节点")
+	}
+	sendN(a, 5)
+	n.Heal()
+	sendN(a, 5)
+	// 延迟没有到期时不投递
+	if n.Deliver() {
+		t.Fatalf("延迟没有到期的消息被投递")
+	}
+	// 分区期间发出的消息在发送时已经丢失
+	now = now.Add(time.Millisecond)
+	for n.Deliver() {
+	}
+	if c.count() != 5 {
+		t.Fatalf("恢复分区后应该收到5条消息 收到: %d", c.count())
+	}
+
+	// 投递之前节点宕机 消息丢失
+	sendN(a, 5)
+	n.SetDown("b", true)
+	now = now.Add(time.Millisecond)
+	for n.Deliver() {
+	}
+	if c.count() != 5 || n.Pending() != 0 {
+		t.Fatalf("宕机的节点不应该收到消息 收到: %d", c.count())
+	}
+}
+
+// 全连接的网络中每个节点都转发收到的消息 没有去重时消息会无限传递
+func TestGossipFlood(t *testing.T) {
+	now := time.Unix(0, 0)
+	n := NewManual(3, func() time.Time { return now })
+	n.Default = LinkConfig{Jitter: 2 * time.Millisecond, DupRate: 0.2}
+
+	gossipers := make([]*network.Gossiper, 0, 5)
+	counters := make([]*counter, 0, 5)
+	for i := 0; i < 5; i++ {
+		sw, err := n.NewSwitcher(fmt.Sprintf("n%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := network.NewGossiper(sw)
+		c := &counter{}
+		g.RegisterOnReceive("test", func(modelID string, msg *network.BroadcastMsg, p *network.Peer) {
+			c.onRecv(modelID, msg, p)
+			g.Gossip(modelID, msg, p)
+		})
+		gossipers = append(gossipers, g)
+		counters = append(counters, c)
+	}
+
+	gossipers[0].Gossip("test", &network.BroadcastMsg{ModelID: "test", Msg: []byte("hello")}, nil)
+	for n.Pending() > 0 {
+		now = now.Add(time.Millisecond)
+		for n.Deliver() {
+		}
+	}
+	for i, c := range counters {
+		want := 1
+		if i == 0 {
+			want = 0
+		}
+		if c.count() != want {
+			t.Fatalf("节点%d处理了%d次gossip消息", i, c.count())
+		}
+	}
+}
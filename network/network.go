@@ -26,14 +26,33 @@ type BroadcastMsg struct {
 	ModelID string                 `json:"model_id"`
 	MsgType model.BroadcastMsgType `json:"msg_type"`
 	Msg     []byte                 `json:"msg"`
+	// 请求ID 响应时原样带回 旧版本的JSON格式不包含此字段
+	RequestID uint64 `json:"request_id,omitempty"`
+	// gossip消息剩余的转发跳数 为0表示点对点的消息 不做去重
+	TTL uint32 `json:"ttl,omitempty"`
 }
 
-// OnReceive 注册接收消息回到
-type OnReceive func(modelID string, msgBytes []byte, p *Peer)
+// OnReceive 注册接收消息回调 msg已经由网络层解码 模块不需要再解码
+type OnReceive func(modelID string, msg *BroadcastMsg, p *Peer)
 
 type Peer struct {
 	ID      string // 定义peerid  每个peerid应该是唯一的
 	Address string // 地址
+	// 以下为握手时协商的信息 没有握手的peer为零值
+	PublicKey []byte
+	ChainID   string
+	Version   uint32 // 协议版本
+	Height    uint64 // 握手时对方的高度
+	Role      model.NodeRole
+}
+
+// SetHandshake 记录握手协商的信息
+func (p *Peer) SetHandshake(hs *model.Handshake) {
+	p.PublicKey = hs.PublicKey
+	p.ChainID = hs.ChainId
+	p.Version = hs.ProtocolVersion
+	p.Height = hs.Height
+	p.Role = hs.Role
 }
 
 type PeerBooks struct {
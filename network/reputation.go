@@ -0,0 +1,238 @@
+package network
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/common/metrics"
+)
+
+var logger *log.Entry
+
+func init() {
+	logg := log.New()
+	logg.SetLevel(log.InfoLevel)
+	logg.SetReportCaller(true)
+	logg.SetFormatter(&log.TextFormatter{
+		DisableColors: true,
+		FullTimestamp: true,
+	})
+	logger = logg.WithField("module", "network")
+}
+
+var peerBanned = metrics.NewCounterVec("pbft_network_peers_banned_total",
+	"因为信誉过低被禁止的peer数量", "event")
+
+/*
+	peer信誉
+	模块通过ReportPeer上报peer的行为 每种行为对应一个分数
+	分数低于阈值的peer被断开并在一段时间内禁止连接 禁止列表保存在文件中 重启后仍然有效
+	libp2p和http两种switcher都使用Reputation 内存网络不实现Reporter 上报被忽略
+*/
+
+// PeerEvent peer的行为
+type PeerEvent int
+
+const (
+	EventInvalidBlock PeerEvent = iota // 发送了无效的区块
+	EventBadSignature                  // 签名错误
+	EventBadMessage                    // 消息无法解析
+	EventTimeout                       // 请求超时没有响应
+	EventUsefulBlock                   // 提供了有效的区块
+)
+
+func (e PeerEvent) String() string {
+	switch e {
+	case EventInvalidBlock:
+		return "invalid_block"
+	case EventBadSignature:
+		return "bad_signature"
+	case EventBadMessage:
+		return "bad_message"
+	case EventTimeout:
+		return "timeout"
+	case EventUsefulBlock:
+		return "useful_block"
+	}
+	return "unknown"
+}
+
+// 每种行为对应的分数 作恶的行为扣分多 超时可能是网络原因扣分少
+var eventScores = map[PeerEvent]int{
+	EventInvalidBlock: -40,
+	EventBadSignature: -40,
+	EventBadMessage:   -20,
+	EventTimeout:      -5,
+	EventUsefulBlock:  2,
+}
+
+const (
+	defaultBanThreshold = -100
+	defaultBanDuration  = time.Hour
+	// 分数的上限 防止长期表现良好的peer积累过多的分数后作恶不会被禁止
+	maxPeerScore = 50
+)
+
+// Reporter 可以接收peer行为上报的switcher
+type Reporter interface {
+	Report(p *Peer, ev PeerEvent)
+}
+
+// ReportPeer 向switcher上报peer的行为 switcher不支持时忽略
+func ReportPeer(s SwitcherI, p *Peer, ev PeerEvent) {
+	if r, ok := s.(Reporter); ok && p != nil {
+		r.Report(p, ev)
+	}
+}
+
+// Reputation 记录peer的分数和禁止列表
+type Reputation struct {
+	sync.Mutex
+	threshold int
+	duration  time.Duration
+	path      string // 禁止列表的保存路径 为空时不保存
+	scores    map[string]int
+	bans      map[string]time.Time // 禁止到什么时候
+	onBan     func(p *Peer)
+	now       func() time.Time
+}
+
+// NewReputation 从配置创建 配置了保存路径时加载之前的禁止列表
+func NewReputation(cfg *config.NetworkCfg) (*Reputation, error) {
+	r := &Reputation{
+		threshold: cfg.BanThreshold,
+		duration:  time.Duration(cfg.BanDuration) * time.Second,
+		path:      cfg.BanListPath,
+		scores:    make(map[string]int),
+		bans:      make(map[string]time.Time),
+		now:       time.Now,
+	}
+	if r.threshold >= 0 {
+		r.threshold = defaultBanThreshold
+	}
+	if r.duration <= 0 {
+		r.duration = defaultBanDuration
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnBan 设置peer被禁止时的回调 switcher在回调中断开连接
+func (r *Reputation) OnBan(fn func(p *Peer)) {
+	r.Lock()
+	defer r.Unlock()
+	r.onBan = fn
+}
+
+// Report 记录一次行为 分数低于阈值时禁止peer
+func (r *Reputation) Report(p *Peer, ev PeerEvent) {
+	if p == nil || p.ID == "" {
+		return
+	}
+	r.Lock()
+	if r.banned(p.ID) {
+		r.Unlock()
+		return
+	}
+	score := r.scores[p.ID] + eventScores[ev]
+	if score > maxPeerScore {
+		score = maxPeerScore
+	}
+	r.scores[p.ID] = score
+	if score >= r.threshold {
+		r.Unlock()
+		return
+	}
+	delete(r.scores, p.ID)
+	r.bans[p.ID] = r.now().Add(r.duration)
+	err := r.save()
+	onBan := r.onBan
+	r.Unlock()
+
+	logger.Warnf("节点%s的信誉过低 禁止连接%v 最后的行为: %s", p.ID, r.duration, ev)
+	if err != nil {
+		logger.Warnf("保存禁止列表失败 err: %v", err)
+	}
+	peerBanned.With(ev.String()).Inc()
+	if onBan != nil {
+		onBan(p)
+	}
+}
+
+// Score peer当前的分数
+func (r *Reputation) Score(id string) int {
+	r.Lock()
+	defer r.Unlock()
+	return r.scores[id]
+}
+
+// Banned peer是否在禁止期内
+func (r *Reputation) Banned(id string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.banned(id)
+}
+
+// banned 调用前需要持有锁 过期的禁止会被删除
+func (r *Reputation) banned(id string) bool {
+	until, ok := r.bans[id]
+	if !ok {
+		return false
+	}
+	if r.now().Before(until) {
+		return true
+	}
+	delete(r.bans, id)
+	return false
+}
+
+// load 加载禁止列表 文件不存在时为空
+func (r *Reputation) load() error {
+	if r.path == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &r.bans); err != nil {
+		return err
+	}
+	now := r.now()
+	for id, until := range r.bans {
+		if !now.Before(until) {
+			delete(r.bans, id)
+		}
+	}
+	return nil
+}
+
+// save 保存禁止列表 先写临时文件再重命名 防止写到一半时退出 调用前需要持有锁
+func (r *Reputation) save() error {
+	if r.path == "" {
+		return nil
+	}
+	content, err := json.Marshal(r.bans)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
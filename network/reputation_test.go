@@ -0,0 +1,61 @@
+package network
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wupeaking/pbft_impl/common/config"
+)
+
+func TestReputationBan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reputation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &config.NetworkCfg{BanThreshold: -50, BanDuration: 60, BanListPath: filepath.Join(dir, "banlist.json")}
+
+	r, err := NewReputation(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var removed []string
+	r.OnBan(func(p *Peer) { removed = append(removed, p.ID) })
+
+	good, bad := &Peer{ID: "good"}, &Peer{ID: "bad"}
+	for i := 0; i < 100; i++ {
+		r.Report(good, EventUsefulBlock)
+	}
+	if r.Score("good") != maxPeerScore {
+		t.Fatalf("分数应该有上限 当前: %d", r.Score("good"))
+	}
+	r.Report(good, EventTimeout)
+	r.Report(bad, EventBadMessage)
+	if r.Banned("bad") || len(removed) != 0 {
+		t.Fatalf("分数没有低于阈值时不应该被禁止")
+	}
+	r.Report(bad, EventInvalidBlock)
+	if !r.Banned("bad") || len(removed) != 1 || removed[0] != "bad" {
+		t.Fatalf("分数低于阈值后应该被禁止并断开 removed: %v", removed)
+	}
+	if r.Banned("good") {
+		t.Fatalf("正常的节点不应该被禁止")
+	}
+
+	// 重启后禁止列表仍然有效
+	r2, err := NewReputation(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r2.Banned("bad") || r2.Banned("good") {
+		t.Fatalf("重启后禁止列表不正确")
+	}
+	// 禁止期结束后可以重新连接 分数重新计算
+	r2.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if r2.Banned("bad") || r2.Score("bad") != 0 {
+		t.Fatalf("禁止期结束后应该解除禁止")
+	}
+}
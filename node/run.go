@@ -50,19 +50,6 @@ func New() *PBFTNode {
 	if err != nil {
 		logger.Fatalf("读取配置文件发生错误 err: %v", err)
 	}
-	var switcher network.SwitcherI
-	if cfg.NetMode == "http" {
-		switcher = http_network.New(cfg.NodeAddrs, cfg.LocalAddr, cfg.NetworkCfg.Publickey, cfg)
-	} else {
-		switcher, err = libp2p.New(cfg)
-		if err != nil {
-			panic(err)
-		}
-	}
-
-	vm := cvm.New(db, cfg)
-	txPool := transaction.NewTxPool(switcher, cfg, db)
-
 	var consen *consensus.PBFT
 
 	if genesis == nil {
@@ -80,7 +67,8 @@ func New() *PBFTNode {
 			if err != nil {
 				logger.Fatalf("验证者公钥格式错误")
 			}
-			zeroBlock.Verifiers = append(zeroBlock.Verifiers, &model.Verifier{PublickKey: pub, SeqNum: int32(i)})
+			zeroBlock.Verifiers = append(zeroBlock.Verifiers, &model.Verifier{PublickKey: pub, SeqNum: int32(i),
+				Weight: verfiers.Weight})
 			if cfg.ConsensusCfg.Publickey == verfiers.Publickey {
 				pri, _ := cryptogo.Hex2Bytes(cfg.ConsensusCfg.PriVateKey)
 				ws.CurVerfier = &model.Verifier{PublickKey: pub, PrivateKey: pri, SeqNum: 0}
@@ -132,6 +120,36 @@ func New() *PBFTNode {
 	// 	}
 	// 	consen = pbft
 	// }
+
+	// 握手需要创世区块哈希 网络模块在创世区块确定之后创建
+	genesis, err = ws.GetGenesis()
+	if err != nil || genesis == nil {
+		logger.Fatalf("读取创世区块发生错误 err: %v", err)
+	}
+	hs, err := network.NewHandshaker(cfg.NetworkCfg.ChainID, genesis.Hash(), cfg.NetworkCfg.PriVateKey, nodeStatus(ws))
+	if err != nil {
+		logger.Fatalf("加载网络私钥错误 err: %v", err)
+	}
+	var switcher network.SwitcherI
+	if cfg.NetMode == "http" {
+		switcher = http_network.New(cfg.NodeAddrs, cfg.LocalAddr, cfg.NetworkCfg.Publickey, cfg, hs)
+	} else {
+		switcher, err = libp2p.New(cfg, hs)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// 所有模块共用一个gossip去重缓存
+	switcher = network.NewGossiper(switcher)
+
+	vm := cvm.New(db, cfg)
+	txPool := transaction.NewTxPool(switcher, cfg, db)
+
+	// 获取blockmeta 更新ws 共识模块重放预写日志时需要知道当前高度
+	if _, err := ws.GetBlockMeta(); err != nil {
+		logger.Fatalf("读取区块元数据错误 err: %v", err)
+	}
 	pbft, err := consensus.New(ws, txPool, switcher, vm, cfg)
 	if err != nil {
 		logger.Fatalf("读取配置文件发生错误 err: %v", err)
@@ -152,12 +170,21 @@ func New() *PBFTNode {
 	}
 }
 
-func (node *PBFTNode) Run() {
-	// 获取blockmeta 更新ws
-	_, err := node.ws.GetBlockMeta()
-	if err != nil {
-		logger.Fatalf("读取区块元数据错误 err: %v", err)
+// nodeStatus 握手时上报的高度和角色
+func nodeStatus(ws *world_state.WroldState) network.NodeStatus {
+	return func() (uint64, model.NodeRole) {
+		ws.RLock()
+		height := ws.BlockNum
+		cur := ws.CurVerfier
+		ws.RUnlock()
+		if cur != nil && ws.IsVerfier(cur.PublickKey) {
+			return height, model.NodeRole_validator
+		}
+		return height, model.NodeRole_observer
 	}
+}
+
+func (node *PBFTNode) Run() {
 	// if meta.BlockHeight > node.ws.BlockNum {
 	// 	// 如果当前状态还未达到最高 需要apply
 	// 	for i := uint64(1); i < meta.BlockHeight; i++ {
@@ -178,6 +205,9 @@ func (node *PBFTNode) Run() {
 	if node.ws.CurVerfier != nil {
 		// 启动共识
 		go node.consensusEngine.Daemon()
+	} else if node.consensusEngine.IsObserver() {
+		// 观察者只跟随共识
+		go node.consensusEngine.Daemon()
 	} else {
 		logger.Info("当前节点不是验证者节点,只能作为普通节点启动...")
 	}
@@ -188,6 +218,7 @@ func (node *PBFTNode) Run() {
 
 	// 启动API服务
 	node.apiServer.GET("/", node.apiServer.DefaultHandler)
+	node.apiServer.GET("/metrics", node.apiServer.MetricsHandler)
 	node.chain.StartAPI(node.apiServer.Group("/blockchain"))
 	node.tx.StartAPI(node.apiServer.Group("/tx"))
 	node.consensusEngine.StartAPI(node.apiServer.Group("/consensus"))
@@ -195,7 +226,7 @@ func (node *PBFTNode) Run() {
 	account.NewAccountApi(node.db).StartAPI(node.apiServer.Group("/account"))
 	go node.apiServer.Start()
 
-	sig := make(chan os.Signal)
+	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM,
 		syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2)
 
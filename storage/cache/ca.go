@@ -6,10 +6,43 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/wupeaking/pbft_impl/common/metrics"
 	"github.com/wupeaking/pbft_impl/model"
 	"github.com/wupeaking/pbft_impl/storage/database"
 )
 
+var (
+	cacheHits   = metrics.NewCounterVec("pbft_storage_cache_hits_total", "LRU缓存命中次数", "cache")
+	cacheMisses = metrics.NewCounterVec("pbft_storage_cache_misses_total", "LRU缓存未命中次数", "cache")
+	cacheNames  = []string{"block", "block_num", "account", "tx", "tx_receipt"}
+)
+
+func init() {
+	metrics.NewGaugeFuncVec("pbft_storage_cache_hit_ratio", "LRU缓存命中率", "cache", func() map[string]float64 {
+		ratios := make(map[string]float64, len(cacheNames))
+		for _, name := range cacheNames {
+			hits, misses := cacheHits.With(name).Value(), cacheMisses.With(name).Value()
+			if hits+misses == 0 {
+				ratios[name] = 0
+				continue
+			}
+			ratios[name] = float64(hits) / float64(hits+misses)
+		}
+		return ratios
+	})
+}
+
+// cacheGet 从LRU缓存中读取 同时统计命中率
+func cacheGet(c *lru.Cache, name string, key interface{}) (interface{}, bool) {
+	v, ok := c.Get(key)
+	if ok {
+		cacheHits.With(name).Inc()
+	} else {
+		cacheMisses.With(name).Inc()
+	}
+	return v, ok
+}
+
 // 增加一个缓存层
 type DBCache struct {
 	blockDB database.DB
@@ -53,6 +86,30 @@ func New(filepath string) *DBCache {
 	if err != nil {
 		panic(err)
 	}
+	return newDBCache(blockDB, metaDB, txDB, txRecDB, accountDB)
+}
+
+// NewReadOnly 以只读方式打开本地数据 用于离线校验
+func NewReadOnly(filepath string) (*DBCache, error) {
+	names := []string{"block", "meta", "transaction", "tx_receipts", "account"}
+	dbs := make([]database.DB, 0, len(names))
+	for _, name := range names {
+		db, err := database.NewLevelDBReadOnly(path.Join(filepath, "./pbft/"+name+".db"))
+		if err != nil {
+			return nil, fmt.Errorf("打开%s数据库失败 err: %v", name, err)
+		}
+		dbs = append(dbs, db)
+	}
+	return newDBCache(dbs[0], dbs[1], dbs[2], dbs[3], dbs[4]), nil
+}
+
+// NewMemory 使用内存数据库的缓存层 用于测试和模拟
+func NewMemory() *DBCache {
+	return newDBCache(database.NewMemDB(), database.NewMemDB(), database.NewMemDB(),
+		database.NewMemDB(), database.NewMemDB())
+}
+
+func newDBCache(blockDB, metaDB, txDB, txRecDB, accountDB database.DB) *DBCache {
 	dbCahce := &DBCache{
 		blockDB:     blockDB,
 		metaDB:      metaDB,
@@ -155,7 +212,7 @@ func (dbc *DBCache) GetBlockMeta() (*model.BlockMeta, error) {
 }
 
 func (dbc *DBCache) GetBlockByID(id string) (*model.PbftBlock, error) {
-	b, ok := dbc.blocks.Get(id)
+	b, ok := cacheGet(dbc.blocks, "block", id)
 	if ok {
 		return b.(*model.PbftBlock), nil
 	}
@@ -174,7 +231,7 @@ func (dbc *DBCache) GetBlockByID(id string) (*model.PbftBlock, error) {
 }
 
 func (dbc *DBCache) GetBlockByNum(num uint64) (*model.PbftBlock, error) {
-	bid, ok := dbc.blockNum2Id.Get(num)
+	bid, ok := cacheGet(dbc.blockNum2Id, "block_num", num)
 	var value string
 	if !ok {
 		// 先获取blockid
@@ -249,7 +306,7 @@ func (dbc *DBCache) SetGenesisBlock(genesis *model.Genesis) error {
 }
 
 func (dbc *DBCache) GetTxByID(id string) (*model.Tx, error) {
-	v, ok := dbc.txCahe.Get(id)
+	v, ok := cacheGet(dbc.txCahe, "tx", id)
 	if ok {
 		return v.(*model.Tx), nil
 	}
@@ -268,7 +325,7 @@ func (dbc *DBCache) GetTxByID(id string) (*model.Tx, error) {
 }
 
 func (dbc *DBCache) GetAccountByID(id string) (*model.Account, error) {
-	v, ok := dbc.accountCahe.Get(id)
+	v, ok := cacheGet(dbc.accountCahe, "account", id)
 	if ok {
 		return v.(*model.Account), nil
 	}
@@ -286,8 +343,24 @@ func (dbc *DBCache) GetAccountByID(id string) (*model.Account, error) {
 	return &acc, err
 }
 
+// ScanAccounts 遍历所有账户 fn返回false时停止
+func (dbc *DBCache) ScanAccounts(fn func(acc *model.Account) bool) error {
+	var decodeErr error
+	err := dbc.accountDB.Scan("", func(key, value string) bool {
+		var acc model.Account
+		if decodeErr = proto.Unmarshal([]byte(value), &acc); decodeErr != nil {
+			return false
+		}
+		return fn(&acc)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
 func (dbc *DBCache) GetTxReceiptByID(id string) (*model.TxReceipt, error) {
-	v, ok := dbc.txReceiptCahe.Get(id)
+	v, ok := cacheGet(dbc.txReceiptCahe, "tx_receipt", id)
 	if ok {
 		return v.(*model.TxReceipt), nil
 	}
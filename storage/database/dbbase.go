@@ -3,6 +3,10 @@ package database
 type DB interface {
 	Get(key string) (string, error)
 	Set(key, value string) error
+	// SetSync 写入并等待数据落盘 用于崩溃后不能丢失的记录
+	SetSync(key, value string) error
 	Delete(key string) error
+	// Scan 按key的顺序遍历指定前缀的所有记录 fn返回false时停止遍历
+	Scan(prefix string, fn func(key, value string) bool) error
 	// Open(filename string) error
 }
@@ -2,6 +2,8 @@ package database
 
 import (
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type LevelDB struct {
@@ -13,6 +15,12 @@ func NewLevelDB(path string) (DB, error) {
 	return &LevelDB{db}, err
 }
 
+// NewLevelDBReadOnly 以只读方式打开 数据库不存在时返回错误
+func NewLevelDBReadOnly(path string) (DB, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	return &LevelDB{db}, err
+}
+
 func (ldb *LevelDB) Get(key string) (string, error) {
 	v, err := ldb.DB.Get([]byte(key), nil)
 	if err == leveldb.ErrNotFound {
@@ -25,6 +33,21 @@ func (ldb *LevelDB) Set(key, value string) error {
 	return ldb.Put([]byte(key), []byte(value), nil)
 }
 
+func (ldb *LevelDB) SetSync(key, value string) error {
+	return ldb.Put([]byte(key), []byte(value), &opt.WriteOptions{Sync: true})
+}
+
 func (ldb *LevelDB) Delete(key string) error {
 	return ldb.DB.Delete([]byte(key), nil)
 }
+
+func (ldb *LevelDB) Scan(prefix string, fn func(key, value string) bool) error {
+	iter := ldb.DB.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		if !fn(string(iter.Key()), string(iter.Value())) {
+			break
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemDB 内存数据库 用于测试和模拟
+type MemDB struct {
+	sync.RWMutex
+	kv map[string]string
+}
+
+func NewMemDB() DB {
+	return &MemDB{kv: make(map[string]string)}
+}
+
+func (mdb *MemDB) Get(key string) (string, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	return mdb.kv[key], nil
+}
+
+func (mdb *MemDB) Set(key, value string) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	mdb.kv[key] = value
+	return nil
+}
+
+// SetSync 内存数据库没有落盘 和Set相同
+func (mdb *MemDB) SetSync(key, value string) error {
+	return mdb.Set(key, value)
+}
+
+func (mdb *MemDB) Delete(key string) error {
+	mdb.Lock()
+	defer mdb.Unlock()
+	delete(mdb.kv, key)
+	return nil
+}
+
+func (mdb *MemDB) Scan(prefix string, fn func(key, value string) bool) error {
+	mdb.RLock()
+	keys := make([]string, 0)
+	for k := range mdb.kv {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		values[i] = mdb.kv[k]
+	}
+	mdb.RUnlock()
+
+	for i := range keys {
+		if !fn(keys[i], values[i]) {
+			break
+		}
+	}
+	return nil
+}
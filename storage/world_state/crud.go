@@ -12,12 +12,17 @@ func (ws *WroldState) InsertBlock(block *model.PbftBlock) error {
 }
 
 func (ws *WroldState) UpdateLastWorldState() error {
+	ws.RLock()
+	defer func() { ws.RUnlock() }()
 	return ws.db.Insert(&model.BlockMeta{
-		BlockHeight: ws.BlockNum,
-		CurVerfier:  ws.CurVerfier,
-		VerifierNo:  uint32(ws.VerifierNo),
-		Verifiers:   ws.Verifiers,
-		LastView:    ws.View,
+		BlockHeight:       ws.BlockNum,
+		CurVerfier:        ws.CurVerfier,
+		VerifierNo:        uint32(ws.VerifierNo),
+		Verifiers:         ws.Verifiers,
+		LastView:          ws.View,
+		PendingChanges:    ws.PendingChanges,
+		LeaderFailures:    ws.LeaderFailures,
+		IncludedEvidences: ws.IncludedEvidences,
 	})
 }
 
@@ -34,6 +39,9 @@ func (ws *WroldState) GetBlockMeta() (*model.BlockMeta, error) {
 	ws.CurVerfier = meta.CurVerfier
 	ws.VerifierNo = int(meta.VerifierNo)
 	ws.Verifiers = meta.Verifiers
+	ws.PendingChanges = meta.PendingChanges
+	ws.LeaderFailures = meta.LeaderFailures
+	ws.IncludedEvidences = meta.IncludedEvidences
 	ws.updateVerifierMap()
 	if ws.BlockNum == 0 {
 		ws.BlockID = model.GenesisBlockId
@@ -1,7 +1,9 @@
 package world_state
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -22,9 +24,15 @@ type WroldState struct {
 	VerifierNo   int             `josn:"verifierNo"` // 验证者所处编号 如果为-1  表示不是验证者
 	CurVerfier   *model.Verifier `json:"curVerfier"`
 	View         uint64          `json:"view"` // 当前视图
-	db           *cache.DBCache
-	sync.RWMutex `json:"-"`
-	txRecordDB   *sqlx.DB
+	// 已经提交但还未生效的验证者变更
+	PendingChanges []*model.ValidatorChange `json:"pendingChanges"`
+	// 最近超时的主节点
+	LeaderFailures []*model.LeaderFailure `json:"leaderFailures"`
+	// 最近区块中已经包含的双签证据
+	IncludedEvidences []*model.IncludedEvidence `json:"includedEvidences"`
+	db                *cache.DBCache
+	sync.RWMutex      `json:"-"`
+	txRecordDB        *sqlx.DB
 }
 
 func New(dbCache *cache.DBCache, txRecordPath string) *WroldState {
@@ -95,6 +103,13 @@ func (ws *WroldState) SetView(v uint64) {
 	ws.View = v
 }
 
+// Progress 本地提交的高度和当前视图 可以在其他goroutine中调用
+func (ws *WroldState) Progress() (uint64, uint64) {
+	ws.RLock()
+	defer func() { ws.RUnlock() }()
+	return ws.BlockNum, ws.View
+}
+
 func (ws *WroldState) SetValue(blockNum uint64, prevBlock string, blockID string,
 	verifiers []*model.Verifier) {
 	ws.Lock()
@@ -123,6 +138,20 @@ func (ws *WroldState) IsVerfier(publicKey []byte) bool {
 func (ws *WroldState) updateVerifierMap() {
 	ws.Lock()
 	defer func() { ws.Unlock() }()
+	ws.rebuildVerifiers()
+}
+
+// rebuildVerifiers 验证者列表变化后 重新生成索引和本节点的编号 调用前需要持有锁
+func (ws *WroldState) rebuildVerifiers() {
+	if ws.CurVerfier != nil {
+		ws.VerifierNo = -1
+		for i := range ws.Verifiers {
+			if string(ws.Verifiers[i].PublickKey) == string(ws.CurVerfier.PublickKey) {
+				ws.VerifierNo = i
+				ws.CurVerfier.SeqNum = int32(i)
+			}
+		}
+	}
 	newValue := make(map[string]struct{})
 	for i := range ws.Verifiers {
 		newValue[string(ws.Verifiers[i].PublickKey)] = struct{}{}
@@ -157,3 +186,116 @@ func (ws *WroldState) InsertTxRecords(txs []*model.Tx, txrs []*model.TxReceipt,
 	_, err := ws.txRecordDB.Exec(smt, values...)
 	return err
 }
+
+// AddValidatorChange 记录一个已经提交的验证者变更 等到生效高度时再切换
+func (ws *WroldState) AddValidatorChange(c *model.ValidatorChange) {
+	ws.Lock()
+	defer func() { ws.Unlock() }()
+	ws.PendingChanges = append(ws.PendingChanges, c)
+}
+
+// NextValidatorChange 最早生效的验证者变更的生效高度 没有等待生效的变更时返回0
+func (ws *WroldState) NextValidatorChange() uint64 {
+	ws.RLock()
+	defer ws.RUnlock()
+	var next uint64
+	for _, c := range ws.PendingChanges {
+		if next == 0 || c.EffectiveHeight < next {
+			next = c.EffectiveHeight
+		}
+	}
+	return next
+}
+
+// ApplyValidatorChanges 切换到height高度使用的验证者集合 返回切换时被忽略的变更错误
+// 验证者列表 索引和本节点编号在同一个锁内更新 保证quorum 主节点轮换和验证者校验同时生效
+func (ws *WroldState) ApplyValidatorChanges(height uint64) (bool, []error) {
+	ws.Lock()
+	defer func() { ws.Unlock() }()
+	due := make([]*model.ValidatorChange, 0)
+	remain := make([]*model.ValidatorChange, 0, len(ws.PendingChanges))
+	for _, c := range ws.PendingChanges {
+		if c.EffectiveHeight <= height {
+			due = append(due, c)
+		} else {
+			remain = append(remain, c)
+		}
+	}
+	if len(due) == 0 {
+		return false, nil
+	}
+	// 按生效高度排序 相同高度按提交顺序
+	sort.SliceStable(due, func(i, j int) bool { return due[i].EffectiveHeight < due[j].EffectiveHeight })
+
+	errs := make([]error, 0)
+	verifiers := ws.Verifiers
+	for _, c := range due {
+		next, err := model.ApplyValidatorChange(verifiers, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		verifiers = next
+	}
+	ws.Verifiers = verifiers
+	ws.PendingChanges = remain
+	ws.rebuildVerifiers()
+	return true, errs
+}
+
+// RecordLeaderFailures 记录在height高度超时的主节点 只保留最近keep个高度内的记录
+func (ws *WroldState) RecordLeaderFailures(height uint64, leaders [][]byte, keep uint64) {
+	ws.Lock()
+	defer func() { ws.Unlock() }()
+	remain := make([]*model.LeaderFailure, 0, len(ws.LeaderFailures)+len(leaders))
+	for _, f := range ws.LeaderFailures {
+		if f.Height+keep > height {
+			remain = append(remain, f)
+		}
+	}
+	for _, l := range leaders {
+		remain = append(remain, &model.LeaderFailure{Height: height, PublickKey: l})
+	}
+	ws.LeaderFailures = remain
+}
+
+// RecentLeaderFailures 返回高度在(from, to]之间的超时记录
+func (ws *WroldState) RecentLeaderFailures(from, to uint64) []*model.LeaderFailure {
+	ws.RLock()
+	defer func() { ws.RUnlock() }()
+	ret := make([]*model.LeaderFailure, 0)
+	for _, f := range ws.LeaderFailures {
+		if f.Height > from && f.Height <= to {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// RecordEvidences 记录height高度的区块中包含的双签证据 只保留最近keep个高度内的记录
+func (ws *WroldState) RecordEvidences(height uint64, hashes [][]byte, keep uint64) {
+	ws.Lock()
+	defer func() { ws.Unlock() }()
+	remain := make([]*model.IncludedEvidence, 0, len(ws.IncludedEvidences)+len(hashes))
+	for _, e := range ws.IncludedEvidences {
+		if e.Height+keep > height {
+			remain = append(remain, e)
+		}
+	}
+	for _, h := range hashes {
+		remain = append(remain, &model.IncludedEvidence{Height: height, Hash: h})
+	}
+	ws.IncludedEvidences = remain
+}
+
+// EvidenceIncluded 双签证据是否已经包含在最近的区块中
+func (ws *WroldState) EvidenceIncluded(hash []byte) bool {
+	ws.RLock()
+	defer func() { ws.RUnlock() }()
+	for _, e := range ws.IncludedEvidences {
+		if bytes.Equal(e.Hash, hash) {
+			return true
+		}
+	}
+	return false
+}
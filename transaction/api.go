@@ -46,6 +46,7 @@ func (t *TxPool) addTxHandler(ctx echo.Context) error {
 		PublicKey string `json:"publick_key"`
 		Sequeue   string `json:"sequeue"`
 		Timestamp uint64 `json:"timestamp"`
+		Input     string `json:"input"` // 验证者变更等特殊交易的参数 十六进制编码
 	}{}
 
 	content, err := ioutil.ReadAll(ctx.Request().Body)
@@ -63,6 +64,12 @@ func (t *TxPool) addTxHandler(ctx echo.Context) error {
 	if err != nil {
 		return &echo.HTTPError{Code: -1, Internal: err}
 	}
+	var input []byte
+	if request.Input != "" {
+		if input, err = cryptogo.Hex2Bytes(request.Input); err != nil {
+			return &echo.HTTPError{Code: -1, Internal: err}
+		}
+	}
 	// fmt.Printf("received tx %#v\n", request)
 
 	tx := &model.Tx{
@@ -73,6 +80,7 @@ func (t *TxPool) addTxHandler(ctx echo.Context) error {
 		TimeStamp:  request.Timestamp,
 		Sequeue:    request.Sequeue,
 		Amount:     &model.Amount{Amount: fmt.Sprintf("%d", request.Amount)},
+		Input:      input,
 	}
 	if err := t.VerifyTx(tx); err != nil {
 		return &echo.HTTPError{Code: -1, Internal: err}
@@ -39,6 +39,13 @@ func (p *Pool) len() uint64 {
 	return p.length
 }
 
+func (p *Pool) exist(tx *model.Tx) bool {
+	p.RLock()
+	defer p.RUnlock()
+	_, ok := p.txids[fmt.Sprintf("%0x", tx.Sign)]
+	return ok
+}
+
 func (p *Pool) addValue(tx *model.Tx) bool {
 	p.Lock()
 	defer p.Unlock()
@@ -1,7 +1,6 @@
 package transaction
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -10,6 +9,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 	"github.com/wupeaking/pbft_impl/common/config"
+	"github.com/wupeaking/pbft_impl/common/metrics"
 	"github.com/wupeaking/pbft_impl/model"
 	"github.com/wupeaking/pbft_impl/network"
 	"github.com/wupeaking/pbft_impl/storage/cache"
@@ -28,11 +28,17 @@ func init() {
 	logger = logg.WithField("module", "blockchain")
 }
 
+var (
+	txAccepted = metrics.NewCounter("pbft_txpool_accepted_total", "加入交易池的交易数量")
+	txRejected = metrics.NewCounterVec("pbft_txpool_rejected_total", "被交易池拒绝的交易数量", "reason")
+)
+
 type txReadMark struct {
 	marked bool
 }
 type TxPool struct {
-	switcher network.SwitcherI
+	// 交易通过gossip传播 收到过的交易批次不会重复处理和转发
+	switcher *network.Gossiper
 	db       *cache.DBCache
 	pool     *Pool
 	cap      int
@@ -55,13 +61,19 @@ func NewTxPool(switcher network.SwitcherI, cfg *config.Configure, db *cache.DBCa
 	}
 	pool := NewPool(uint64(cfg.MaxTxNum))
 
-	return &TxPool{
-		switcher: switcher,
+	txpool := &TxPool{
+		switcher: network.NewGossiper(switcher),
 		pool:     pool,
 		cap:      cfg.MaxTxNum,
 		txIds:    make(map[string]txReadMark),
 		db:       db,
 	}
+	metrics.NewGaugeFunc("pbft_txpool_size", "交易池中的交易数量", func() float64 {
+		pool.RLock()
+		defer pool.RUnlock()
+		return float64(pool.len())
+	})
+	return txpool
 }
 
 func (txpool *TxPool) Start() error {
@@ -71,29 +83,29 @@ func (txpool *TxPool) Start() error {
 	return nil
 }
 
-func (txpool *TxPool) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer) {
+func (txpool *TxPool) msgOnRecv(modelID string, msgPkg *network.BroadcastMsg, p *network.Peer) {
 	if modelID != "transaction" {
 		return
 	}
 
-	var msgPkg network.BroadcastMsg
-	if err := json.Unmarshal(msgBytes, &msgPkg); err != nil {
-		logger.Debugf("接收的的消息不能被解码 err: %v", err)
-		return
-	}
-
 	switch msgPkg.MsgType {
 	case model.BroadcastMsgType_send_tx:
 		// 表示对方发送交易信息
 		var txResp model.Txs
 		if proto.Unmarshal(msgPkg.Msg, &txResp) != nil {
+			network.ReportPeer(txpool.switcher, p, network.EventBadMessage)
 			return
 		}
 		//1. 校验交易
 		//2. 加入交易池
 		needSendtxs := model.Txs{Tansactions: make([]*model.Tx, 0)}
 		for _, tx := range txResp.Tansactions {
-			if txpool.VerifyTx(tx) != nil {
+			if reason, err := txpool.verifyTx(tx); err != nil {
+				txRejected.With(reason).Inc()
+				// 其他原因可能是本节点状态落后 只有签名错误一定是对方的问题
+				if reason == "bad_signature" {
+					network.ReportPeer(txpool.switcher, p, network.EventBadSignature)
+				}
 				continue
 			}
 			txpool.AddTx(tx)
@@ -102,13 +114,19 @@ func (txpool *TxPool) msgOnRecv(modelID string, msgBytes []byte, p *network.Peer
 		if len(needSendtxs.Tansactions) == 0 {
 			return
 		}
-		//  广播给其他节点 但是不广播给接收节点
+		// 全部校验通过时原样转发 消息ID和收到的相同 其他节点可以去重
+		if len(needSendtxs.Tansactions) == len(txResp.Tansactions) {
+			txpool.switcher.Gossip("transaction", msgPkg, p)
+			return
+		}
+		//  只转发校验通过的交易 TTL继承收到的消息
 		msgBody, _ := proto.Marshal(&needSendtxs)
 		var broadcastTx network.BroadcastMsg
 		broadcastTx.ModelID = "transaction"
 		broadcastTx.MsgType = model.BroadcastMsgType_send_tx
 		broadcastTx.Msg = msgBody
-		txpool.switcher.BroadcastExceptPeer("transaction", &broadcastTx, p)
+		broadcastTx.TTL = msgPkg.TTL
+		txpool.switcher.Gossip("transaction", &broadcastTx, p)
 
 	default:
 		logger.Warnf("transaction 模块不能处理从消息类型")
@@ -120,9 +138,23 @@ func (txpool *TxPool) GetTx(nums int) []*model.Tx {
 	return txpool.pool.scanValue(nums)
 }
 
+// Len 交易池中的交易数量
+func (txpool *TxPool) Len() int {
+	return int(txpool.pool.len())
+}
+
 func (txpool *TxPool) AddTx(tx *model.Tx) bool {
 	// todo:: 可能会需要根据cap删除一些
-	return txpool.pool.addValue(tx)
+	if txpool.pool.addValue(tx) {
+		txAccepted.Inc()
+		return true
+	}
+	if txpool.pool.exist(tx) {
+		txRejected.With("duplicate").Inc()
+	} else {
+		txRejected.With("pool_full").Inc()
+	}
+	return false
 }
 
 func (txpool *TxPool) RemoveTx(tx *model.Tx) {
@@ -130,50 +162,59 @@ func (txpool *TxPool) RemoveTx(tx *model.Tx) {
 }
 
 func (txpool *TxPool) VerifyTx(tx *model.Tx) error {
+	reason, err := txpool.verifyTx(tx)
+	if err != nil {
+		txRejected.With(reason).Inc()
+	}
+	return err
+}
+
+// verifyTx 校验交易 失败时同时返回用于统计的拒绝原因
+func (txpool *TxPool) verifyTx(tx *model.Tx) (string, error) {
 	// 数据格式校验
 	// 超过48小时的交易都忽略
 	// 或者比当前时间快5分钟
 	n := time.Now().Unix()
 	if tx.Sender == nil || tx.Sender.Address == "" {
-		return fmt.Errorf("交易数据from地址为空")
+		return "empty_sender", fmt.Errorf("交易数据from地址为空")
 	}
 	if tx.Sequeue == "" {
-		return fmt.Errorf("交易数据序列号为空")
+		return "empty_sequeue", fmt.Errorf("交易数据序列号为空")
 	}
 	if len(tx.Sign) == 0 {
-		return fmt.Errorf("交易数据未签名")
+		return "unsigned", fmt.Errorf("交易数据未签名")
 	}
 	if len(tx.PublickKey) == 0 {
-		return fmt.Errorf("交易数据公钥为空")
+		return "empty_public_key", fmt.Errorf("交易数据公钥为空")
 	}
 	if n-int64(tx.TimeStamp) > 48*3600 || int64(tx.TimeStamp)-n > 5*60 {
-		return fmt.Errorf("交易时间戳错误")
+		return "bad_timestamp", fmt.Errorf("交易时间戳错误")
 	}
 	// 首先交易 签名是否正确
 	accountAddr := model.PublicKeyToAddress(tx.PublickKey)
 
 	if tx.Sender.Address != accountAddr.Address {
-		return fmt.Errorf("账户ID和sender不匹配 id: %s, sender: %s", accountAddr, tx.Sender.Address)
+		return "sender_mismatch", fmt.Errorf("账户ID和sender不匹配 id: %s, sender: %s", accountAddr, tx.Sender.Address)
 	}
 	// 查询账户信息
 	account, err := txpool.db.GetAccountByID(tx.Sender.Address)
 	if err != nil {
-		return err
+		return "storage_error", err
 	}
 	if account == nil {
-		return fmt.Errorf("账户不存在")
+		return "unknown_account", fmt.Errorf("账户不存在")
 	}
 	if model.Compare(account.Balance.Amount, tx.Amount.Amount) < 0 {
-		return fmt.Errorf("余额不足")
+		return "insufficient_balance", fmt.Errorf("余额不足")
 	}
 
 	// 签名
 	ok, err := tx.VerifySignedTx()
 	if err != nil {
-		return err
+		return "bad_signature", err
 	}
 	if !ok {
-		return fmt.Errorf("验签不通过")
+		return "bad_signature", fmt.Errorf("验签不通过")
 	}
-	return nil
+	return "", nil
 }
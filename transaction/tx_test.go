@@ -0,0 +1,95 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/wupeaking/pbft_impl/common/config"
+	cryptogo "github.com/wupeaking/pbft_impl/crypto"
+	"github.com/wupeaking/pbft_impl/model"
+	"github.com/wupeaking/pbft_impl/network"
+	"github.com/wupeaking/pbft_impl/network/memnet"
+	"github.com/wupeaking/pbft_impl/storage/cache"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// 全部校验通过的交易原样转发 消息ID不变 部分通过时只转发通过的交易
+func TestRelayTxs(t *testing.T) {
+	now := time.Now()
+	net := memnet.NewManual(1, func() time.Time { return now })
+	a, _ := net.NewSwitcher("a")
+	b, _ := net.NewSwitcher("b")
+	c, _ := net.NewSwitcher("c")
+	relayed := make([]*network.BroadcastMsg, 0)
+	c.RegisterOnReceive("transaction", func(modelID string, msg *network.BroadcastMsg, p *network.Peer) {
+		if p.ID == "b" {
+			relayed = append(relayed, msg)
+		}
+	})
+
+	// 交易中的公钥是X和Y直接拼接 不足64字节时签名不能校验
+	var priv *ecdsa.PrivateKey
+	var pub []byte
+	for len(pub) != 64 {
+		privHex, _, err := cryptogo.GenerateKeyPairs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if priv, err = cryptogo.LoadPrivateKey(privHex); err != nil {
+			t.Fatal(err)
+		}
+		pub = append(priv.PublicKey.X.Bytes(), priv.PublicKey.Y.Bytes()...)
+	}
+	from := model.PublicKeyToAddress(pub)
+	db := cache.NewMemory()
+	if err := db.Insert(&model.Account{Id: from, Balance: &model.Amount{Amount: "100"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Configure{}
+	cfg.TxCfg.MaxTxNum = 100
+	cfg.TxCfg.LogLevel = "error"
+	pool := NewTxPool(b, cfg, db)
+	pool.Start()
+
+	newTx := func(seq string) *model.Tx {
+		tx := &model.Tx{Sender: from, Recipient: from, Amount: &model.Amount{Amount: "1"},
+			Sequeue: seq, TimeStamp: uint64(now.Unix())}
+		if err := tx.SignTx(priv); err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	// 每笔交易带上显式编码的空input 和重新编码的结果不同
+	send := func(txs ...*model.Tx) *network.BroadcastMsg {
+		var body []byte
+		for _, tx := range txs {
+			b, _ := proto.Marshal(tx)
+			b = protowire.AppendTag(b, 5, protowire.BytesType)
+			b = protowire.AppendBytes(b, nil)
+			body = protowire.AppendTag(body, 1, protowire.BytesType)
+			body = protowire.AppendBytes(body, b)
+		}
+		msg := &network.BroadcastMsg{ModelID: "transaction", MsgType: model.BroadcastMsgType_send_tx,
+			Msg: body, TTL: network.DefaultGossipTTL}
+		a.BroadcastToPeer("transaction", msg, &network.Peer{ID: "b"})
+		for net.Deliver() {
+		}
+		return msg
+	}
+
+	msg := send(newTx("1"), newTx("2"))
+	if len(relayed) != 1 || network.MsgID(relayed[0]) != network.MsgID(msg) {
+		t.Fatalf("全部校验通过的交易应该原样转发")
+	}
+
+	bad := newTx("3")
+	bad.Amount = &model.Amount{Amount: "1000"}
+	send(newTx("4"), bad)
+	var txs model.Txs
+	if len(relayed) != 2 || proto.Unmarshal(relayed[1].Msg, &txs) != nil || len(txs.Tansactions) != 1 ||
+		txs.Tansactions[0].Sequeue != "4" {
+		t.Fatalf("只应该转发校验通过的交易")
+	}
+}